@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/joho/godotenv"
 	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mailer"
 	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	"os"
@@ -29,7 +30,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	appState := state.NewState(cfg, db, logger)
+	// Without an SMTP relay emails are written to the outbox instead of being sent.
+	var mail mailer.Mailer = mailer.NewOutbox(cfg.MailOutboxDir, os.Stdout, cfg.SMTPSender)
+	if cfg.SMTPHost != "" {
+		mail = mailer.NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPSender)
+	}
+
+	appState := state.NewState(cfg, db, logger, mail)
 
 	err = httpserver.Serve(appState)
 	if err != nil {
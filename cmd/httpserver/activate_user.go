@@ -2,11 +2,9 @@ package httpserver
 
 import (
 	"fmt"
-	"github.com/golang-jwt/jwt/v4"
 	"go_chi_pgx/state"
 	utils "go_chi_pgx/utils"
 	"net/http"
-	"strings"
 )
 
 func HandleActivateUser(app *state.State) http.HandlerFunc {
@@ -18,41 +16,26 @@ func HandleActivateUser(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(fmt.Errorf("missing token"), map[string]string{
 				"context": "missing token",
 			})
-			_ = BadRequestError.WriteToResponse(w, nil)
+			_ = BadRequestError.WriteProblem(w, req, nil)
 			return
 		}
 
-		var claims utils.Claims
-		secretKey := app.Config.SecretKey
-
-		token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := utils.VerifyJWT(tokenString, utils.ScopeActivation, app.Config.TokenKeys())
+		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "invalid token",
 			})
-			_ = InvalidToken.WriteToResponse(w, nil)
+			_ = tokenErrorResponse(err, InvalidToken).WriteProblem(w, req, nil)
 			return
 		}
 
 		userID := claims.UserID
 		err = app.Repository.ActivateUserByID(ctx, userID)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") {
-
-				app.Logger.PrintError(err, map[string]string{
-					"context": "user not found during activation",
-				})
-				_ = UserNotFound.WriteToResponse(w, nil)
-				return
-			}
-
 			app.Logger.PrintError(err, map[string]string{
 				"context": "failed to activate user",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = repositoryErrorResponse(err, UserNotFound).WriteProblem(w, req, nil)
 			return
 		}
 
@@ -0,0 +1,334 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	govcard "github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/carddav"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"go_chi_pgx/vcard"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CardDAV resources live under cardDAVPrefix, one tree per user:
+//
+//	/carddav/<user id>/                      principal
+//	/carddav/<user id>/contacts/             address book home set
+//	/carddav/<user id>/contacts/default/     the user's only address book
+//	/carddav/<user id>/contacts/default/<name>.vcf
+const (
+	cardDAVPrefix      = "/carddav"
+	cardDAVRealm       = "Contacts"
+	maxDAVRequestBytes = 1 << 20
+)
+
+func init() {
+	// chi answers 405 to methods it doesn't know about.
+	for _, method := range []string{"PROPFIND", "PROPPATCH", "REPORT", "MKCOL", "COPY", "MOVE"} {
+		chi.RegisterMethod(method)
+	}
+}
+
+type ifMatchKey struct{}
+
+// HandlerCardDAV serves the caller's contacts as a CardDAV (RFC 6352) address
+// book. PROPFIND, addressbook-query and addressbook-multiget REPORTs, GET, PUT
+// and DELETE go to go-webdav; sync-collection REPORTs and address book
+// PROPFINDs, which need the sync token, are answered here. It expects
+// BasicAuthMiddleware in front of it.
+func HandlerCardDAV(app *state.State) http.Handler {
+	dav := &carddav.Handler{Backend: &cardDAVBackend{app: app}, Prefix: cardDAVPrefix}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, maxDAVRequestBytes)
+
+		isAddressBook := strings.TrimSuffix(path.Clean(req.URL.Path), "/")+"/" == addressBookPath(userID)
+		switch {
+		case req.Method == "REPORT" && isAddressBook:
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if isSyncCollection(body) {
+				serveSyncCollection(app, w, req, userID, body)
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		case req.Method == "PROPFIND" && isAddressBook && req.Header.Get("Depth") == "0":
+			serveAddressBookPropfind(app, w, req, userID)
+			return
+		case req.Method == http.MethodDelete:
+			req = req.WithContext(context.WithValue(ctx, ifMatchKey{}, webdav.ConditionalMatch(req.Header.Get("If-Match"))))
+		}
+
+		dav.ServeHTTP(w, req)
+	})
+}
+
+func principalPath(userID uuid.UUID) string {
+	return cardDAVPrefix + "/" + userID.String() + "/"
+}
+
+func addressBookHomeSetPath(userID uuid.UUID) string {
+	return principalPath(userID) + "contacts/"
+}
+
+func addressBookPath(userID uuid.UUID) string {
+	return addressBookHomeSetPath(userID) + "default/"
+}
+
+// addressObjectPath is the href of a contact. Contacts created through the
+// API or under a "<id>.vcf" name have no DAVName.
+func addressObjectPath(contact *repository.Contact) string {
+	name := contact.DAVName
+	if name == "" {
+		name = contact.ID.String() + ".vcf"
+	}
+	return addressBookPath(contact.UserID) + name
+}
+
+// contactFromPath maps an address object path to a contact ID. Clients pick
+// resource names freely, so a name other than "<id>.vcf" maps to a name-based
+// UUID and is returned so it can be stored as the contact's DAVName.
+func contactFromPath(userID uuid.UUID, p string) (uuid.UUID, string, error) {
+	dir, name := path.Split(p)
+	if dir != addressBookPath(userID) || name == "" {
+		return uuid.Nil, "", webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("carddav: no address object at %q", p))
+	}
+	if id, err := uuid.FromString(strings.TrimSuffix(name, ".vcf")); err == nil && name == id.String()+".vcf" {
+		return id, "", nil
+	}
+	return uuid.NewV5(userID, name), name, nil
+}
+
+// contactETag is the strong ETag of a contact, which changes with every write.
+func contactETag(contact *repository.Contact) string {
+	return strconv.FormatInt(contact.SyncSeq, 10)
+}
+
+// davError turns a repository error into the HTTP error go-webdav serves.
+func davError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return webdav.NewHTTPError(http.StatusNotFound, err)
+	case errors.Is(err, repository.ErrPreconditionFailed):
+		return webdav.NewHTTPError(http.StatusPreconditionFailed, err)
+	case errors.Is(err, repository.ErrUniqueViolation), errors.Is(err, repository.ErrConflict):
+		return webdav.NewHTTPError(http.StatusConflict, err)
+	case errors.Is(err, repository.ErrTimeout):
+		return webdav.NewHTTPError(http.StatusServiceUnavailable, err)
+	}
+	return err
+}
+
+// cardDAVBackend implements carddav.Backend on top of the Repository. Each
+// user has a single address book holding all of their contacts.
+type cardDAVBackend struct {
+	app *state.State
+}
+
+func (b *cardDAVBackend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	userID, err := GetUserUUIDFromContext(ctx)
+	if err != nil {
+		return "", webdav.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	return principalPath(userID), nil
+}
+
+func (b *cardDAVBackend) AddressBookHomeSetPath(ctx context.Context) (string, error) {
+	userID, err := GetUserUUIDFromContext(ctx)
+	if err != nil {
+		return "", webdav.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	return addressBookHomeSetPath(userID), nil
+}
+
+func (b *cardDAVBackend) addressBook(userID uuid.UUID) carddav.AddressBook {
+	return carddav.AddressBook{
+		Path:            addressBookPath(userID),
+		Name:            cardDAVRealm,
+		MaxResourceSize: maxDAVRequestBytes,
+		SupportedAddressData: []carddav.AddressDataType{
+			{ContentType: vcard.MediaType, Version: vcard.Version3},
+			{ContentType: vcard.MediaType, Version: vcard.Version4},
+		},
+	}
+}
+
+func (b *cardDAVBackend) ListAddressBooks(ctx context.Context) ([]carddav.AddressBook, error) {
+	userID, err := GetUserUUIDFromContext(ctx)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	return []carddav.AddressBook{b.addressBook(userID)}, nil
+}
+
+func (b *cardDAVBackend) GetAddressBook(ctx context.Context, p string) (*carddav.AddressBook, error) {
+	userID, err := GetUserUUIDFromContext(ctx)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	if strings.TrimSuffix(p, "/")+"/" != addressBookPath(userID) {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("carddav: no address book at %q", p))
+	}
+	ab := b.addressBook(userID)
+	return &ab, nil
+}
+
+func (b *cardDAVBackend) CreateAddressBook(ctx context.Context, addressBook *carddav.AddressBook) error {
+	return webdav.NewHTTPError(http.StatusForbidden, errors.New("carddav: address books can't be created"))
+}
+
+func (b *cardDAVBackend) DeleteAddressBook(ctx context.Context, p string) error {
+	return webdav.NewHTTPError(http.StatusForbidden, errors.New("carddav: address books can't be deleted"))
+}
+
+func (b *cardDAVBackend) GetAddressObject(ctx context.Context, p string, req *carddav.AddressDataRequest) (*carddav.AddressObject, error) {
+	userID, err := GetUserUUIDFromContext(ctx)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	contactID, _, err := contactFromPath(userID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	contact, err := b.app.Repository.GetContactObject(ctx, userID, contactID)
+	if err != nil {
+		return nil, davError(err)
+	}
+	return addressObject(contact), nil
+}
+
+func (b *cardDAVBackend) ListAddressObjects(ctx context.Context, p string, req *carddav.AddressDataRequest) ([]carddav.AddressObject, error) {
+	if _, err := b.GetAddressBook(ctx, p); err != nil {
+		return nil, err
+	}
+	userID, _ := GetUserUUIDFromContext(ctx)
+
+	var aos []carddav.AddressObject
+	err := b.app.Repository.StreamContacts(ctx, userID, repository.ContactFilter{}, func(contact *repository.Contact) error {
+		aos = append(aos, *addressObject(contact))
+		return nil
+	})
+	if err != nil {
+		return nil, davError(err)
+	}
+	return aos, nil
+}
+
+func (b *cardDAVBackend) QueryAddressObjects(ctx context.Context, p string, query *carddav.AddressBookQuery) ([]carddav.AddressObject, error) {
+	aos, err := b.ListAddressObjects(ctx, p, &query.DataRequest)
+	if err != nil {
+		return nil, err
+	}
+	return carddav.Filter(query, aos)
+}
+
+// PutAddressObject stores the card the way the API stores contacts: only the
+// TEL and ADR a contact has room for are kept. The stored card differs from
+// the one sent, so no ETag is returned and clients fetch it back.
+func (b *cardDAVBackend) PutAddressObject(ctx context.Context, p string, card govcard.Card, opts *carddav.PutAddressObjectOptions) (*carddav.AddressObject, error) {
+	userID, err := GetUserUUIDFromContext(ctx)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	contactID, davName, err := contactFromPath(userID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var cond repository.ContactPrecondition
+	switch {
+	case opts.IfNoneMatch.IsWildcard():
+		cond.MustNotExist = true
+	case opts.IfMatch.IsSet() && !opts.IfMatch.IsWildcard():
+		etag, err := opts.IfMatch.ETag()
+		if err != nil {
+			return nil, webdav.NewHTTPError(http.StatusBadRequest, err)
+		}
+		if cond.SyncSeq, err = strconv.ParseInt(etag, 10, 64); err != nil {
+			return nil, webdav.NewHTTPError(http.StatusPreconditionFailed, repository.ErrPreconditionFailed)
+		}
+	}
+
+	payload := vcardPayload(vcard.FromLibrary(card))
+	if err := payload.syncAndValidateSynced(newValidator(), b.app.Config.PhoneRegion); err != nil {
+		b.app.Logger.PrintError(err, map[string]string{
+			"context": "Invalid vCard",
+		})
+		return nil, carddav.NewPreconditionError(carddav.PreconditionValidAddressData)
+	}
+
+	contact := payload.contact(contactID, userID)
+	contact.DAVName = davName
+	if _, err := b.app.Repository.PutContactObject(ctx, &contact, cond); err != nil {
+		if !errors.Is(err, repository.ErrPreconditionFailed) {
+			b.app.Logger.PrintError(err, map[string]string{
+				"context": "Error storing vCard",
+			})
+		}
+		return nil, davError(err)
+	}
+	return &carddav.AddressObject{Path: addressObjectPath(&contact)}, nil
+}
+
+// DeleteAddressObject honours the If-Match header HandlerCardDAV put in ctx,
+// which go-webdav doesn't check for DELETE.
+func (b *cardDAVBackend) DeleteAddressObject(ctx context.Context, p string) error {
+	userID, err := GetUserUUIDFromContext(ctx)
+	if err != nil {
+		return webdav.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	contactID, _, err := contactFromPath(userID, p)
+	if err != nil {
+		return err
+	}
+
+	ifMatch, _ := ctx.Value(ifMatchKey{}).(webdav.ConditionalMatch)
+	err = b.app.Repository.InTx(ctx, func(ctx context.Context) error {
+		if ifMatch.IsSet() && !ifMatch.IsWildcard() {
+			contact, err := b.app.Repository.GetContactObject(ctx, userID, contactID)
+			if err != nil {
+				return err
+			}
+			if etag, err := ifMatch.ETag(); err != nil || etag != contactETag(contact) {
+				return repository.ErrPreconditionFailed
+			}
+		}
+		return b.app.Repository.DeleteContactByID(ctx, userID, contactID)
+	})
+	if err != nil {
+		return davError(err)
+	}
+	return nil
+}
+
+func addressObject(contact *repository.Contact) *carddav.AddressObject {
+	return &carddav.AddressObject{
+		Path:    addressObjectPath(contact),
+		ModTime: contact.UpdatedAt,
+		ETag:    contactETag(contact),
+		Card:    vcard.FromContact(contact, vcard.Version3).Library(),
+	}
+}
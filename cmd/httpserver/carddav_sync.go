@@ -0,0 +1,319 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"go_chi_pgx/vcard"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// go-webdav serves neither sync-collection (RFC 6578) nor the sync-token and
+// getctag properties clients poll to notice changes, so this file answers
+// those requests itself from the contacts change feed.
+
+const (
+	nsDAV         = "DAV:"
+	nsCardDAV     = "urn:ietf:params:xml:ns:carddav"
+	nsCalendarSrv = "http://calendarserver.org/ns/"
+
+	// syncTokenPrefix turns a change feed position into the URI RFC 6578
+	// asks sync tokens to be.
+	syncTokenPrefix = "urn:go-chi-pgx:contacts:sync:"
+)
+
+var (
+	propResourceType       = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName        = xml.Name{Space: nsDAV, Local: "displayname"}
+	propCurrentPrincipal   = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrivilegeSet       = xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}
+	propSupportedReportSet = xml.Name{Space: nsDAV, Local: "supported-report-set"}
+	propSyncToken          = xml.Name{Space: nsDAV, Local: "sync-token"}
+	propGetCTag            = xml.Name{Space: nsCalendarSrv, Local: "getctag"}
+	propSupportedData      = xml.Name{Space: nsCardDAV, Local: "supported-address-data"}
+	propGetETag            = xml.Name{Space: nsDAV, Local: "getetag"}
+	propGetContentType     = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propGetLastModified    = xml.Name{Space: nsDAV, Local: "getlastmodified"}
+	propAddressData        = xml.Name{Space: nsCardDAV, Local: "address-data"}
+)
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"response"`
+	SyncToken string        `xml:"sync-token,omitempty"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"href"`
+	Propstats []davPropstat `xml:"propstat"`
+	Status    string        `xml:"status,omitempty"`
+}
+
+type davPropstat struct {
+	Prop   davPropList `xml:"prop"`
+	Status string      `xml:"status"`
+}
+
+type davPropList struct {
+	Props []davProp
+}
+
+// davProp is a property element whose content is already encoded XML.
+type davProp struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+// davPropNames lists the properties a request asks for.
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+		Version string `xml:"version,attr"`
+	} `xml:",any"`
+}
+
+type propfindRequest struct {
+	XMLName  xml.Name      `xml:"DAV: propfind"`
+	AllProp  *struct{}     `xml:"DAV: allprop"`
+	PropName *struct{}     `xml:"DAV: propname"`
+	Prop     *davPropNames `xml:"DAV: prop"`
+}
+
+type syncCollectionRequest struct {
+	XMLName   xml.Name `xml:"DAV: sync-collection"`
+	SyncToken string   `xml:"DAV: sync-token"`
+	Limit     *struct {
+		NResults int `xml:"DAV: nresults"`
+	} `xml:"DAV: limit"`
+	Prop davPropNames `xml:"DAV: prop"`
+}
+
+func isSyncCollection(body []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name == xml.Name{Space: nsDAV, Local: "sync-collection"}
+		}
+	}
+}
+
+func syncToken(seq int64) string {
+	return syncTokenPrefix + strconv.FormatInt(seq, 10)
+}
+
+// parseSyncToken returns the change feed position of token, 0 for the empty
+// token of an initial sync.
+func parseSyncToken(token string) (int64, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(strings.TrimPrefix(token, syncTokenPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(token, syncTokenPrefix) {
+		return 0, repository.ErrInvalidSyncToken
+	}
+	return seq, nil
+}
+
+func davText(name xml.Name, text string) davProp {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(text))
+	return davProp{XMLName: name, Inner: b.String()}
+}
+
+func davHref(name xml.Name, href string) davProp {
+	prop := davText(name, href)
+	prop.Inner = `<href xmlns="DAV:">` + prop.Inner + `</href>`
+	return prop
+}
+
+func davStatus(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+// propstats splits the requested properties into those found in props, which
+// are returned with 200, and the rest, returned empty with 404.
+func propstats(requested []xml.Name, props map[xml.Name]davProp) []davPropstat {
+	found := davPropstat{Status: davStatus(http.StatusOK)}
+	missing := davPropstat{Status: davStatus(http.StatusNotFound)}
+	for _, name := range requested {
+		if prop, ok := props[name]; ok {
+			found.Prop.Props = append(found.Prop.Props, prop)
+		} else {
+			missing.Prop.Props = append(missing.Prop.Props, davProp{XMLName: name})
+		}
+	}
+
+	var result []davPropstat
+	for _, ps := range []davPropstat{found, missing} {
+		if len(ps.Prop.Props) > 0 {
+			result = append(result, ps)
+		}
+	}
+	return result
+}
+
+func writeMultistatus(w http.ResponseWriter, ms *davMultistatus) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(ms)
+}
+
+// writeDAVError sends a DAV:error body naming the failed precondition.
+func writeDAVError(w http.ResponseWriter, code int, precondition xml.Name) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"DAV: error"`
+		Prop    davProp
+	}{Prop: davProp{XMLName: precondition}})
+}
+
+// serveAddressBookPropfind answers a Depth 0 PROPFIND on the address book,
+// adding the sync token, getctag and supported reports to what go-webdav
+// reports.
+func serveAddressBookPropfind(app *state.State, w http.ResponseWriter, req *http.Request, userID uuid.UUID) {
+	var propfind propfindRequest
+	if req.ContentLength != 0 {
+		if err := xml.NewDecoder(req.Body).Decode(&propfind); err != nil {
+			http.Error(w, "carddav: invalid PROPFIND body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	seq, err := app.Repository.GetContactsSyncSeq(req.Context(), userID)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"context": "Error fetching sync token",
+		})
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	props := map[xml.Name]davProp{
+		propResourceType:     {XMLName: propResourceType, Inner: `<collection xmlns="DAV:"></collection><addressbook xmlns="` + nsCardDAV + `"></addressbook>`},
+		propDisplayName:      davText(propDisplayName, cardDAVRealm),
+		propCurrentPrincipal: davHref(propCurrentPrincipal, principalPath(userID)),
+		propPrivilegeSet: {XMLName: propPrivilegeSet, Inner: `<privilege xmlns="DAV:"><read></read></privilege>` +
+			`<privilege xmlns="DAV:"><write></write></privilege>`},
+		propSupportedReportSet: {XMLName: propSupportedReportSet, Inner: `<supported-report xmlns="DAV:"><report><sync-collection></sync-collection></report></supported-report>` +
+			`<supported-report xmlns="DAV:"><report><addressbook-query xmlns="` + nsCardDAV + `"></addressbook-query></report></supported-report>` +
+			`<supported-report xmlns="DAV:"><report><addressbook-multiget xmlns="` + nsCardDAV + `"></addressbook-multiget></report></supported-report>`},
+		propSyncToken: davText(propSyncToken, syncToken(seq)),
+		propGetCTag:   davText(propGetCTag, syncToken(seq)),
+		propSupportedData: {XMLName: propSupportedData, Inner: `<address-data-type xmlns="` + nsCardDAV + `" content-type="text/vcard" version="3.0"></address-data-type>` +
+			`<address-data-type xmlns="` + nsCardDAV + `" content-type="text/vcard" version="4.0"></address-data-type>`},
+	}
+
+	var requested []xml.Name
+	switch {
+	case propfind.Prop != nil:
+		for _, prop := range propfind.Prop.Names {
+			requested = append(requested, prop.XMLName)
+		}
+	default:
+		requested = []xml.Name{
+			propResourceType, propDisplayName, propCurrentPrincipal, propPrivilegeSet,
+			propSupportedReportSet, propSyncToken, propGetCTag, propSupportedData,
+		}
+	}
+	response := davResponse{Href: addressBookPath(userID), Propstats: propstats(requested, props)}
+	if propfind.PropName != nil {
+		for i := range response.Propstats {
+			for j := range response.Propstats[i].Prop.Props {
+				response.Propstats[i].Prop.Props[j].Inner = ""
+			}
+		}
+	}
+
+	writeMultistatus(w, &davMultistatus{Responses: []davResponse{response}})
+}
+
+// serveSyncCollection answers a sync-collection REPORT with the contacts
+// changed and deleted since the given token. A limit that cuts the changes
+// short is reported with a 507 response for the address book, and the
+// returned token resumes after the last change sent.
+func serveSyncCollection(app *state.State, w http.ResponseWriter, req *http.Request, userID uuid.UUID, body []byte) {
+	var report syncCollectionRequest
+	if err := xml.Unmarshal(body, &report); err != nil {
+		http.Error(w, "carddav: invalid sync-collection body", http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if report.Limit != nil {
+		limit = report.Limit.NResults
+	}
+
+	since, err := parseSyncToken(report.SyncToken)
+	var changes *repository.ContactChanges
+	if err == nil {
+		changes, err = app.Repository.GetContactChanges(req.Context(), userID, since, limit)
+	}
+	if errors.Is(err, repository.ErrInvalidSyncToken) {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "valid-sync-token"})
+		return
+	}
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"context": "Error fetching contact changes",
+		})
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	ms := &davMultistatus{SyncToken: syncToken(changes.SyncSeq)}
+	for i := range changes.Updated {
+		contact := &changes.Updated[i]
+		props := map[xml.Name]davProp{
+			propGetETag:         davText(propGetETag, strconv.Quote(contactETag(contact))),
+			propGetContentType:  davText(propGetContentType, vcardContentType),
+			propGetLastModified: davText(propGetLastModified, contact.UpdatedAt.UTC().Format(http.TimeFormat)),
+		}
+
+		var requested []xml.Name
+		for _, prop := range report.Prop.Names {
+			requested = append(requested, prop.XMLName)
+			if prop.XMLName == propAddressData {
+				var card bytes.Buffer
+				version := vcard.Version3
+				if prop.Version == vcard.Version4 {
+					version = vcard.Version4
+				}
+				_ = vcard.NewEncoder(&card).Encode(vcard.FromContact(contact, version))
+				props[propAddressData] = davText(propAddressData, card.String())
+			}
+		}
+
+		ms.Responses = append(ms.Responses, davResponse{
+			Href:      addressObjectPath(contact),
+			Propstats: propstats(requested, props),
+		})
+	}
+	for _, tombstone := range changes.Deleted {
+		ms.Responses = append(ms.Responses, davResponse{
+			Href:   addressObjectPath(&repository.Contact{ID: tombstone.ContactID, UserID: userID, DAVName: tombstone.DAVName}),
+			Status: davStatus(http.StatusNotFound),
+		})
+	}
+	if changes.Truncated {
+		ms.Responses = append(ms.Responses, davResponse{
+			Href:   addressBookPath(userID),
+			Status: davStatus(http.StatusInsufficientStorage),
+		})
+	}
+
+	writeMultistatus(w, ms)
+}
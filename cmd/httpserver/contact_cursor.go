@@ -0,0 +1,142 @@
+package httpserver
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// contactCursor is the signed payload behind the opaque ?cursor= values.
+type contactCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Backward  bool      `json:"b,omitempty"`
+}
+
+func listContactsByCursor(app *state.State, w http.ResponseWriter, req *http.Request, userID uuid.UUID, filter repository.ContactFilter) {
+	ctx := req.Context()
+
+	if _, err := filter.KeysetDescending(); err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"context": "cursor pagination",
+		})
+		_ = BadRequestError.WriteProblem(w, req, nil)
+		return
+	}
+
+	pageSize := 10
+	if param := req.URL.Query().Get("page_size"); param != "" {
+		size, err := strconv.Atoi(param)
+		if err != nil || size <= 0 {
+			app.Logger.PrintError(fmt.Errorf("invalid page_size value"), map[string]string{
+				"context": "cursor pagination",
+			})
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
+		}
+		pageSize = size
+	}
+
+	var key *repository.ContactKeyset
+	if param := req.URL.Query().Get("cursor"); param != "" {
+		var cursor contactCursor
+		if err := utils.VerifyCursor(param, app.Config.CursorKey, &cursor); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "cursor pagination",
+			})
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
+		}
+		key = &repository.ContactKeyset{CreatedAt: cursor.CreatedAt, ID: cursor.ID, Backward: cursor.Backward}
+	}
+
+	// One extra row tells whether another page exists in the direction of travel.
+	contacts, err := app.Repository.GetContactsPage(ctx, userID, filter, key, pageSize+1)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"Context": "Error fetching contacts",
+		})
+		_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+		return
+	}
+
+	backward := key != nil && key.Backward
+	more := len(contacts) > pageSize
+	if more && backward {
+		contacts = contacts[1:]
+	} else if more {
+		contacts = contacts[:pageSize]
+	}
+
+	totalCount, err := app.Repository.GetContactsCount(ctx, userID, filter)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"Context": "Error fetching contacts count",
+		})
+		_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+		return
+	}
+
+	tagFacets, err := app.Repository.GetTagFacets(ctx, userID, filter)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"Context": "Error fetching tag facets",
+		})
+		_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+		return
+	}
+
+	response := ContactsResponse{
+		Mode:       PaginationCursor,
+		TotalCount: totalCount,
+		Facets:     ContactFacets{Tags: tagFacets},
+		Contacts:   contactResponses(contacts),
+	}
+
+	if len(contacts) > 0 {
+		// Having arrived from a cursor, there is always a page on the side
+		// we came from; the extra row answers for the other side.
+		baseURL := requestBaseURL(req)
+		hasNext := more || backward
+		hasPrev := (more && backward) || (key != nil && !backward)
+
+		if hasNext {
+			last := contacts[len(contacts)-1]
+			response.Next, err = cursorURL(baseURL, req.URL.Query(), pageSize, contactCursor{CreatedAt: last.CreatedAt, ID: last.ID}, app.Config.CursorKey)
+		}
+		if err == nil && hasPrev {
+			first := contacts[0]
+			response.Previous, err = cursorURL(baseURL, req.URL.Query(), pageSize, contactCursor{CreatedAt: first.CreatedAt, ID: first.ID, Backward: true}, app.Config.CursorKey)
+		}
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "cursor pagination",
+			})
+			_ = InternalError.WriteProblem(w, req, nil)
+			return
+		}
+	}
+
+	_ = ContactRetrieved.WriteToResponse(w, response)
+}
+
+// cursorURL links to the page at cursor, keeping the filters of the current
+// request and dropping any offset parameters.
+func cursorURL(baseURL string, query url.Values, pageSize int, cursor contactCursor, secretKey string) (string, error) {
+	token, err := utils.SignCursor(cursor, secretKey)
+	if err != nil {
+		return "", err
+	}
+
+	query.Del("limit")
+	query.Del("offset")
+	query.Set("page_size", strconv.Itoa(pageSize))
+	query.Set("cursor", token)
+	return baseURL + "?" + query.Encode(), nil
+}
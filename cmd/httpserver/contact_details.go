@@ -0,0 +1,443 @@
+package httpserver
+
+import (
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/geo"
+	"go_chi_pgx/phone"
+	"go_chi_pgx/repository"
+	"slices"
+	"strings"
+)
+
+// Labels given to list entries sent without one.
+const (
+	defaultPhoneLabel   = "mobile"
+	defaultEmailLabel   = "home"
+	defaultAddressLabel = "home"
+)
+
+// PhonePayload is one number of a contact. E164 is filled in by
+// normalizePhones; whatever the client sends for it is ignored.
+type PhonePayload struct {
+	Label   string `json:"label" validate:"omitempty,oneof=mobile work home other"`
+	Number  string `json:"number" validate:"required,max=20"`
+	E164    string `json:"e164"`
+	Primary bool   `json:"primary"`
+}
+
+type EmailPayload struct {
+	Label   string `json:"label" validate:"omitempty,oneof=home work other"`
+	Address string `json:"address" validate:"required,email,max=254"`
+	Primary bool   `json:"primary"`
+}
+
+type AddressPayload struct {
+	Label   string `json:"label" validate:"omitempty,oneof=home work other"`
+	Street  string `json:"street" validate:"max=100"`
+	City    string `json:"city" validate:"max=50"`
+	State   string `json:"state" validate:"max=50"`
+	ZipCode string `json:"zip_code" validate:"max=20"`
+	Country string `json:"country" validate:"max=50"`
+	Primary bool   `json:"primary"`
+}
+
+func (a AddressPayload) empty() bool {
+	return a.Street == "" && a.City == "" && a.State == "" && a.ZipCode == "" && a.Country == ""
+}
+
+// normalize rewrites a known country as its ISO 3166-1 alpha-2 code, a known
+// state of it as its ISO 3166-2 code without the country, such as "CA" for
+// California, and the zip code in the upper case form of the country. Unknown
+// values are left as they are for validateContactAddresses to report.
+func (a *AddressPayload) normalize() {
+	country, ok := geo.LookupCountry(a.Country)
+	if !ok {
+		return
+	}
+	a.Country = country.Code
+	if subdivision, ok := geo.LookupSubdivision(country.Code, a.State); ok {
+		a.State = subdivision.Short()
+	}
+	a.ZipCode, _ = geo.NormalizePostalCode(country.Code, a.ZipCode)
+}
+
+// primaryIndex returns the first entry flagged primary, the first entry when
+// none is, and -1 for an empty list.
+func primaryIndex[T any](list []T, primary func(T) bool) int {
+	if i := slices.IndexFunc(list, primary); i >= 0 {
+		return i
+	}
+	if len(list) > 0 {
+		return 0
+	}
+	return -1
+}
+
+// syncPrimary keeps the flat phone and address fields in step with the
+// primary entries of Phones and Addresses. With phonesFromList the primary
+// phone is copied into Phone; otherwise Phone is copied into the primary
+// phone, which is added when missing and dropped when Phone is empty, making
+// the next phone primary. Addresses work the same way. Afterwards every list
+// has exactly one primary entry, unless it is empty, and every entry a label.
+func (p *ContactRequestPayload) syncPrimary(phonesFromList, addressesFromList bool) {
+	i := primaryIndex(p.Phones, func(phone PhonePayload) bool { return phone.Primary })
+	if !phonesFromList {
+		switch {
+		case p.Phone == "" && i >= 0:
+			p.Phones = slices.Delete(p.Phones, i, i+1)
+		case i >= 0:
+			p.Phones[i].Number = p.Phone
+		case p.Phone != "":
+			p.Phones = append([]PhonePayload{{Number: p.Phone, Primary: true}}, p.Phones...)
+		}
+	}
+	i = primaryIndex(p.Phones, func(phone PhonePayload) bool { return phone.Primary })
+	p.Phone = ""
+	for j := range p.Phones {
+		p.Phones[j].Primary = j == i
+		if j == i {
+			p.Phone = p.Phones[j].Number
+		}
+		if p.Phones[j].Label == "" {
+			p.Phones[j].Label = defaultPhoneLabel
+		}
+	}
+
+	flat := AddressPayload{Street: p.Street, City: p.City, State: p.State, ZipCode: p.ZipCode, Country: p.Country}
+	i = primaryIndex(p.Addresses, func(address AddressPayload) bool { return address.Primary })
+	if !addressesFromList {
+		switch {
+		case flat.empty() && i >= 0:
+			p.Addresses = slices.Delete(p.Addresses, i, i+1)
+		case i >= 0:
+			flat.Label = p.Addresses[i].Label
+			p.Addresses[i] = flat
+			p.Addresses[i].Primary = true
+		case !flat.empty():
+			flat.Primary = true
+			p.Addresses = append([]AddressPayload{flat}, p.Addresses...)
+		}
+	}
+	i = primaryIndex(p.Addresses, func(address AddressPayload) bool { return address.Primary })
+	p.Street, p.City, p.State, p.ZipCode, p.Country = "", "", "", "", ""
+	for j := range p.Addresses {
+		p.Addresses[j].Primary = j == i
+		if j == i {
+			a := p.Addresses[j]
+			p.Street, p.City, p.State, p.ZipCode, p.Country = a.Street, a.City, a.State, a.ZipCode, a.Country
+		}
+		if p.Addresses[j].Label == "" {
+			p.Addresses[j].Label = defaultAddressLabel
+		}
+	}
+
+	i = primaryIndex(p.Emails, func(email EmailPayload) bool { return email.Primary })
+	for j := range p.Emails {
+		p.Emails[j].Primary = j == i
+		if p.Emails[j].Label == "" {
+			p.Emails[j].Label = defaultEmailLabel
+		}
+	}
+}
+
+// normalizeAddresses normalizes every address and the flat fields mirroring
+// the primary one.
+func (p *ContactRequestPayload) normalizeAddresses() {
+	for i := range p.Addresses {
+		p.Addresses[i].normalize()
+	}
+	flat := AddressPayload{State: p.State, ZipCode: p.ZipCode, Country: p.Country}
+	flat.normalize()
+	p.State, p.ZipCode, p.Country = flat.State, flat.ZipCode, flat.Country
+}
+
+// normalizePhones sets the E.164 form of every number, parsed for the
+// country of the primary address or for region when that is not a known
+// country. Numbers that do not parse are left without one, which
+// validateContactPhones reports.
+func (p *ContactRequestPayload) normalizePhones(region string) {
+	p.phoneRegion = phone.Region(p.Country, region)
+	for i := range p.Phones {
+		p.Phones[i].E164, _ = phone.Normalize(p.Phones[i].Number, p.phoneRegion)
+	}
+}
+
+// phoneE164 is the E.164 form of the primary phone, which Phone mirrors.
+func (p *ContactRequestPayload) phoneE164() string {
+	if i := primaryIndex(p.Phones, func(phone PhonePayload) bool { return phone.Primary }); i >= 0 {
+		return p.Phones[i].E164
+	}
+	return ""
+}
+
+// validateContact is the struct level validation of ContactRequestPayload,
+// which checks what the normalize methods could not make sense of.
+func validateContact(sl validator.StructLevel) {
+	p := sl.Current().Interface().(ContactRequestPayload)
+	validateContactPhones(sl, p)
+	validateContactAddresses(sl, p)
+}
+
+// validateContactPhones rejects the numbers normalizePhones could not parse.
+func validateContactPhones(sl validator.StructLevel, p ContactRequestPayload) {
+	for i, entry := range p.Phones {
+		if entry.Number != "" && entry.E164 == "" {
+			sl.ReportError(entry.Number, fmt.Sprintf("phones[%d].number", i), "Number", "phone", p.phoneRegion)
+		}
+	}
+	if p.Phone != "" && p.phoneE164() == "" {
+		sl.ReportError(p.Phone, "phone", "Phone", "phone", p.phoneRegion)
+	}
+}
+
+// validateContactAddresses rejects unknown countries, states that are not a
+// subdivision of their country and zip codes in the wrong format for it.
+// Without a country the state and zip code are not checked.
+func validateContactAddresses(sl validator.StructLevel, p ContactRequestPayload) {
+	validateAddress(sl, "", AddressPayload{State: p.State, ZipCode: p.ZipCode, Country: p.Country})
+	for i, address := range p.Addresses {
+		validateAddress(sl, fmt.Sprintf("addresses[%d].", i), address)
+	}
+}
+
+func validateAddress(sl validator.StructLevel, prefix string, a AddressPayload) {
+	if a.Country == "" {
+		return
+	}
+	if _, ok := geo.LookupCountry(a.Country); !ok {
+		sl.ReportError(a.Country, prefix+"country", "Country", "country", "")
+		return
+	}
+	if a.State != "" && geo.HasSubdivisions(a.Country) {
+		if _, ok := geo.LookupSubdivision(a.Country, a.State); !ok {
+			sl.ReportError(a.State, prefix+"state", "State", "subdivision", a.Country)
+		}
+	}
+	if _, ok := geo.NormalizePostalCode(a.Country, a.ZipCode); a.ZipCode != "" && !ok {
+		sl.ReportError(a.ZipCode, prefix+"zip_code", "ZipCode", "postcode", a.Country)
+	}
+}
+
+// syncAndValidate runs syncPrimary and the normalize methods, then validates
+// the result. The flat fields mirror the primary phone and address, so an invalid
+// value is reported once, under the field the client set it through. region
+// is the country numbers are parsed for when the contact has none.
+func (p *ContactRequestPayload) syncAndValidate(validate *validator.Validate, region string, phonesFromList, addressesFromList bool) error {
+	p.syncPrimary(phonesFromList, addressesFromList)
+	p.normalizeAddresses()
+	p.normalizePhones(region)
+
+	var validationErrors validator.ValidationErrors
+	if err := validate.Struct(p); !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	primaryPhone := fmt.Sprintf("phones[%d].", primaryIndex(p.Phones, func(phone PhonePayload) bool { return phone.Primary }))
+	primaryAddress := fmt.Sprintf("addresses[%d].", primaryIndex(p.Addresses, func(address AddressPayload) bool { return address.Primary }))
+	kept := validationErrors[:0]
+	seen := make(map[string]bool)
+	for _, fe := range validationErrors {
+		path := fieldPath(fe)
+		switch {
+		case seen[path]:
+			// Only the first failed rule of a field is reported, as for tags.
+		case phonesFromList && path == "phone" && fe.Tag() != "required":
+		case !phonesFromList && path == primaryPhone+"number":
+		case addressesFromList && slices.Contains(addressFields, path):
+		case !addressesFromList && strings.HasPrefix(path, primaryAddress) && slices.Contains(addressFields, strings.TrimPrefix(path, primaryAddress)):
+		default:
+			seen[path] = true
+			kept = append(kept, fe)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// syncAndValidatePatch is syncAndValidate for a write to a stored contact that
+// touches some of its fields. Phones and addresses are only validated when
+// touched, so values stored before they were validated don't keep the rest of
+// the contact from being edited. A nil touched validates no stored phone or
+// address at all, for writes whose values all come from stored contacts.
+func (p *ContactRequestPayload) syncAndValidatePatch(validate *validator.Validate, region string, phonesFromList, addressesFromList bool, touched map[string]bool) error {
+	return keepErrors(p.syncAndValidate(validate, region, phonesFromList, addressesFromList), func(fe validator.FieldError) bool {
+		return validatedField(fieldPath(fe), touched)
+	})
+}
+
+// syncAndValidateSynced is syncAndValidateNew for contacts a device syncs or a
+// user imports from another address book, which may hold numbers and
+// addresses that were never validated, such as local numbers without an area
+// code or countries in the language of the device. Those are normalized where
+// they are known and otherwise stored as sent, as the backfill jobs leave
+// them, instead of failing the write; every other rule still applies.
+func (p *ContactRequestPayload) syncAndValidateSynced(validate *validator.Validate, region string) error {
+	return keepErrors(p.syncAndValidateNew(validate, region), func(fe validator.FieldError) bool {
+		return !lenientRules[fe.Tag()]
+	})
+}
+
+// lenientRules are the rules syncAndValidateSynced doesn't enforce.
+var lenientRules = map[string]bool{
+	"phone":       true,
+	"country":     true,
+	"subdivision": true,
+	"postcode":    true,
+}
+
+// keepErrors returns err with only the validation errors keep accepts, and
+// nil when none is left. Other errors are returned as they are.
+func keepErrors(err error, keep func(validator.FieldError) bool) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	kept := validationErrors[:0]
+	for _, fe := range validationErrors {
+		if keep(fe) {
+			kept = append(kept, fe)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// validatedField reports whether errors at path are reported for a write that
+// touched the given fields.
+func validatedField(path string, touched map[string]bool) bool {
+	switch field, _, _ := strings.Cut(path, "["); field {
+	case "phone":
+		// Phone mirrors the primary of Phones, and is required of both.
+		return touched["phone"] || touched["phones"]
+	case "phones", "addresses", "country":
+		return touched[field]
+	case "state", "zip_code":
+		// They are checked against the country, which may be what changed.
+		return touched[field] || touched["country"]
+	}
+	return true
+}
+
+// addressFields are the flat fields mirroring the primary address.
+var addressFields = []string{"street", "city", "state", "zip_code", "country"}
+
+// syncAndValidateNew is syncAndValidate for a payload that describes a whole
+// contact: lists that were sent win over the flat fields.
+func (p *ContactRequestPayload) syncAndValidateNew(validate *validator.Validate, region string) error {
+	return p.syncAndValidate(validate, region, len(p.Phones) > 0, len(p.Addresses) > 0)
+}
+
+// contact returns the payload as a contact. Every list is non-nil, so writing
+// the contact replaces the stored lists.
+func (p *ContactRequestPayload) contact(contactID, userID uuid.UUID) repository.Contact {
+	return repository.Contact{
+		ID:             contactID,
+		UserID:         userID,
+		ContactProfile: p.profile(),
+		Phone:          p.Phone,
+		PhoneE164:      p.phoneE164(),
+		Street:         p.Street,
+		City:           p.City,
+		State:          p.State,
+		ZipCode:        p.ZipCode,
+		Country:        p.Country,
+		Phones:         p.phones(),
+		Emails:         p.emails(),
+		Addresses:      p.addresses(),
+	}
+}
+
+func (p *ContactRequestPayload) profile() repository.ContactProfile {
+	return repository.ContactProfile{
+		GivenName:   p.GivenName,
+		FamilyName:  p.FamilyName,
+		DisplayName: p.DisplayName,
+		Nickname:    p.Nickname,
+		Company:     p.Company,
+		JobTitle:    p.JobTitle,
+		Notes:       p.Notes,
+	}
+}
+
+func (p *ContactRequestPayload) phones() []repository.ContactPhone {
+	phones := make([]repository.ContactPhone, 0, len(p.Phones))
+	for _, phone := range p.Phones {
+		phones = append(phones, repository.ContactPhone(phone))
+	}
+	return phones
+}
+
+func (p *ContactRequestPayload) emails() []repository.ContactEmail {
+	emails := make([]repository.ContactEmail, 0, len(p.Emails))
+	for _, email := range p.Emails {
+		emails = append(emails, repository.ContactEmail(email))
+	}
+	return emails
+}
+
+func (p *ContactRequestPayload) addresses() []repository.ContactAddress {
+	addresses := make([]repository.ContactAddress, 0, len(p.Addresses))
+	for _, address := range p.Addresses {
+		addresses = append(addresses, repository.ContactAddress(address))
+	}
+	return addresses
+}
+
+// response returns the payload as the contact with the given ID.
+func (p *ContactRequestPayload) response(contactID string) ContactResponse {
+	return ContactResponse{
+		ID:             contactID,
+		ContactProfile: p.profile(),
+		Phone:          p.Phone,
+		PhoneE164:      p.phoneE164(),
+		Street:         p.Street,
+		City:           p.City,
+		State:          p.State,
+		ZipCode:        p.ZipCode,
+		Country:        p.Country,
+		Phones:         p.phones(),
+		Emails:         p.emails(),
+		Addresses:      p.addresses(),
+	}
+}
+
+// contactPayload returns a stored contact as the payload that would replace
+// it with itself. Every list is non-nil.
+func contactPayload(contact *repository.ContactWithUserResponse) ContactRequestPayload {
+	payload := ContactRequestPayload{
+		GivenName:   contact.GivenName,
+		FamilyName:  contact.FamilyName,
+		DisplayName: contact.DisplayName,
+		Nickname:    contact.Nickname,
+		Company:     contact.Company,
+		JobTitle:    contact.JobTitle,
+		Notes:       contact.Notes,
+		Phone:       contact.Phone,
+		Street:      contact.Street,
+		City:        contact.City,
+		State:       contact.State,
+		ZipCode:     contact.ZipCode,
+		Country:     contact.Country,
+		Phones:      make([]PhonePayload, 0, len(contact.Phones)),
+		Emails:      make([]EmailPayload, 0, len(contact.Emails)),
+		Addresses:   make([]AddressPayload, 0, len(contact.Addresses)),
+	}
+	for _, phone := range contact.Phones {
+		payload.Phones = append(payload.Phones, PhonePayload(phone))
+	}
+	for _, email := range contact.Emails {
+		payload.Emails = append(payload.Emails, EmailPayload(email))
+	}
+	for _, address := range contact.Addresses {
+		payload.Addresses = append(payload.Addresses, AddressPayload(address))
+	}
+	return payload
+}
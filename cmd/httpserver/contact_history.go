@@ -0,0 +1,217 @@
+package httpserver
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FieldChange is the old and new value of one field changed by a revision.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+type ContactRevisionResponse struct {
+	Revision  int           `json:"revision"`
+	Operation string        `json:"operation"`
+	ChangedBy string        `json:"changed_by"`
+	ChangedAt time.Time     `json:"changed_at"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// HandlerGetContactHistory lists the revisions of a contact, oldest first, each
+// with the fields it changed compared to the revision before it.
+func HandlerGetContactHistory(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		contactID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing contact ID",
+			})
+			_ = InvalidId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		revisions, err := app.Repository.GetContactRevisions(ctx, userID, contactID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching contact history",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		response := make([]ContactRevisionResponse, 0, len(revisions))
+		var previous map[string]any
+		for _, revision := range revisions {
+			response = append(response, ContactRevisionResponse{
+				Revision:  revision.Revision,
+				Operation: revision.Operation,
+				ChangedBy: revision.ChangedBy.String(),
+				ChangedAt: revision.ChangedAt,
+				Changes:   revisionChanges(previous, revision.Data),
+			})
+			previous = revision.Data
+		}
+
+		_ = ContactHistoryRetrieved.WriteToResponse(w, response)
+	}
+}
+
+// revisionChanges returns the fields whose value differs between two
+// revisions, sorted by name. previous is nil for the first revision.
+func revisionChanges(previous, current map[string]any) []FieldChange {
+	fields := make(map[string]bool, len(current))
+	for field := range previous {
+		fields[field] = true
+	}
+	for field := range current {
+		fields[field] = true
+	}
+
+	changes := []FieldChange{}
+	for field := range fields {
+		if !reflect.DeepEqual(previous[field], current[field]) {
+			changes = append(changes, FieldChange{Field: field, Old: previous[field], New: current[field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// HandlerRevertContactByID sets the fields of a contact back to their value at
+// ?revision=N. Fields the revision does not record are left as they are. The revert is a new revision itself, so it can be undone too.
+func HandlerRevertContactByID(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		contactID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing contact ID",
+			})
+			_ = InvalidId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		revisionNumber, err := strconv.Atoi(req.URL.Query().Get("revision"))
+		if err == nil && revisionNumber < 1 {
+			err = fmt.Errorf("revision %d out of range", revisionNumber)
+		}
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid revision",
+			})
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
+		}
+
+		contact, err := app.Repository.GetContactByID(ctx, userID, contactID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching contact",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		ifMatch := req.Header.Get("If-Match")
+		if ifMatch != "" && !etagMatches(ifMatch, versionETag(contact.Version), false) {
+			app.Logger.PrintError(repository.ErrPreconditionFailed, map[string]string{
+				"context": "If-Match does not match the contact",
+			})
+			_ = PreconditionFailed.WriteProblem(w, req, nil)
+			return
+		}
+
+		revision, err := app.Repository.GetContactRevision(ctx, userID, contactID, revisionNumber)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching contact revision",
+			})
+			_ = repositoryErrorResponse(err, RevisionNotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		document := newContactDocument(contactPayload(contact))
+		blank := blankContactDocument()
+		touched := make(map[string]bool, len(document))
+		for field := range document {
+			value, ok := revision.Data[field]
+			if !ok {
+				// Revisions only record the fields contacts had when they
+				// were taken, so newer fields are left as they are.
+				continue
+			}
+			if value == nil {
+				value = blank[field]
+			}
+			document[field] = value
+			touched[field] = true
+		}
+
+		// The revision holds values the contact was stored with, which are not
+		// validated again.
+		payload, err := document.payload()
+		if err == nil {
+			err = payload.syncAndValidatePatch(newValidator(), app.Config.PhoneRegion, touched["phones"], touched["addresses"], nil)
+		}
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
+		}
+
+		patch := payload.contactPatch(touched)
+		patch.Version = contact.Version
+		err = app.Repository.PatchContactByID(ctx, userID, contactID, &patch)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error reverting contact",
+			})
+			response := repositoryErrorResponse(err, NotFound)
+			if errors.Is(err, repository.ErrPreconditionFailed) && ifMatch == "" {
+				response = Conflict
+			}
+			_ = response.WriteProblem(w, req, nil)
+			return
+		}
+
+		response := payload.response(contactID.String())
+
+		w.Header().Set("ETag", versionETag(patch.Version))
+		_ = ContactReverted.WriteToResponse(w, response)
+	}
+}
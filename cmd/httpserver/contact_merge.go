@@ -0,0 +1,415 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/phone"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// duplicatePairLimit bounds the matching pairs one duplicate listing clusters.
+const duplicatePairLimit = 1000
+
+// mergeAll is the choice that combines a list field from every merged contact.
+const mergeAll = "all"
+
+// DuplicateCluster is a group of contacts that are likely the same person,
+// joined by the matches between them.
+type DuplicateCluster struct {
+	Score    float64                     `json:"score"` // Best score of its matches
+	Contacts []ContactResponse           `json:"contacts"`
+	Matches  []repository.DuplicateMatch `json:"matches"`
+}
+
+type DuplicatesResponse struct {
+	Clusters []DuplicateCluster `json:"clusters"`
+}
+
+// MergeContactsPayload merges ContactIDs into SurvivorID. Fields picks, by
+// field name, the contact a field is taken from. Fields left out keep the
+// value of the survivor, or the first value of the merged contacts when the
+// survivor has none, and lists default to "all": the entries of every
+// contact, without repeats.
+type MergeContactsPayload struct {
+	SurvivorID uuid.UUID         `json:"survivor_id" validate:"required"`
+	ContactIDs []uuid.UUID       `json:"contact_ids" validate:"required,min=1,max=10,unique"`
+	Fields     map[string]string `json:"fields"`
+}
+
+type ContactMergeResponse struct {
+	Merge   repository.ContactMerge `json:"merge"`
+	Contact ContactResponse         `json:"contact"`
+}
+
+// mergeScalarFields are the fields a merge takes from one of the contacts,
+// with the payload field each is kept in.
+var mergeScalarFields = map[string]func(p *ContactRequestPayload) *string{
+	"given_name":   func(p *ContactRequestPayload) *string { return &p.GivenName },
+	"family_name":  func(p *ContactRequestPayload) *string { return &p.FamilyName },
+	"display_name": func(p *ContactRequestPayload) *string { return &p.DisplayName },
+	"nickname":     func(p *ContactRequestPayload) *string { return &p.Nickname },
+	"company":      func(p *ContactRequestPayload) *string { return &p.Company },
+	"job_title":    func(p *ContactRequestPayload) *string { return &p.JobTitle },
+	"notes":        func(p *ContactRequestPayload) *string { return &p.Notes },
+}
+
+// mergeListFields are the fields a merge takes from one of the contacts or
+// combines from all of them. The flat phone and address follow the primary
+// entries of the lists.
+var mergeListFields = []string{"phones", "emails", "addresses"}
+
+// HandlerGetDuplicateContacts lists clusters of live contacts that are likely
+// duplicates, best first. The limit query parameter caps the clusters
+// returned, 20 by default and 100 at most.
+func HandlerGetDuplicateContacts(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		limit := 20
+		if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+			limit, err = strconv.Atoi(limitParam)
+			if err == nil && (limit < 1 || limit > 100) {
+				err = fmt.Errorf("limit %d out of range", limit)
+			}
+			if err != nil {
+				app.Logger.PrintError(err, map[string]string{
+					"context": "Invalid limit",
+				})
+				_ = BadRequestError.WriteProblem(w, req, nil)
+				return
+			}
+		}
+
+		matches, err := app.Repository.FindDuplicateContacts(ctx, userID, duplicatePairLimit)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error finding duplicate contacts",
+			})
+			_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+			return
+		}
+
+		clusters, ids := clusterDuplicates(matches, limit)
+		contacts := map[uuid.UUID]ContactResponse{}
+		if len(ids) > 0 {
+			found, err := app.Repository.GetAllContacts(ctx, userID, repository.ContactFilter{IDs: ids}, len(ids), 0)
+			if err != nil {
+				app.Logger.PrintError(err, map[string]string{
+					"context": "Error fetching duplicate contacts",
+				})
+				_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+				return
+			}
+			for i, contact := range contactResponses(found) {
+				contacts[found[i].ID] = contact
+			}
+		}
+
+		response := DuplicatesResponse{Clusters: []DuplicateCluster{}}
+		for _, cluster := range clusters {
+			for _, id := range cluster.ids {
+				// A contact deleted since the matches were found drops out.
+				if contact, ok := contacts[id]; ok {
+					cluster.Contacts = append(cluster.Contacts, contact)
+				}
+			}
+			if len(cluster.Contacts) > 1 {
+				response.Clusters = append(response.Clusters, cluster.DuplicateCluster)
+			}
+		}
+
+		_ = DuplicatesRetrieved.WriteToResponse(w, response)
+	}
+}
+
+// duplicateCluster is a DuplicateCluster before its contacts are read.
+type duplicateCluster struct {
+	DuplicateCluster
+	ids []uuid.UUID
+}
+
+// clusterDuplicates joins contacts that match, directly or through other
+// contacts, into clusters. It returns the best limit clusters and the IDs of
+// the contacts in them.
+func clusterDuplicates(matches []repository.DuplicateMatch, limit int) ([]duplicateCluster, []uuid.UUID) {
+	parent := map[uuid.UUID]uuid.UUID{}
+	var root func(id uuid.UUID) uuid.UUID
+	root = func(id uuid.UUID) uuid.UUID {
+		if p, ok := parent[id]; ok && p != id {
+			parent[id] = root(p)
+			return parent[id]
+		}
+		parent[id] = id
+		return id
+	}
+	for _, match := range matches {
+		a, b := root(match.ContactIDs[0]), root(match.ContactIDs[1])
+		if a != b {
+			parent[b] = a
+		}
+	}
+
+	// Matches come best first, so the first match of a cluster has its score
+	// and the clusters come out in order.
+	var clusters []*duplicateCluster
+	byRoot := map[uuid.UUID]*duplicateCluster{}
+	for _, match := range matches {
+		r := root(match.ContactIDs[0])
+		cluster, ok := byRoot[r]
+		if !ok {
+			cluster = &duplicateCluster{DuplicateCluster: DuplicateCluster{Score: match.Score}}
+			byRoot[r] = cluster
+			clusters = append(clusters, cluster)
+		}
+		cluster.Matches = append(cluster.Matches, match)
+		for _, id := range match.ContactIDs {
+			if !slices.Contains(cluster.ids, id) {
+				cluster.ids = append(cluster.ids, id)
+			}
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Score > clusters[j].Score })
+
+	if len(clusters) > limit {
+		clusters = clusters[:limit]
+	}
+	result := make([]duplicateCluster, 0, len(clusters))
+	var ids []uuid.UUID
+	for _, cluster := range clusters {
+		result = append(result, *cluster)
+		ids = append(ids, cluster.ids...)
+	}
+	return result, ids
+}
+
+// HandlerMergeContacts merges contacts into a survivor in one transaction:
+// the survivor takes the chosen fields and the tags of the others, which are
+// moved to the trash, and the merge is recorded. The revisions it writes are
+// marked as a merge in the history of every contact involved.
+func HandlerMergeContacts(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		var payload MergeContactsPayload
+		if err = json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid JSON",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
+		}
+		if err = newValidator().Struct(payload); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
+		}
+		if slices.Contains(payload.ContactIDs, payload.SurvivorID) {
+			app.Logger.PrintError(errors.New("survivor is merged into itself"), map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, []FieldError{{Field: "contact_ids", Message: "must not include the survivor"}})
+			return
+		}
+
+		ids := append([]uuid.UUID{payload.SurvivorID}, payload.ContactIDs...)
+		contacts := make([]*repository.ContactWithUserResponse, 0, len(ids))
+		for _, id := range ids {
+			contact, err := app.Repository.GetContactByID(ctx, userID, id)
+			if err != nil {
+				app.Logger.PrintError(err, map[string]string{
+					"context": "Error fetching contact",
+				})
+				_ = repositoryErrorResponse(err, MergeTargetsNotFound).WriteProblem(w, req, nil)
+				return
+			}
+			contacts = append(contacts, contact)
+		}
+
+		merged, fields, fieldErrs := mergeContactPayloads(contacts, payload.Fields)
+		if len(fieldErrs) > 0 {
+			app.Logger.PrintError(errors.New("invalid merge fields"), map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrs)
+			return
+		}
+		// Every merged value comes from a stored contact, so none is
+		// validated again.
+		if err = merged.syncAndValidatePatch(newValidator(), app.Config.PhoneRegion, true, true, nil); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid merged contact",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
+		}
+
+		touched := make(map[string]bool)
+		for field := range blankContactDocument() {
+			touched[field] = true
+		}
+		patch := merged.contactPatch(touched)
+		patch.Version = contacts[0].Version
+
+		mergedVersions := make([]int, 0, len(payload.ContactIDs))
+		for _, contact := range contacts[1:] {
+			mergedVersions = append(mergedVersions, contact.Version)
+		}
+		merge := repository.ContactMerge{
+			UserID:     userID,
+			SurvivorID: payload.SurvivorID,
+			MergedIDs:  payload.ContactIDs,
+			Fields:     fields,
+		}
+		if err = app.Repository.MergeContacts(ctx, &merge, &patch, mergedVersions); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error merging contacts",
+			})
+			response := repositoryErrorResponse(err, MergeTargetsNotFound)
+			if errors.Is(err, repository.ErrPreconditionFailed) {
+				response = Conflict
+			}
+			_ = response.WriteProblem(w, req, nil)
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(patch.Version))
+		_ = ContactsMerged.WriteToResponse(w, ContactMergeResponse{
+			Merge:   merge,
+			Contact: merged.response(payload.SurvivorID.String()),
+		})
+	}
+}
+
+// mergeContactPayloads builds the survivor of a merge from contacts, the
+// survivor first, taking each field from the contact choices names. It
+// returns the payload, the contact every field was taken from, and the
+// choices that name an unknown field or contact.
+func mergeContactPayloads(contacts []*repository.ContactWithUserResponse, choices map[string]string) (ContactRequestPayload, map[string]string, []FieldError) {
+	payloads := make(map[string]ContactRequestPayload, len(contacts))
+	order := make([]string, 0, len(contacts))
+	for _, contact := range contacts {
+		id := contact.ContactID.String()
+		payloads[id] = contactPayload(contact)
+		order = append(order, id)
+	}
+
+	var fieldErrs []FieldError
+	for field, choice := range choices {
+		_, scalar := mergeScalarFields[field]
+		list := slices.Contains(mergeListFields, field)
+		_, known := payloads[strings.ToLower(choice)]
+		switch {
+		case !scalar && !list:
+			fieldErrs = append(fieldErrs, FieldError{Field: "fields." + field, Message: "is not a field that can be merged"})
+		case !known && !(list && choice == mergeAll):
+			message := "must be the survivor or one of contact_ids"
+			if list {
+				message += `, or "all"`
+			}
+			fieldErrs = append(fieldErrs, FieldError{Field: "fields." + field, Message: message})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		sort.Slice(fieldErrs, func(i, j int) bool { return fieldErrs[i].Field < fieldErrs[j].Field })
+		return ContactRequestPayload{}, nil, fieldErrs
+	}
+
+	merged := payloads[order[0]]
+	fields := make(map[string]string, len(mergeScalarFields)+len(mergeListFields))
+	for field, value := range mergeScalarFields {
+		from, ok := choices[field]
+		if !ok {
+			from = order[0]
+			for _, id := range order {
+				if p := payloads[id]; *value(&p) != "" {
+					from = id
+					break
+				}
+			}
+		}
+		from = strings.ToLower(from)
+		source := payloads[from]
+		*value(&merged) = *value(&source)
+		fields[field] = from
+	}
+
+	for _, field := range mergeListFields {
+		from := strings.ToLower(choices[field])
+		if from == "" {
+			from = mergeAll
+		}
+		sources := order
+		if from != mergeAll {
+			sources = []string{from}
+		}
+		var phones []PhonePayload
+		var emails []EmailPayload
+		var addresses []AddressPayload
+		for _, id := range sources {
+			source := payloads[id]
+			phones = append(phones, source.Phones...)
+			emails = append(emails, source.Emails...)
+			addresses = append(addresses, source.Addresses...)
+		}
+		switch field {
+		case "phones":
+			merged.Phones = uniqueEntries(phones, func(p PhonePayload) string {
+				if p.E164 != "" {
+					return p.E164
+				}
+				return phone.Digits(p.Number)
+			})
+		case "emails":
+			merged.Emails = uniqueEntries(emails, func(e EmailPayload) string { return strings.ToLower(e.Address) })
+		case "addresses":
+			merged.Addresses = uniqueEntries(addresses, func(a AddressPayload) string {
+				return strings.ToLower(strings.Join([]string{a.Street, a.City, a.State, a.ZipCode, a.Country}, "\x00"))
+			})
+		}
+		fields[field] = from
+	}
+	return merged, fields, nil
+}
+
+// uniqueEntries returns entries without the ones whose key an earlier entry
+// has, so the survivor's entries, and its primary entry, win. The result is
+// never nil, so the merged list replaces the stored one.
+func uniqueEntries[T any](entries []T, key func(T) string) []T {
+	result := make([]T, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if k := key(entry); !seen[k] {
+			seen[k] = true
+			result = append(result, entry)
+		}
+	}
+	return result
+}
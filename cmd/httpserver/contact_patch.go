@@ -0,0 +1,384 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Media types accepted by PATCH, advertised in the Accept-Patch header.
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+	acceptPatch         = mergePatchMediaType + ", " + jsonPatchMediaType
+)
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation does not
+// match the contact.
+var errPatchTestFailed = errors.New("patch test failed")
+
+// errNoSuchMember is returned for a JSON Pointer to a value that is not there.
+var errNoSuchMember = errors.New("does not exist")
+
+// patchError rejects a patch that cannot be applied to a contact.
+type patchError FieldError
+
+func (e *patchError) Error() string {
+	return fmt.Sprintf("invalid patch: %s %s", e.Field, e.Message)
+}
+
+// contactDocument is a contact as PATCH sees it: a ContactRequestPayload as
+// plain JSON values, keyed by field name. Every field is always present;
+// clearing a field sets it to "" or to an empty list.
+type contactDocument map[string]any
+
+func newContactDocument(payload ContactRequestPayload) contactDocument {
+	raw, _ := json.Marshal(payload)
+	var doc contactDocument
+	_ = json.Unmarshal(raw, &doc)
+	return doc
+}
+
+// blankContactDocument returns the document of a contact with every field
+// cleared, which is what null or removing a field sets it to.
+func blankContactDocument() contactDocument {
+	return newContactDocument(ContactRequestPayload{Phones: []PhonePayload{}, Emails: []EmailPayload{}, Addresses: []AddressPayload{}})
+}
+
+// payload decodes the document for validation against the create rules.
+func (doc contactDocument) payload() (ContactRequestPayload, error) {
+	var payload ContactRequestPayload
+	raw, err := json.Marshal(doc)
+	if err == nil {
+		err = json.Unmarshal(raw, &payload)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return payload, &patchError{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)}
+	}
+	return payload, err
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string or null"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
+
+// contactPatch returns a ContactPatch that writes the touched fields, after
+// syncPrimary has run with the same touched fields. Touching a list writes
+// the flat fields mirroring its primary entry and the other way round.
+func (p *ContactRequestPayload) contactPatch(touched map[string]bool) repository.ContactPatch {
+	touchedAddress := touched["addresses"]
+	for _, name := range addressFields {
+		touchedAddress = touchedAddress || touched[name]
+	}
+	field := func(name string, value string, list string) *string {
+		if !touched[name] && !touched[list] {
+			return nil
+		}
+		return &value
+	}
+
+	patch := repository.ContactPatch{
+		GivenName:   field("given_name", p.GivenName, ""),
+		FamilyName:  field("family_name", p.FamilyName, ""),
+		DisplayName: field("display_name", p.DisplayName, ""),
+		Nickname:    field("nickname", p.Nickname, ""),
+		Company:     field("company", p.Company, ""),
+		JobTitle:    field("job_title", p.JobTitle, ""),
+		Notes:       field("notes", p.Notes, ""),
+		Phone:       field("phone", p.Phone, "phones"),
+		PhoneE164:   field("phone", p.phoneE164(), "phones"),
+		Street:      field("street", p.Street, "addresses"),
+		City:        field("city", p.City, "addresses"),
+		State:       field("state", p.State, "addresses"),
+		ZipCode:     field("zip_code", p.ZipCode, "addresses"),
+		Country:     field("country", p.Country, "addresses"),
+	}
+	if touched["phone"] || touched["phones"] {
+		patch.Phones = p.phones()
+	}
+	if touched["emails"] {
+		patch.Emails = p.emails()
+	}
+	if touchedAddress {
+		patch.Addresses = p.addresses()
+	}
+	return patch
+}
+
+// applyMergePatch applies an RFC 7396 JSON Merge Patch to doc and returns the
+// fields it touched. null clears a field, omitted fields are left alone and
+// lists are replaced as a whole. Unknown members are ignored, as they always
+// were.
+func applyMergePatch(doc contactDocument, body []byte) (map[string]bool, error) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		return nil, &patchError{Message: "must be a JSON object"}
+	}
+
+	blank := blankContactDocument()
+	touched := make(map[string]bool)
+	for name, raw := range patch {
+		if _, ok := blank[name]; !ok {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			value = blank[name]
+		}
+		doc[name] = value
+		touched[name] = true
+	}
+	return touched, nil
+}
+
+// patchOperation is one operation of an RFC 6902 JSON Patch.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// pointerTokens splits a JSON Pointer into its reference tokens, the first of
+// which names a contact field.
+func pointerTokens(pointer string) ([]string, error) {
+	if rest, ok := strings.CutPrefix(pointer, "/"); ok {
+		tokens := strings.Split(rest, "/")
+		for i, token := range tokens {
+			tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		}
+		if _, ok = blankContactDocument()[tokens[0]]; ok {
+			return tokens, nil
+		}
+	}
+	return nil, &patchError{Field: pointer, Message: "is not a contact field"}
+}
+
+// arrayIndex parses the token of a list element. "-" is the index just past
+// the last element, where "add" appends.
+func arrayIndex(token string, length int) (int, bool) {
+	if token == "-" {
+		return length, true
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	return i, err == nil && i <= length
+}
+
+// child returns the member or element of node named by token.
+func child(node any, token string) (any, error) {
+	switch parent := node.(type) {
+	case map[string]any:
+		if value, ok := parent[token]; ok {
+			return value, nil
+		}
+	case []any:
+		if i, ok := arrayIndex(token, len(parent)); ok && i < len(parent) {
+			return parent[i], nil
+		}
+	}
+	return nil, errNoSuchMember
+}
+
+// valueAt returns the value a pointer refers to.
+func valueAt(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		var err error
+		if node, err = child(node, token); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// changeAt calls change with the container holding the value a pointer refers
+// to and the last token, and returns node with the container change returned
+// in its place, since inserting into or deleting from a list may give a new
+// slice.
+func changeAt(node any, tokens []string, change func(parent any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return change(node, tokens[0])
+	}
+	value, err := child(node, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	if value, err = changeAt(value, tokens[1:], change); err != nil {
+		return nil, err
+	}
+	switch parent := node.(type) {
+	case map[string]any:
+		parent[tokens[0]] = value
+	case []any:
+		i, _ := arrayIndex(tokens[0], len(parent))
+		parent[i] = value
+	}
+	return node, nil
+}
+
+// addAt inserts value into a list, or sets an object member.
+func addAt(doc contactDocument, tokens []string, value any) error {
+	_, err := changeAt(map[string]any(doc), tokens, func(node any, token string) (any, error) {
+		switch parent := node.(type) {
+		case map[string]any:
+			parent[token] = value
+			return parent, nil
+		case []any:
+			if i, ok := arrayIndex(token, len(parent)); ok {
+				return slices.Insert(parent, i, value), nil
+			}
+		}
+		return nil, errNoSuchMember
+	})
+	return err
+}
+
+// replaceAt sets the existing value a pointer refers to.
+func replaceAt(doc contactDocument, tokens []string, value any) error {
+	_, err := changeAt(map[string]any(doc), tokens, func(node any, token string) (any, error) {
+		switch parent := node.(type) {
+		case map[string]any:
+			if _, ok := parent[token]; ok {
+				parent[token] = value
+				return parent, nil
+			}
+		case []any:
+			if i, ok := arrayIndex(token, len(parent)); ok && i < len(parent) {
+				parent[i] = value
+				return parent, nil
+			}
+		}
+		return nil, errNoSuchMember
+	})
+	return err
+}
+
+// removeAt removes the value a pointer refers to and returns it. Contact
+// fields themselves cannot be removed, so they are cleared instead.
+func removeAt(doc contactDocument, tokens []string) (any, error) {
+	removed, err := valueAt(map[string]any(doc), tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		doc[tokens[0]] = blankContactDocument()[tokens[0]]
+		return removed, nil
+	}
+	_, err = changeAt(map[string]any(doc), tokens, func(node any, token string) (any, error) {
+		switch parent := node.(type) {
+		case map[string]any:
+			delete(parent, token)
+			return parent, nil
+		case []any:
+			i, _ := arrayIndex(token, len(parent))
+			return slices.Delete(parent, i, i+1), nil
+		}
+		return nil, errNoSuchMember
+	})
+	return removed, err
+}
+
+// cloneValue copies a JSON value, so a copied list entry is not shared.
+func cloneValue(value any) any {
+	raw, _ := json.Marshal(value)
+	var clone any
+	_ = json.Unmarshal(raw, &clone)
+	return clone
+}
+
+// applyJSONPatch applies an RFC 6902 JSON Patch to doc and returns the fields
+// it touched. Paths may point into the lists, such as /phones/0/number or
+// /emails/- to append. Contact fields cannot be removed from the document, so
+// "remove" clears them like a null value does.
+func applyJSONPatch(doc contactDocument, body []byte) (map[string]bool, error) {
+	var operations []patchOperation
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return nil, err
+	}
+
+	touched := make(map[string]bool)
+	for _, operation := range operations {
+		path, err := pointerTokens(operation.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		switch operation.Op {
+		case "add", "replace", "test":
+			if operation.Value == nil {
+				return nil, &patchError{Field: operation.Path, Message: "requires a value"}
+			}
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return nil, err
+			}
+			if value == nil && len(path) == 1 {
+				value = blankContactDocument()[path[0]]
+			}
+		case "move", "copy":
+			from, err := pointerTokens(operation.From)
+			if err != nil {
+				return nil, err
+			}
+			if operation.Op == "move" {
+				if strings.HasPrefix(operation.Path, operation.From+"/") {
+					return nil, &patchError{Field: operation.Path, Message: "cannot be moved into itself"}
+				}
+				value, err = removeAt(doc, from)
+				touched[from[0]] = true
+			} else {
+				value, err = valueAt(map[string]any(doc), from)
+				value = cloneValue(value)
+			}
+			if err != nil {
+				return nil, &patchError{Field: operation.From, Message: err.Error()}
+			}
+		case "remove":
+		default:
+			return nil, &patchError{Field: operation.Path, Message: fmt.Sprintf("has unknown operation %q", operation.Op)}
+		}
+
+		switch operation.Op {
+		case "test":
+			current, err := valueAt(map[string]any(doc), path)
+			if err != nil || !reflect.DeepEqual(current, value) {
+				return nil, errors.Wrapf(errPatchTestFailed, "%s is not %s", operation.Path, operation.Value)
+			}
+			continue
+		case "add", "move", "copy":
+			err = addAt(doc, path, value)
+		case "replace":
+			err = replaceAt(doc, path, value)
+		case "remove":
+			_, err = removeAt(doc, path)
+		}
+		if err != nil {
+			return nil, &patchError{Field: operation.Path, Message: err.Error()}
+		}
+		touched[path[0]] = true
+	}
+	return touched, nil
+}
@@ -0,0 +1,135 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"time"
+)
+
+// purgeBatchSize bounds the contacts one purge statement deletes, so the purger
+// never holds locks on a large part of the table.
+const purgeBatchSize = 500
+
+// HandlerGetContactTrash lists the contacts in the trash, most recently deleted
+// first. It takes the same search, filter and paging parameters as the
+// contact list, except for cursors.
+func HandlerGetContactTrash(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		filter, err := contactFilterFromQuery(req.URL.Query())
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "contact filter",
+			})
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
+		}
+		filter.Deleted = true
+		if len(filter.Sort) == 0 && filter.Query == "" {
+			filter.Sort = []repository.ContactSort{{Field: "deleted_at", Desc: true}}
+		}
+
+		listContactsByOffset(app, w, req, userID, filter)
+	}
+}
+
+// HandlerRestoreContactByID moves a contact out of the trash and returns it.
+func HandlerRestoreContactByID(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		contactID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing contact ID",
+			})
+			_ = InvalidId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		var contact *repository.ContactWithUserResponse
+		err = app.Repository.InTx(ctx, func(ctx context.Context) error {
+			if err := app.Repository.RestoreContactByID(ctx, userID, contactID); err != nil {
+				return err
+			}
+			contact, err = app.Repository.GetContactByID(ctx, userID, contactID)
+			return err
+		})
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error restoring contact",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(contact.Version))
+		_ = ContactRestored.WriteToResponse(w, contact)
+	}
+}
+
+// PurgeDeletedContacts permanently deletes the contacts that have been in the
+// trash for longer than Config.TrashRetention and returns how many it deleted.
+func PurgeDeletedContacts(ctx context.Context, app *state.State) (int64, error) {
+	deletedBefore := time.Now().Add(-app.Config.TrashRetention)
+
+	var total int64
+	for {
+		purged, err := app.Repository.PurgeDeletedContacts(ctx, deletedBefore, purgeBatchSize)
+		total += purged
+		if err != nil || purged < purgeBatchSize {
+			return total, err
+		}
+	}
+}
+
+// runTrashPurger calls PurgeDeletedContacts every Config.TrashPurgeEvery until
+// ctx is cancelled.
+func runTrashPurger(ctx context.Context, app *state.State) {
+	ticker := time.NewTicker(app.Config.TrashPurgeEvery)
+	defer ticker.Stop()
+
+	for {
+		purged, err := PurgeDeletedContacts(ctx, app)
+		if err != nil && ctx.Err() == nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "purging deleted contacts",
+			})
+		}
+		if purged > 0 {
+			app.Logger.PrintInfo("purged deleted contacts", map[string]string{
+				"count": fmt.Sprint(purged),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package httpserver
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// csvColumn binds a ContactRequestPayload field to the CSV headers that can
+// carry it. Headers are compared after normalizeHeader.
+type csvColumn struct {
+	field   string
+	aliases []string
+	set     func(*ContactRequestPayload, string)
+}
+
+var csvColumns = []csvColumn{
+	{"given_name", []string{"firstname", "first", "givenname", "forename"}, func(p *ContactRequestPayload, v string) { p.GivenName = v }},
+	{"family_name", []string{"lastname", "last", "surname", "familyname"}, func(p *ContactRequestPayload, v string) { p.FamilyName = v }},
+	{"display_name", []string{"name", "fullname", "displayname"}, func(p *ContactRequestPayload, v string) { p.DisplayName = v }},
+	{"nickname", []string{"nick"}, func(p *ContactRequestPayload, v string) { p.Nickname = v }},
+	{"company", []string{"organization", "organisation", "org", "companyname"}, func(p *ContactRequestPayload, v string) { p.Company = v }},
+	{"job_title", []string{"title", "jobtitle", "position", "role"}, func(p *ContactRequestPayload, v string) { p.JobTitle = v }},
+	{"phone", []string{"telephone", "tel", "phonenumber", "mobile"}, func(p *ContactRequestPayload, v string) { p.Phone = v }},
+	{"street", []string{"address", "streetaddress", "address1"}, func(p *ContactRequestPayload, v string) { p.Street = v }},
+	{"city", []string{"town", "locality"}, func(p *ContactRequestPayload, v string) { p.City = v }},
+	{"state", []string{"province", "region"}, func(p *ContactRequestPayload, v string) { p.State = v }},
+	{"zip_code", []string{"zip", "zipcode", "postalcode", "postcode"}, func(p *ContactRequestPayload, v string) { p.ZipCode = v }},
+	{"country", []string{"countrycode", "nation"}, func(p *ContactRequestPayload, v string) { p.Country = v }},
+	{"notes", []string{"note", "comments", "comment"}, func(p *ContactRequestPayload, v string) { p.Notes = v }},
+}
+
+var csvExportHeader = []string{
+	"id", "given_name", "family_name", "display_name", "nickname", "company", "job_title",
+	"phone", "street", "city", "state", "zip_code", "country", "notes", "created_at", "updated_at",
+}
+
+// csvImportRows reads the header row, maps it to contact fields and returns
+// the remaining rows. Columns can be mapped explicitly with query parameters
+// such as ?map.phone=Mobile+Number; unknown columns are ignored.
+func csvImportRows(body io.Reader, query url.Values) (importRows, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: missing header row", errInvalidImport)
+	}
+	if err != nil {
+		return nil, wrapCSVError(err)
+	}
+
+	setters, err := mapCSVHeader(header, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (*importRow, error) {
+		record, err := reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &importRow{line: parseErr.StartLine, errs: []FieldError{{Message: parseErr.Err.Error()}}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := &importRow{}
+		row.line, _ = reader.FieldPos(0)
+		for i, value := range record {
+			if i < len(setters) && setters[i] != nil {
+				setters[i](&row.payload, strings.TrimSpace(value))
+			}
+		}
+		return row, nil
+	}, nil
+}
+
+// mapCSVHeader returns, for each column of the header, the setter of the
+// contact field it holds, or nil for columns that are not imported.
+func mapCSVHeader(header []string, query url.Values) ([]func(*ContactRequestPayload, string), error) {
+	setters := make([]func(*ContactRequestPayload, string), len(header))
+	mapped := 0
+
+	for _, column := range csvColumns {
+		names := append([]string{column.field}, column.aliases...)
+		if explicit := query.Get("map." + column.field); explicit != "" {
+			names = []string{explicit}
+		}
+
+		for i, name := range header {
+			if setters[i] == nil && matchesHeader(name, names) {
+				setters[i] = column.set
+				mapped++
+				break
+			}
+		}
+	}
+
+	if mapped == 0 {
+		return nil, fmt.Errorf("%w: no column of the header maps to a contact field", errInvalidImport)
+	}
+	return setters, nil
+}
+
+func matchesHeader(header string, names []string) bool {
+	header = normalizeHeader(header)
+	for _, name := range names {
+		if header == normalizeHeader(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHeader folds case and drops separators, so "Zip Code", "zip_code"
+// and "ZIP-CODE" all compare equal.
+func normalizeHeader(header string) string {
+	header = strings.TrimPrefix(header, "\ufeff")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-', '.':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(header)))
+}
+
+func wrapCSVError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: %v", errInvalidImport, err)
+	}
+	return err
+}
+
+func csvExport(w http.ResponseWriter) exportFormat {
+	writer := csv.NewWriter(w)
+	return exportFormat{
+		contentType: "text/csv; charset=utf-8",
+		filename:    "contacts.csv",
+		begin: func() error {
+			return writer.Write(csvExportHeader)
+		},
+		write: func(contact *repository.Contact) error {
+			err := writer.Write([]string{
+				contact.ID.String(),
+				contact.GivenName,
+				contact.FamilyName,
+				contact.DisplayName,
+				contact.Nickname,
+				contact.Company,
+				contact.JobTitle,
+				contact.Phone,
+				contact.Street,
+				contact.City,
+				contact.State,
+				contact.ZipCode,
+				contact.Country,
+				contact.Notes,
+				contact.CreatedAt.UTC().Format(time.RFC3339),
+				contact.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+			if err != nil {
+				return err
+			}
+			return writer.Error()
+		},
+		flush: writer.Flush,
+	}
+}
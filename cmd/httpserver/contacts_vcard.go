@@ -0,0 +1,113 @@
+package httpserver
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"go_chi_pgx/vcard"
+	"io"
+	"net/http"
+)
+
+const vcardContentType = vcard.MediaType + "; charset=utf-8"
+
+// vcardImportRows returns one row per card. Malformed cards are reported as
+// failed rows and decoding carries on with the next card.
+func vcardImportRows(body io.Reader) importRows {
+	decoder := vcard.NewDecoder(body)
+	return func() (*importRow, error) {
+		card, err := decoder.Decode()
+		var parseErr *vcard.ParseError
+		if errors.As(err, &parseErr) {
+			return &importRow{line: parseErr.Line, errs: []FieldError{{Message: parseErr.Msg}}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &importRow{line: card.Line, payload: vcardPayload(card)}, nil
+	}
+}
+
+// vcardPayload maps a card onto the payload that creates or replaces the
+// contact it describes, still to be checked with syncAndValidateSynced.
+func vcardPayload(card *vcard.Card) ContactRequestPayload {
+	contact := vcard.ToContact(card)
+	payload := contactPayload(&repository.ContactWithUserResponse{
+		ContactProfile: contact.ContactProfile,
+		Phone:          contact.Phone,
+		Street:         contact.Street,
+		City:           contact.City,
+		State:          contact.State,
+		ZipCode:        contact.ZipCode,
+		Country:        contact.Country,
+		Phones:         contact.Phones,
+		Emails:         contact.Emails,
+		Addresses:      contact.Addresses,
+	})
+	return payload
+}
+
+func vcardExport(w http.ResponseWriter, version string) exportFormat {
+	encoder := vcard.NewEncoder(w)
+	return exportFormat{
+		contentType: vcardContentType,
+		filename:    "contacts.vcf",
+		begin:       func() error { return nil },
+		write: func(contact *repository.Contact) error {
+			return encoder.Encode(vcard.FromContact(contact, version))
+		},
+		flush: func() {},
+	}
+}
+
+// HandlerGetContactVCard serves a single contact as a .vcf file.
+func HandlerGetContactVCard(app *state.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		contactID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing contact ID",
+			})
+			_ = InvalidId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		found, err := app.Repository.GetContactByID(ctx, userID, contactID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching contact",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		contact := repository.Contact{
+			ID:             found.ContactID,
+			ContactProfile: found.ContactProfile,
+			Phone:          found.Phone,
+			Street:         found.Street,
+			City:           found.City,
+			State:          found.State,
+			ZipCode:        found.ZipCode,
+			Country:        found.Country,
+			Phones:         found.Phones,
+			Emails:         found.Emails,
+			Addresses:      found.Addresses,
+		}
+		w.Header().Set("Content-Type", vcardContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+contact.ID.String()+`.vcf"`)
+		_ = vcard.NewEncoder(w).Encode(vcard.FromContact(&contact, req.URL.Query().Get("version")))
+	}
+}
@@ -3,18 +3,33 @@ package httpserver
 import (
 	"encoding/json"
 	"github.com/gofrs/uuid"
-	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	"net/http"
 )
 
 type ContactRequestPayload struct {
-	Phone   string `json:"phone" validate:"required"`
-	Street  string `json:"street"`
-	City    string `json:"city"`
-	State   string `json:"state"`
-	ZipCode string `json:"zip_code"`
-	Country string `json:"country"`
+	GivenName   string `json:"given_name" validate:"max=100"`
+	FamilyName  string `json:"family_name" validate:"max=100"`
+	DisplayName string `json:"display_name" validate:"max=200"`
+	Nickname    string `json:"nickname" validate:"max=100"`
+	Company     string `json:"company" validate:"max=200"`
+	JobTitle    string `json:"job_title" validate:"max=100"`
+	Notes       string `json:"notes" validate:"max=10000"`
+
+	Phone   string `json:"phone" validate:"required,max=20"`
+	Street  string `json:"street" validate:"max=100"`
+	City    string `json:"city" validate:"max=50"`
+	State   string `json:"state" validate:"max=50"`
+	ZipCode string `json:"zip_code" validate:"max=20"`
+	Country string `json:"country" validate:"max=50"`
+
+	// The flat fields above stay as the primary phone and address for
+	// clients that only know a single one.
+	Phones    []PhonePayload   `json:"phones" validate:"max=20,dive"`
+	Emails    []EmailPayload   `json:"emails" validate:"max=20,dive"`
+	Addresses []AddressPayload `json:"addresses" validate:"max=10,dive"`
+
+	phoneRegion string // Region the numbers were parsed for, set by normalizePhones
 }
 
 func HandlerCreateContact(app *state.State) http.HandlerFunc {
@@ -28,7 +43,15 @@ func HandlerCreateContact(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Invalid JSON",
 			})
-			_ = ValidDataNotFound.WriteToResponse(w, nil)
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
+		}
+
+		if err = requestPayload.syncAndValidateNew(newValidator(), app.Config.PhoneRegion); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
 			return
 		}
 
@@ -39,7 +62,7 @@ func HandlerCreateContact(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error parsing UUID",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 		ID, err := uuid.NewV4()
@@ -47,27 +70,19 @@ func HandlerCreateContact(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error generating UUID",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 		}
 
-		contact := repository.Contact{
-			ID:      ID,
-			UserID:  uuID,
-			Phone:   requestPayload.Phone,
-			Street:  requestPayload.Street,
-			City:    requestPayload.City,
-			State:   requestPayload.State,
-			ZipCode: requestPayload.ZipCode,
-			Country: requestPayload.Country,
-		}
+		contact := requestPayload.contact(ID, uuID)
 
 		if err = app.Repository.CreateContact(ctx, &contact); err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error creating contact",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
 			return
 		}
+		w.Header().Set("ETag", versionETag(contact.Version))
 		_ = ContactCreated.WriteToResponse(w, contact)
 
 		return
@@ -1,8 +1,6 @@
 package httpserver
 
 import (
-	"database/sql"
-	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/gofrs/uuid"
 	"go_chi_pgx/state"
@@ -19,26 +17,27 @@ func HandlerDeleteContactByID(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error parsing contact ID",
 			})
-			_ = InvalidId.WriteToResponse(w, nil)
+			_ = InvalidId.WriteProblem(w, req, nil)
 			return
 		}
 
 		ctx := req.Context()
-		err = app.Repository.DeleteContactByID(ctx, contactID)
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		err = app.Repository.DeleteContactByID(ctx, userID, contactID)
 
 		if err != nil {
-			if errors.Is(sql.ErrNoRows, err) {
-				app.Logger.PrintError(err, map[string]string{
-					"context": "Contact not found",
-				})
-				_ = NotFound.WriteToResponse(w, nil)
-
-			} else {
-				app.Logger.PrintError(err, map[string]string{
-					"context": "Error deleting contact",
-				})
-				_ = InternalError.WriteToResponse(w, nil)
-			}
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error deleting contact",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
 			return
 		}
 
@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"strconv"
+	"strings"
+)
+
+// versionETag formats a contact version as a strong entity tag.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagMatches reports whether header, the value of an If-Match or
+// If-None-Match header, is "*" or lists etag. If-Match compares strongly, so
+// weak tags never match it; If-None-Match passes weak to ignore the W/ prefix.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[len("W/"):]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
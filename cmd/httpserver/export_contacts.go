@@ -0,0 +1,105 @@
+package httpserver
+
+import (
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+)
+
+// exportFormat writes a stream of contacts in one file format. begin runs
+// before the first contact, or once for an empty export.
+type exportFormat struct {
+	contentType string
+	filename    string
+	begin       func() error
+	write       func(*repository.Contact) error
+	flush       func()
+}
+
+// HandlerExportContacts streams the user's contacts, narrowed by the same
+// filters as the list endpoint, as a file download. format is csv (default)
+// or vcard; vCards are written as version 3.0 unless ?version=4.0 is given.
+func HandlerExportContacts(app *state.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		filter, err := contactFilterFromQuery(req.URL.Query())
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "contact filter",
+			})
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
+		}
+
+		var format exportFormat
+		switch req.URL.Query().Get("format") {
+		case "", "csv":
+			format = csvExport(w)
+		case "vcard", "vcf":
+			format = vcardExport(w, req.URL.Query().Get("version"))
+		default:
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
+		}
+
+		if err = extendDeadlines(w); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error extending deadlines",
+			})
+		}
+
+		started := false
+		start := func() error {
+			started = true
+			w.Header().Set("Content-Type", format.contentType)
+			w.Header().Set("Content-Disposition", `attachment; filename="`+format.filename+`"`)
+			w.WriteHeader(http.StatusOK)
+			return format.begin()
+		}
+
+		rows := 0
+		err = app.Repository.StreamContacts(ctx, userID, filter, func(contact *repository.Contact) error {
+			if !started {
+				if err := start(); err != nil {
+					return err
+				}
+			}
+			if err := format.write(contact); err != nil {
+				return err
+			}
+			if rows++; rows%importBatchSize == 0 {
+				format.flush()
+				if flusher, ok := w.(http.Flusher); ok {
+					flusher.Flush()
+				}
+			}
+			return nil
+		})
+
+		// Once the first row is out the status is sent, so a later failure
+		// can only be logged and the download cut short.
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error exporting contacts",
+			})
+			if !started {
+				_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+			}
+			return
+		}
+
+		if !started {
+			_ = start()
+		}
+		format.flush()
+	}
+}
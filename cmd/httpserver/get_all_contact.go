@@ -3,28 +3,54 @@ package httpserver
 import (
 	"fmt"
 	"github.com/gofrs/uuid"
+	"go_chi_pgx/geo"
+	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type ContactResponse struct {
-	ID      string `json:"id"`
-	Phone   string `json:"phone"`
-	Street  string `json:"street"`
-	City    string `json:"city"`
-	State   string `json:"state"`
-	ZipCode string `json:"zip_code"`
-	Country string `json:"country"`
+	ID string `json:"id"`
+	repository.ContactProfile
+	Phone     string     `json:"phone"`
+	PhoneE164 string     `json:"phone_e164"`
+	Street    string     `json:"street"`
+	City      string     `json:"city"`
+	State     string     `json:"state"`
+	ZipCode   string     `json:"zip_code"`
+	Country   string     `json:"country"`
+	Score     float64    `json:"score,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	Phones    []repository.ContactPhone   `json:"phones,omitempty"`
+	Emails    []repository.ContactEmail   `json:"emails,omitempty"`
+	Addresses []repository.ContactAddress `json:"addresses,omitempty"`
 }
 
+// Pagination modes reported in ContactsResponse.Mode.
+const (
+	PaginationOffset = "offset"
+	PaginationCursor = "cursor"
+)
+
 type ContactsResponse struct {
+	Mode       string            `json:"mode"`
 	TotalCount int               `json:"total_count"`
+	Facets     ContactFacets     `json:"facets"`
 	Next       string            `json:"next"`
 	Previous   string            `json:"previous"`
 	Contacts   []ContactResponse `json:"contacts"`
 }
 
+// ContactFacets break the whole listing, not just the page, down by value.
+type ContactFacets struct {
+	Tags []repository.TagFacet `json:"tags"`
+}
+
 func HandlerGetAllContacts(app *state.State) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -36,103 +62,211 @@ func HandlerGetAllContacts(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"Context": "Error parsing UUID",
 			})
-			_ = InvalidUserId.WriteToResponse(w, nil)
+			_ = InvalidUserId.WriteProblem(w, req, nil)
 			return
 		}
 
-		limitParam := req.URL.Query().Get("limit")
-		offsetParam := req.URL.Query().Get("offset")
-
-		limit := 10
-		offset := 0
-		if limitParam != "" {
-			limit, err = strconv.Atoi(limitParam)
-			if err != nil {
-				app.Logger.PrintError(fmt.Errorf("invalid limit value"), map[string]string{
-					"context": "pagination",
-				})
-				_ = BadRequestError.WriteToResponse(w, nil)
-				return
-			}
+		filter, err := contactFilterFromQuery(req.URL.Query())
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "contact filter",
+			})
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
 		}
 
-		if offsetParam != "" {
-			offset, err = strconv.Atoi(offsetParam)
-			if err != nil {
-				app.Logger.PrintError(fmt.Errorf("invalid offset value"), map[string]string{
-					"context": "pagination",
-				})
-				_ = BadRequestError.WriteToResponse(w, nil)
-				return
-			}
+		// A cursor or page_size selects keyset pagination; limit and offset
+		// keep working for existing clients.
+		if req.URL.Query().Has("cursor") || req.URL.Query().Has("page_size") {
+			listContactsByCursor(app, w, req, uuID, filter)
+			return
 		}
 
-		contacts, err := app.Repository.GetAllContacts(ctx, uuID, limit, offset)
+		listContactsByOffset(app, w, req, uuID, filter)
+	}
+}
+
+// listContactsByOffset serves one page of a listing selected by the limit and
+// offset query parameters.
+func listContactsByOffset(app *state.State, w http.ResponseWriter, req *http.Request, userID uuid.UUID, filter repository.ContactFilter) {
+	ctx := req.Context()
+	var err error
+
+	limitParam := req.URL.Query().Get("limit")
+	offsetParam := req.URL.Query().Get("offset")
+
+	limit := 10
+	offset := 0
+	if limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
 		if err != nil {
-			app.Logger.PrintError(err, map[string]string{
-				"Context": "Error fetching contacts",
+			app.Logger.PrintError(fmt.Errorf("invalid limit value"), map[string]string{
+				"context": "pagination",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = BadRequestError.WriteProblem(w, req, nil)
 			return
 		}
+	}
 
-		totalCount, err := app.Repository.GetContactsCount(ctx, uuID)
+	if offsetParam != "" {
+		offset, err = strconv.Atoi(offsetParam)
 		if err != nil {
-			app.Logger.PrintError(err, map[string]string{
-				"Context": "Error fetching contacts count",
+			app.Logger.PrintError(fmt.Errorf("invalid offset value"), map[string]string{
+				"context": "pagination",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = BadRequestError.WriteProblem(w, req, nil)
 			return
 		}
-		scheme := req.Header.Get("X-Forwarded-Proto")
-		if scheme == "" {
-			scheme = "http"
-		}
+	}
 
-		// Generate next and previous URLs
-		baseURL := scheme + "://" + req.Host + req.URL.Path
-		nextOffset := offset + limit
-		prevOffset := offset - limit
-		if prevOffset < 0 {
-			prevOffset = 0
-		}
+	contacts, err := app.Repository.GetAllContacts(ctx, userID, filter, limit, offset)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"Context": "Error fetching contacts",
+		})
+		_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+		return
+	}
 
-		nextURL := ""
-		prevURL := ""
+	totalCount, err := app.Repository.GetContactsCount(ctx, userID, filter)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"Context": "Error fetching contacts count",
+		})
+		_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+		return
+	}
 
-		// Create next URL if more records are available
-		if nextOffset < totalCount {
-			nextURL = fmt.Sprintf("%s?limit=%d&offset=%d", baseURL, limit, nextOffset)
-		}
+	tagFacets, err := app.Repository.GetTagFacets(ctx, userID, filter)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"Context": "Error fetching tag facets",
+		})
+		_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+		return
+	}
 
-		// Create previous URL if offset is greater than 0
-		if offset > 0 {
-			prevURL = fmt.Sprintf("%s?limit=%d&offset=%d", baseURL, limit, prevOffset)
-		}
+	// Generate next and previous URLs
+	baseURL := requestBaseURL(req)
+	nextOffset := offset + limit
+	prevOffset := offset - limit
+	if prevOffset < 0 {
+		prevOffset = 0
+	}
 
-		// Create response
-		var contactResponses []ContactResponse
-		for _, contact := range contacts {
-			contactResponses = append(contactResponses, ContactResponse{
-				ID:      contact.ID.String(),
-				Phone:   contact.Phone,
-				Street:  contact.Street,
-				City:    contact.City,
-				State:   contact.State,
-				ZipCode: contact.ZipCode,
-				Country: contact.Country,
-			})
-		}
+	nextURL := ""
+	prevURL := ""
+
+	// Create next URL if more records are available
+	if nextOffset < totalCount {
+		nextURL = pageURL(baseURL, req.URL.Query(), limit, nextOffset)
+	}
+
+	// Create previous URL if offset is greater than 0
+	if offset > 0 {
+		prevURL = pageURL(baseURL, req.URL.Query(), limit, prevOffset)
+	}
+
+	// Create response
+	response := ContactsResponse{
+		Mode:       PaginationOffset,
+		Contacts:   contactResponses(contacts),
+		TotalCount: totalCount,
+		Facets:     ContactFacets{Tags: tagFacets},
+		Next:       nextURL,
+		Previous:   prevURL,
+	}
 
-		response := ContactsResponse{
-			Contacts:   contactResponses,
-			TotalCount: totalCount,
-			Next:       nextURL,
-			Previous:   prevURL,
+	_ = ContactRetrieved.WriteToResponse(w, response)
+}
+
+func contactResponses(contacts []repository.Contact) []ContactResponse {
+	var responses []ContactResponse
+	for _, contact := range contacts {
+		responses = append(responses, ContactResponse{
+			ID:             contact.ID.String(),
+			ContactProfile: contact.ContactProfile,
+			Phone:          contact.Phone,
+			PhoneE164:      contact.PhoneE164,
+			Street:         contact.Street,
+			City:           contact.City,
+			State:          contact.State,
+			ZipCode:        contact.ZipCode,
+			Country:        contact.Country,
+			Score:          contact.Score,
+			DeletedAt:      contact.DeletedAt,
+			Phones:         contact.Phones,
+			Emails:         contact.Emails,
+			Addresses:      contact.Addresses,
+		})
+	}
+	return responses
+}
+
+// requestBaseURL is the absolute URL of the request without its query string.
+func requestBaseURL(req *http.Request) string {
+	scheme := req.Header.Get("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + req.Host + req.URL.Path
+}
+
+// pageURL links to another page of the same listing, keeping every other
+// query parameter (search, filters) of the current request.
+func pageURL(baseURL string, query url.Values, limit, offset int) string {
+	query.Del("cursor")
+	query.Del("page_size")
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+	return baseURL + "?" + query.Encode()
+}
+
+// contactFilterFromQuery reads the search, filter and sort parameters of the
+// contact list endpoint. Dates are RFC 3339 timestamps or plain YYYY-MM-DD days.
+// tag may be repeated to list the contacts having every one of the tags.
+func contactFilterFromQuery(query url.Values) (repository.ContactFilter, error) {
+	filter := repository.ContactFilter{
+		Query:         strings.TrimSpace(query.Get("q")),
+		City:          strings.TrimSpace(query.Get("city")),
+		State:         strings.TrimSpace(query.Get("state")),
+		Country:       strings.TrimSpace(query.Get("country")),
+		ZipCodePrefix: strings.TrimSpace(query.Get("zip_code")),
+	}
+	// Addresses are stored with ISO codes, which a country or state given by
+	// name is looked up as.
+	if country, ok := geo.LookupCountry(filter.Country); ok {
+		filter.Country = country.Code
+		if subdivision, ok := geo.LookupSubdivision(country.Code, filter.State); ok {
+			filter.State = subdivision.Short()
 		}
+	}
+	for _, tag := range query["tag"] {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
 
-		_ = ContactRetrieved.WriteToResponse(w, response)
-		return
+	var err error
+	if filter.CreatedAfter, err = parseDateParam(query.Get("created_after")); err != nil {
+		return filter, fmt.Errorf("invalid created_after: %w", err)
+	}
+	if filter.CreatedBefore, err = parseDateParam(query.Get("created_before")); err != nil {
+		return filter, fmt.Errorf("invalid created_before: %w", err)
+	}
+	if filter.Sort, err = repository.ParseContactSort(query.Get("sort")); err != nil {
+		return filter, err
+	}
 
+	return filter, nil
+}
+
+func parseDateParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
 	}
+	return time.Parse(time.DateOnly, value)
 }
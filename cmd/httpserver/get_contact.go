@@ -5,7 +5,6 @@ import (
 	"github.com/gofrs/uuid"
 	"go_chi_pgx/state"
 	"net/http"
-	"strings"
 )
 
 func HandlerGetContactByID(app *state.State) http.HandlerFunc {
@@ -19,20 +18,32 @@ func HandlerGetContactByID(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error creating contact",
 			})
-			_ = InvalidId.WriteToResponse(w, nil)
+			_ = InvalidId.WriteProblem(w, req, nil)
 			return
 		}
 		ctx := req.Context()
-		contact, err := app.Repository.GetContactByID(ctx, contactID)
+		userID, err := GetUserUUIDFromContext(ctx)
 		if err != nil {
-			if strings.Contains(err.Error(), "no contact found") {
-				_ = NotFound.WriteToResponse(w, nil)
-			} else {
-				app.Logger.PrintError(err, map[string]string{
-					"context": "Error fetching contact",
-				})
-				_ = InternalError.WriteToResponse(w, nil)
-			}
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		contact, err := app.Repository.GetContactByID(ctx, userID, contactID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching contact",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		etag := versionETag(contact.Version)
+		w.Header().Set("ETag", etag)
+		if match := req.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 
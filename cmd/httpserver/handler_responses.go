@@ -1,6 +1,8 @@
 package httpserver
 
 import (
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
 	utilis "go_chi_pgx/utils"
 	"net/http"
 )
@@ -22,10 +24,26 @@ var InvalidToken = utilis.ResponseState{
 	StatusCode: http.StatusUnauthorized,
 	Message:    "Invalid token",
 }
+var InvalidTokenScope = utilis.ResponseState{
+	StatusCode: http.StatusForbidden,
+	Message:    "Token is not valid for this resource",
+}
+var RefreshTokenReused = utilis.ResponseState{
+	StatusCode: http.StatusUnauthorized,
+	Message:    "Refresh token reuse detected, all sessions from this login were revoked",
+}
+var TokenRevoked = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Token revoked successfully",
+}
 var InvalidId = utilis.ResponseState{
 	StatusCode: http.StatusBadRequest,
 	Message:    "Invalid contact ID",
 }
+var InvalidTagId = utilis.ResponseState{
+	StatusCode: http.StatusBadRequest,
+	Message:    "Invalid tag ID",
+}
 var InvalidUserId = utilis.ResponseState{
 	StatusCode: http.StatusBadRequest,
 	Message:    "Invalid user ID",
@@ -53,6 +71,21 @@ var UserCreated = utilis.ResponseState{
 	Message:    "User created successfully",
 }
 
+var PasswordResetRequested = utilis.ResponseState{
+	StatusCode: http.StatusAccepted,
+	Message:    "If the account exists, password reset instructions have been sent",
+}
+
+var PasswordUpdated = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Password updated successfully",
+}
+
+var InvalidResetToken = utilis.ResponseState{
+	StatusCode: http.StatusBadRequest,
+	Message:    "Invalid or expired password reset token",
+}
+
 var loginSuccess = utilis.ResponseState{
 	StatusCode: http.StatusOK,
 	Message:    "Login Successful",
@@ -79,6 +112,22 @@ var ContactUpdated = utilis.ResponseState{
 	StatusCode: http.StatusCreated,
 	Message:    "Contacts Updated successfully",
 }
+var ContactRestored = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Contact restored successfully",
+}
+var ContactHistoryRetrieved = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Contact history retrieved successfully",
+}
+var ContactReverted = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Contact reverted successfully",
+}
+var RevisionNotFound = utilis.ResponseState{
+	StatusCode: http.StatusNotFound,
+	Message:    "Revision not found",
+}
 var RateLimitExceeded = utilis.ResponseState{
 	StatusCode: http.StatusTooManyRequests,
 	Message:    "Rate Limit Exceeded",
@@ -88,3 +137,113 @@ var BadRequestError = utilis.ResponseState{
 	StatusCode: http.StatusBadRequest,
 	Message:    "Bad Request",
 }
+
+var ContactsImported = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Contacts imported",
+}
+
+var UnsupportedMediaType = utilis.ResponseState{
+	StatusCode: http.StatusUnsupportedMediaType,
+	Message:    "Unsupported content type",
+}
+
+var PayloadTooLarge = utilis.ResponseState{
+	StatusCode: http.StatusRequestEntityTooLarge,
+	Message:    "The uploaded file is too large",
+}
+
+var TagsRetrieved = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Tags retrieved successfully",
+}
+var TagCreated = utilis.ResponseState{
+	StatusCode: http.StatusCreated,
+	Message:    "Tag created successfully",
+}
+var TagUpdated = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Tag updated successfully",
+}
+var TagNotFound = utilis.ResponseState{
+	StatusCode: http.StatusNotFound,
+	Message:    "Tag not found",
+}
+var TagNameTaken = utilis.ResponseState{
+	StatusCode: http.StatusConflict,
+	Message:    "A tag with this name already exists",
+}
+var TagTargetsNotFound = utilis.ResponseState{
+	StatusCode: http.StatusNotFound,
+	Message:    "One or more tags or contacts were not found",
+}
+var ContactsTagged = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Contacts tagged successfully",
+}
+var ContactsUntagged = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Contacts untagged successfully",
+}
+
+var DuplicatesRetrieved = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Duplicate contacts retrieved successfully",
+}
+var ContactsMerged = utilis.ResponseState{
+	StatusCode: http.StatusOK,
+	Message:    "Contacts merged successfully",
+}
+var MergeTargetsNotFound = utilis.ResponseState{
+	StatusCode: http.StatusNotFound,
+	Message:    "One or more contacts to merge were not found",
+}
+
+var RouteNotFound = utilis.ResponseState{
+	StatusCode: http.StatusNotFound,
+	Message:    "No resource exists at this path",
+}
+var MethodNotAllowed = utilis.ResponseState{
+	StatusCode: http.StatusMethodNotAllowed,
+	Message:    "The resource does not support this method",
+}
+
+var Conflict = utilis.ResponseState{
+	StatusCode: http.StatusConflict,
+	Message:    "The request conflicts with the current state of the resource",
+}
+
+var PreconditionFailed = utilis.ResponseState{
+	StatusCode: http.StatusPreconditionFailed,
+	Message:    "The contact was modified since it was last read",
+}
+
+var InvalidReference = utilis.ResponseState{
+	StatusCode: http.StatusUnprocessableEntity,
+	Message:    "The request references a resource that does not exist",
+}
+
+var RequestTimeout = utilis.ResponseState{
+	StatusCode: http.StatusServiceUnavailable,
+	Message:    "The request timed out, please try again",
+}
+
+// repositoryErrorResponse maps an error from the repository package to the
+// response sent to the client. notFound is used for repository.ErrNotFound so
+// each handler can name the missing resource.
+func repositoryErrorResponse(err error, notFound utilis.ResponseState) utilis.ResponseState {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFound
+	case errors.Is(err, repository.ErrUniqueViolation), errors.Is(err, repository.ErrConflict):
+		return Conflict
+	case errors.Is(err, repository.ErrPreconditionFailed):
+		return PreconditionFailed
+	case errors.Is(err, repository.ErrForeignKey):
+		return InvalidReference
+	case errors.Is(err, repository.ErrTimeout):
+		return RequestTimeout
+	default:
+		return InternalError
+	}
+}
@@ -0,0 +1,167 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"go_chi_pgx/vcard"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const (
+	maxImportBytes  = 10 << 20 // Largest accepted import upload
+	importBatchSize = 1000     // Rows sent to Postgres per COPY
+)
+
+var errInvalidImport = errors.New("invalid import file")
+
+// ImportRowError lists the problems of one rejected import row. Line is the
+// line of the uploaded file the row (or card) starts on.
+type ImportRowError struct {
+	Line   int          `json:"line"`
+	Errors []FieldError `json:"errors"`
+}
+
+type ImportReport struct {
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+func (r *ImportReport) reject(line int, errs []FieldError) {
+	r.Failed++
+	r.Errors = append(r.Errors, ImportRowError{Line: line, Errors: errs})
+}
+
+// importRow is one contact read from an upload. Rows the reader could not
+// parse carry their errors instead of a payload.
+type importRow struct {
+	line    int
+	payload ContactRequestPayload
+	errs    []FieldError
+}
+
+// importRows yields the rows of an upload one at a time and io.EOF after the
+// last one.
+type importRows func() (*importRow, error)
+
+// HandlerImportContacts creates contacts from an uploaded CSV or vCard file.
+// Valid rows are inserted in batches inside one transaction, and invalid rows
+// are reported back instead of failing the whole upload.
+func HandlerImportContacts(app *state.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		if err = extendDeadlines(w); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error extending deadlines",
+			})
+		}
+		body := http.MaxBytesReader(w, req.Body, maxImportBytes)
+
+		var rows importRows
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			rows, err = csvImportRows(body, req.URL.Query())
+		case vcard.MediaType, "text/x-vcard":
+			rows = vcardImportRows(body)
+		default:
+			_ = UnsupportedMediaType.WriteProblem(w, req, nil)
+			return
+		}
+
+		var report *ImportReport
+		if err == nil {
+			report, err = importContacts(ctx, app, userID, rows)
+		}
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			_ = PayloadTooLarge.WriteProblem(w, req, nil)
+			return
+		case errors.Is(err, errInvalidImport):
+			app.Logger.PrintError(err, map[string]string{
+				"context": "contact import",
+			})
+			_ = BadRequestError.WriteProblem(w, req, nil)
+			return
+		case err != nil:
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error importing contacts",
+			})
+			_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = ContactsImported.WriteToResponse(w, report)
+	}
+}
+
+// importContacts validates every row against the ContactRequestPayload rules
+// and copies the valid ones into the database in batches of importBatchSize.
+func importContacts(ctx context.Context, app *state.State, userID uuid.UUID, rows importRows) (*ImportReport, error) {
+	report := &ImportReport{Errors: []ImportRowError{}}
+	validate := newValidator()
+
+	err := app.Repository.InTx(ctx, func(ctx context.Context) error {
+		batch := make([]repository.Contact, 0, importBatchSize)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			count, err := app.Repository.CopyContacts(ctx, batch)
+			report.Imported += int(count)
+			batch = batch[:0]
+			return err
+		}
+
+		for {
+			row, err := rows()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if row.errs != nil {
+				report.reject(row.line, row.errs)
+				continue
+			}
+			if err := row.payload.syncAndValidateSynced(validate, app.Config.PhoneRegion); err != nil {
+				report.reject(row.line, fieldErrors(err))
+				continue
+			}
+
+			id, err := uuid.NewV4()
+			if err != nil {
+				return err
+			}
+			batch = append(batch, row.payload.contact(id, userID))
+			if len(batch) == importBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return flush()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
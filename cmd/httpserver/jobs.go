@@ -0,0 +1,190 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofrs/uuid"
+	"go_chi_pgx/geo"
+	"go_chi_pgx/jobs"
+	"go_chi_pgx/phone"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"time"
+)
+
+// Job kinds run by the worker pool started in Serve.
+const (
+	KindActivationEmail    = "user_activation_email"
+	KindPasswordResetEmail = "password_reset_email"
+	KindBackfillPhoneE164  = "backfill_phone_e164"
+	KindNormalizeAddresses = "normalize_addresses"
+)
+
+const activationTTL = 2 * time.Hour
+
+// backfillBatchSize is how many contacts a backfill job handles before it
+// queues the next one, which keeps each job well within the job timeout.
+const backfillBatchSize = 500
+
+// UserEmailPayload identifies the recipient of a user email job. Tokens are
+// minted by the job itself so that no credential is ever stored in the queue.
+type UserEmailPayload struct {
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	Email  string    `json:"email"`
+}
+
+// BackfillPayload is where a backfill job picks up: at the first contact by ID
+// after After. The zero value starts at the beginning.
+type BackfillPayload struct {
+	After uuid.UUID `json:"after"`
+}
+
+// JobHandlers returns the handler for every job kind the application enqueues.
+func JobHandlers(app *state.State) jobs.Handlers {
+	return jobs.Handlers{
+		KindActivationEmail:    sendActivationEmail(app),
+		KindPasswordResetEmail: sendPasswordResetEmail(app),
+		KindBackfillPhoneE164:  backfillPhoneE164(app),
+		KindNormalizeAddresses: normalizeAddresses(app),
+	}
+}
+
+func sendActivationEmail(app *state.State) jobs.Handler {
+	return func(ctx context.Context, raw json.RawMessage) error {
+		var payload UserEmailPayload
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return jobs.Permanent(err)
+		}
+
+		token, err := utils.GenerateJWT(payload.UserID, utils.ScopeActivation, app.Config.ActivationKey, activationTTL)
+		if err != nil {
+			return err
+		}
+
+		data := map[string]any{
+			"name":            payload.Name,
+			"userID":          payload.UserID.String(),
+			"activationToken": token,
+			"expiresIn":       activationTTL.String(),
+		}
+		return app.Mailer.Send(payload.Email, "user_activation.tmpl", data)
+	}
+}
+
+func sendPasswordResetEmail(app *state.State) jobs.Handler {
+	return func(ctx context.Context, raw json.RawMessage) error {
+		var payload UserEmailPayload
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return jobs.Permanent(err)
+		}
+
+		token, hash, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			return err
+		}
+
+		resetToken := repository.PasswordResetToken{
+			Hash:      hash,
+			UserID:    payload.UserID,
+			ExpiresAt: time.Now().Add(app.Config.ResetTTL),
+		}
+		if err = app.Repository.CreatePasswordResetToken(ctx, &resetToken); err != nil {
+			return err
+		}
+
+		data := map[string]any{
+			"name":       payload.Name,
+			"resetToken": token,
+			"expiresIn":  app.Config.ResetTTL.String(),
+		}
+		return app.Mailer.Send(payload.Email, "password_reset.tmpl", data)
+	}
+}
+
+// backfillPhoneE164 fills in the E.164 form of numbers stored before numbers
+// were normalized, parsing them the way saving the contact would. Each job
+// handles one batch of contacts and queues the job for the next batch in the
+// same transaction; numbers that don't parse are left without one.
+func backfillPhoneE164(app *state.State) jobs.Handler {
+	return func(ctx context.Context, raw json.RawMessage) error {
+		var payload BackfillPayload
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return jobs.Permanent(err)
+		}
+
+		phones, err := app.Repository.GetPhonesWithoutE164(ctx, payload.After, backfillBatchSize)
+		if err != nil || len(phones) == 0 {
+			return err
+		}
+		for i, number := range phones {
+			country := number.Country
+			if known, ok := geo.LookupCountry(country); ok {
+				country = known.Code
+			}
+			phones[i].E164, _ = phone.Normalize(number.Number, phone.Region(country, app.Config.PhoneRegion))
+		}
+
+		next, err := jobs.NewJob(KindBackfillPhoneE164, BackfillPayload{After: phones[len(phones)-1].ContactID})
+		if err != nil {
+			return err
+		}
+		return app.Repository.InTx(ctx, func(ctx context.Context) error {
+			if err := app.Repository.SetPhonesE164(ctx, phones); err != nil {
+				return err
+			}
+			return app.Repository.EnqueueJob(ctx, next)
+		})
+	}
+}
+
+// normalizeAddresses rewrites the countries, states and zip codes of addresses
+// stored before addresses were normalized the way saving the contact would,
+// so filtering by country code finds them. Batches work as for
+// backfillPhoneE164; values it can't make sense of are left as they are.
+func normalizeAddresses(app *state.State) jobs.Handler {
+	return func(ctx context.Context, raw json.RawMessage) error {
+		var payload BackfillPayload
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return jobs.Permanent(err)
+		}
+
+		addresses, err := app.Repository.GetAddressesToNormalize(ctx, payload.After, backfillBatchSize)
+		if err != nil || len(addresses) == 0 {
+			return err
+		}
+		var changed []repository.AddressBackfill
+		for _, address := range addresses {
+			normalized := AddressPayload(address.Address)
+			normalized.normalize()
+			if address.Normalized = repository.ContactAddress(normalized); address.Normalized != address.Address {
+				changed = append(changed, address)
+			}
+		}
+
+		next, err := jobs.NewJob(KindNormalizeAddresses, BackfillPayload{After: addresses[len(addresses)-1].ContactID})
+		if err != nil {
+			return err
+		}
+		return app.Repository.InTx(ctx, func(ctx context.Context) error {
+			if err := app.Repository.SetNormalizedAddresses(ctx, changed); err != nil {
+				return err
+			}
+			return app.Repository.EnqueueJob(ctx, next)
+		})
+	}
+}
+
+// enqueueUserEmail queues an email job of the given kind for user.
+func enqueueUserEmail(ctx context.Context, app *state.State, kind string, user *repository.User) error {
+	job, err := jobs.NewJob(kind, UserEmailPayload{
+		UserID: user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+	})
+	if err != nil {
+		return err
+	}
+	return app.Repository.EnqueueJob(ctx, job)
+}
@@ -2,7 +2,8 @@ package httpserver
 
 import (
 	"encoding/json"
-	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	utils "go_chi_pgx/utils"
 	"net/http"
@@ -31,34 +32,37 @@ func HandleLogin(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Invalid JSON",
 			})
-			_ = ValidDataNotFound.WriteToResponse(w, nil)
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
 			return
 		}
 
-		validate := validator.New()
-
-		err = validate.Struct(request)
+		err = newValidator().Struct(request)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Invalid payload",
 			})
-			_ = ValidDataNotFound.WriteToResponse(w, nil)
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
 			return
 		}
 
 		user, err := app.Repository.GetUserByEmail(ctx, request.Email)
 		if err != nil {
-			_ = InvalidEmailPassword.WriteToResponse(w, nil)
+			if !errors.Is(err, repository.ErrNotFound) {
+				app.Logger.PrintError(err, map[string]string{
+					"context": "Error fetching user by email",
+				})
+			}
+			_ = repositoryErrorResponse(err, InvalidEmailPassword).WriteProblem(w, req, nil)
 			return
 		}
 
 		if !utils.CheckPasswordHash(user.Password, request.Password) {
-			_ = InvalidEmailPassword.WriteToResponse(w, nil)
+			_ = InvalidEmailPassword.WriteProblem(w, req, nil)
 			return
 		}
 
 		if !user.IsActive {
-			_ = UserNotActive.WriteToResponse(w, nil)
+			_ = UserNotActive.WriteProblem(w, req, nil)
 			return
 		}
 
@@ -69,16 +73,33 @@ func HandleLogin(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error generating access token",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
+			return
+		}
+
+		refresh, err := newRefreshToken(app, user.ID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error generating UUID",
+			})
+			_ = InternalError.WriteProblem(w, req, nil)
+			return
+		}
+
+		if err = app.Repository.CreateRefreshToken(ctx, refresh); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error storing refresh token",
+			})
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 
-		refreshToken, err := utils.GenerateRefreshToken(user.ID.String(), app.Config.SecretKey)
+		refreshToken, err := utils.GenerateRefreshToken(refresh.UserID, refresh.ID, app.Config.RefreshKey, app.Config.RefreshTTL)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error generating refresh token",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 
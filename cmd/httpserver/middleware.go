@@ -3,7 +3,9 @@ package httpserver
 import (
 	"context"
 	"fmt"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	utils "go_chi_pgx/utils"
 	"golang.org/x/time/rate"
@@ -23,20 +25,16 @@ func AuthMiddleware(app *state.State) func(http.Handler) http.Handler {
 				app.Logger.PrintError(fmt.Errorf("no token provided"), map[string]string{
 					"context": "authorization",
 				})
-				_ = Unauthorized.WriteToResponse(w, nil)
+				_ = Unauthorized.WriteProblem(w, r, nil)
 				return
 			}
 
-			var claims utils.Claims
-			token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
-				return []byte(app.Config.SecretKey), nil
-			})
-
-			if err != nil || !token.Valid {
-				app.Logger.PrintError(fmt.Errorf("invalid token"), map[string]string{
+			claims, err := utils.VerifyJWT(tokenStr, utils.ScopeAuthentication, app.Config.TokenKeys())
+			if err != nil {
+				app.Logger.PrintError(err, map[string]string{
 					"context": "authorization",
 				})
-				_ = Unauthorized.WriteToResponse(w, nil)
+				_ = tokenErrorResponse(err, Unauthorized).WriteProblem(w, r, nil)
 				return
 			}
 			ctx := context.WithValue(r.Context(), "userid", claims.UserID.String())
@@ -45,6 +43,46 @@ func AuthMiddleware(app *state.State) func(http.Handler) http.Handler {
 	}
 }
 
+// BasicAuthMiddleware authenticates with an email and password sent as HTTP
+// Basic credentials, for clients such as CardDAV apps that can't obtain a JWT.
+// Like AuthMiddleware it stores the user ID in the request context.
+func BasicAuthMiddleware(app *state.State, realm string) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			challenge := func() {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm))
+				_ = Unauthorized.WriteProblem(w, r, nil)
+			}
+
+			email, password, ok := r.BasicAuth()
+			if !ok {
+				challenge()
+				return
+			}
+
+			user, err := app.Repository.GetUserByEmail(r.Context(), email)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				app.Logger.PrintError(err, map[string]string{
+					"context": "basic authorization",
+				})
+				_ = repositoryErrorResponse(err, Unauthorized).WriteProblem(w, r, nil)
+				return
+			}
+			if err != nil || !utils.CheckPasswordHash(user.Password, password) || !user.IsActive {
+				app.Logger.PrintError(fmt.Errorf("invalid credentials for %q", email), map[string]string{
+					"context": "basic authorization",
+				})
+				challenge()
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "userid", user.ID.String())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func RateLimitMiddleware(app *state.State) func(http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
@@ -78,7 +116,7 @@ func RateLimitMiddleware(app *state.State) func(http.Handler) http.Handler {
 					app.Logger.PrintError(err, map[string]string{
 						"context": "host port split error",
 					})
-					_ = Unauthorized.WriteToResponse(w, nil)
+					_ = Unauthorized.WriteProblem(w, r, nil)
 					return
 				}
 
@@ -97,7 +135,7 @@ func RateLimitMiddleware(app *state.State) func(http.Handler) http.Handler {
 
 				if !cli.limiter.Allow() {
 					mu.Unlock()
-					_ = RateLimitExceeded.WriteToResponse(w, nil)
+					_ = RateLimitExceeded.WriteProblem(w, r, nil)
 					return
 				}
 				mu.Unlock()
@@ -109,6 +147,15 @@ func RateLimitMiddleware(app *state.State) func(http.Handler) http.Handler {
 	}
 }
 
+// tokenErrorResponse picks the response for a failed utils.VerifyJWT call:
+// 403 for a genuine token of another scope, the given fallback otherwise.
+func tokenErrorResponse(err error, fallback utils.ResponseState) utils.ResponseState {
+	if errors.Is(err, utils.ErrWrongScope) {
+		return InvalidTokenScope
+	}
+	return fallback
+}
+
 func extractTokenFromHeader(r *http.Request) string {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -121,3 +168,10 @@ func GetUserIDFromContext(ctx context.Context) (string, bool) {
 	userID, ok := ctx.Value("userid").(string)
 	return userID, ok
 }
+
+// GetUserUUIDFromContext returns the authenticated user's ID as a UUID so
+// handlers can scope repository calls to the caller's own rows.
+func GetUserUUIDFromContext(ctx context.Context) (uuid.UUID, error) {
+	userID, _ := GetUserIDFromContext(ctx)
+	return uuid.FromString(userID)
+}
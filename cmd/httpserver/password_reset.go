@@ -0,0 +1,126 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+)
+
+type PasswordResetRequestPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordUpdateRequestPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+// HandleRequestPasswordReset queues a reset email for an active account. It
+// answers the same way whether or not the email is registered so the endpoint
+// can't be used to enumerate users.
+func HandleRequestPasswordReset(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		request := PasswordResetRequestPayload{}
+		ctx := req.Context()
+
+		err := json.NewDecoder(req.Body).Decode(&request)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid JSON",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
+		}
+
+		err = newValidator().Struct(request)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
+		}
+
+		user, err := app.Repository.GetUserByEmail(ctx, request.Email)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				_ = PasswordResetRequested.WriteToResponse(w, nil)
+				return
+			}
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching user by email",
+			})
+			_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+			return
+		}
+
+		if !user.IsActive {
+			_ = PasswordResetRequested.WriteToResponse(w, nil)
+			return
+		}
+
+		if err = enqueueUserEmail(ctx, app, KindPasswordResetEmail, user); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error queueing password reset email",
+			})
+			_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = PasswordResetRequested.WriteToResponse(w, nil)
+		return
+	}
+}
+
+func HandleResetPassword(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		request := PasswordUpdateRequestPayload{}
+		ctx := req.Context()
+
+		err := json.NewDecoder(req.Body).Decode(&request)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid JSON",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
+		}
+
+		err = newValidator().Struct(request)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
+		}
+
+		passwordHash, err := utils.HashPassword(request.Password)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Failed to hash password",
+			})
+			_ = InternalError.WriteProblem(w, req, nil)
+			return
+		}
+
+		err = app.Repository.ResetPassword(ctx, utils.HashOpaqueToken(request.Token), passwordHash)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Failed to reset password",
+			})
+			_ = repositoryErrorResponse(err, InvalidResetToken).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = PasswordUpdated.WriteToResponse(w, nil)
+		return
+	}
+}
@@ -3,7 +3,8 @@ package httpserver
 import (
 	"encoding/json"
 	"github.com/gofrs/uuid"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	utils "go_chi_pgx/utils"
 	"net/http"
@@ -19,57 +20,102 @@ type RefreshResponsePayload struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// newRefreshToken builds the record for a refresh token owned by userID. The
+// caller decides which family it joins.
+func newRefreshToken(app *state.State, userID uuid.UUID) (*repository.RefreshToken, error) {
+	tokenID, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	return &repository.RefreshToken{
+		ID:        tokenID,
+		UserID:    userID,
+		FamilyID:  tokenID,
+		ExpiresAt: time.Now().Add(app.Config.RefreshTTL),
+	}, nil
+}
+
 func HandleRefreshToken(app *state.State) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
 		refreshRequest := RefreshRequestPayload{}
+		ctx := req.Context()
 		err := json.NewDecoder(req.Body).Decode(&refreshRequest)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Invalid JSON",
 			})
-			_ = ValidDataNotFound.WriteToResponse(w, nil)
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
 			return
 		}
 
-		claims := &jwt.StandardClaims{}
-		token, err := jwt.ParseWithClaims(refreshRequest.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(app.Config.SecretKey), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := utils.VerifyJWT(refreshRequest.RefreshToken, utils.ScopeRefresh, app.Config.TokenKeys())
+		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Invalid token",
 			})
-			_ = Unauthorized.WriteToResponse(w, nil)
+			_ = tokenErrorResponse(err, Unauthorized).WriteProblem(w, req, nil)
 			return
 		}
 
-		userID, err := uuid.FromString(claims.Subject)
+		tokenID, err := uuid.FromString(claims.ID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid token ID",
+			})
+			_ = Unauthorized.WriteProblem(w, req, nil)
+			return
+		}
 
+		next, err := newRefreshToken(app, claims.UserID)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
-				"context": "Error parsing UUID",
+				"context": "Error generating UUID",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 
-		accessToken, err := utils.GenerateJWT(userID, utils.ScopeAuthentication, app.Config.SecretKey, 2*time.Hour)
+		err = app.Repository.RotateRefreshToken(ctx, tokenID, next)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrRefreshTokenReused):
+				app.Logger.PrintError(err, map[string]string{
+					"context": "refresh token reuse detected",
+					"user_id": claims.UserID.String(),
+				})
+				_ = RefreshTokenReused.WriteProblem(w, req, nil)
+			case errors.Is(err, repository.ErrRefreshTokenNotFound),
+				errors.Is(err, repository.ErrRefreshTokenRevoked),
+				errors.Is(err, repository.ErrRefreshTokenExpired):
+				app.Logger.PrintError(err, map[string]string{
+					"context": "Invalid token",
+				})
+				_ = Unauthorized.WriteProblem(w, req, nil)
+			default:
+				app.Logger.PrintError(err, map[string]string{
+					"context": "Error rotating refresh token",
+				})
+				_ = InternalError.WriteProblem(w, req, nil)
+			}
+			return
+		}
+
+		accessToken, err := utils.GenerateJWT(claims.UserID, utils.ScopeAuthentication, app.Config.SecretKey, 2*time.Hour)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error generating access token",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 
-		newRefreshToken, err := utils.GenerateRefreshToken(claims.Subject, app.Config.SecretKey)
+		newRefreshToken, err := utils.GenerateRefreshToken(next.UserID, next.ID, app.Config.RefreshKey, app.Config.RefreshTTL)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error generating refresh token",
 			})
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 
@@ -83,3 +129,53 @@ func HandleRefreshToken(app *state.State) http.HandlerFunc {
 
 	}
 }
+
+func HandleRevokeToken(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		revokeRequest := RefreshRequestPayload{}
+		ctx := req.Context()
+		err := json.NewDecoder(req.Body).Decode(&revokeRequest)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid JSON",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
+		}
+
+		claims, err := utils.VerifyJWT(revokeRequest.RefreshToken, utils.ScopeRefresh, app.Config.TokenKeys())
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid token",
+			})
+			_ = tokenErrorResponse(err, Unauthorized).WriteProblem(w, req, nil)
+			return
+		}
+
+		tokenID, err := uuid.FromString(claims.ID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid token ID",
+			})
+			_ = Unauthorized.WriteProblem(w, req, nil)
+			return
+		}
+
+		err = app.Repository.RevokeRefreshTokenFamily(ctx, tokenID)
+		if err != nil {
+			if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+				_ = Unauthorized.WriteProblem(w, req, nil)
+				return
+			}
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error revoking refresh token",
+			})
+			_ = InternalError.WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = TokenRevoked.WriteToResponse(w, nil)
+		return
+	}
+}
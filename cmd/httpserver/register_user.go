@@ -1,17 +1,15 @@
 package httpserver
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/go-playground/validator/v10"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
 	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	utils "go_chi_pgx/utils"
 	"net/http"
-	"time"
 )
 
 type RegistrationRequestPayload struct {
@@ -21,7 +19,10 @@ type RegistrationRequestPayload struct {
 }
 
 type RegistrationResponsePayload struct {
-	ActivateToken string `json:"activate_token"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	IsActive bool   `json:"is_active"`
 }
 
 func HandleRegisterUser(app *state.State) http.HandlerFunc {
@@ -36,30 +37,28 @@ func HandleRegisterUser(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Invalid JSON",
 			})
-			_ = ValidDataNotFound.WriteToResponse(w, nil)
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
 			return
 		}
-		validate := validator.New()
-
-		err = validate.Struct(request)
+		err = newValidator().Struct(request)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Invalid payload",
 			})
-			_ = ValidDataNotFound.WriteToResponse(w, nil)
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
 			return
 		}
 
 		user, err := app.Repository.GetUserByEmail(ctx, request.Email)
 
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
+			if errors.Is(err, repository.ErrNotFound) {
 				app.Logger.PrintInfo(fmt.Sprintf("user with email %s not found", request.Email), map[string]string{})
 			} else {
 				app.Logger.PrintError(err, map[string]string{
 					"context": "Error fetching user by email",
 				})
-				_ = InternalError.WriteToResponse(w, nil)
+				_ = InternalError.WriteProblem(w, req, nil)
 				return
 			}
 		}
@@ -68,7 +67,7 @@ func HandleRegisterUser(app *state.State) http.HandlerFunc {
 			app.Logger.PrintInfo(fmt.Sprintf("User already exists: %s", request.Email), map[string]string{
 				"context": "user registration",
 			})
-			_ = UserAlreadyExist.WriteToResponse(w, nil)
+			_ = UserAlreadyExist.WriteProblem(w, req, nil)
 			return
 		}
 
@@ -79,14 +78,14 @@ func HandleRegisterUser(app *state.State) http.HandlerFunc {
 				"context": "Failed to hash password",
 			})
 
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 
 		userID, err := uuid.NewV4()
 
 		if err != nil {
-			_ = InternalError.WriteToResponse(w, nil)
+			_ = InternalError.WriteProblem(w, req, nil)
 			return
 		}
 
@@ -98,29 +97,32 @@ func HandleRegisterUser(app *state.State) http.HandlerFunc {
 			IsActive: false,
 		}
 
-		if err = app.Repository.CreateUser(ctx, user); err != nil {
-			app.Logger.PrintError(err, map[string]string{
-				"context": "Failed to create user",
-			})
-			_ = InternalError.WriteToResponse(w, nil)
-			return
-		}
-
-		ttl := 2 * time.Hour
-
-		token, err := utils.GenerateJWT(user.ID, utils.ScopeActivation, app.Config.SecretKey, ttl)
-
+		// The activation email is queued in the same transaction as the user so
+		// that neither can exist without the other.
+		err = app.Repository.InTx(ctx, func(ctx context.Context) error {
+			if err := app.Repository.CreateUser(ctx, user); err != nil {
+				return err
+			}
+			return enqueueUserEmail(ctx, app, KindActivationEmail, user)
+		})
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
-				"context": "Failed to activation token",
+				"context": "Failed to create user",
 			})
-
-			_ = InternalError.WriteToResponse(w, nil)
+			// A concurrent registration can win the race past GetUserByEmail.
+			if errors.Is(err, repository.ErrUniqueViolation) {
+				_ = UserAlreadyExist.WriteProblem(w, req, nil)
+				return
+			}
+			_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
 			return
 		}
 
 		response := RegistrationResponsePayload{
-			ActivateToken: token,
+			ID:       user.ID.String(),
+			Name:     user.Name,
+			Email:    user.Email,
+			IsActive: user.IsActive,
 		}
 
 		_ = UserCreated.WriteToResponse(w, response)
@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"strings"
+)
+
+// HandlerPutContactByID replaces a contact as a whole, or creates it under the
+// ID in the path when it does not exist yet, so clients can pick IDs offline.
+// If-None-Match: * only creates and If-Match only replaces the given version.
+func HandlerPutContactByID(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		contactID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err == nil && contactID == uuid.Nil {
+			err = errors.New("nil contact ID")
+		}
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing contact ID",
+			})
+			_ = InvalidId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		requestPayload := ContactRequestPayload{}
+		if err = json.NewDecoder(req.Body).Decode(&requestPayload); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid JSON",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
+		}
+
+		if err = requestPayload.syncAndValidateNew(newValidator(), app.Config.PhoneRegion); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
+		}
+
+		var cond repository.ContactPrecondition
+		if strings.TrimSpace(req.Header.Get("If-None-Match")) == "*" {
+			cond.MustNotExist = true
+		} else if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+			current, err := app.Repository.GetContactObject(ctx, userID, contactID)
+			if err == nil && !etagMatches(ifMatch, versionETag(current.Version), false) {
+				err = repository.ErrPreconditionFailed
+			}
+			if err != nil {
+				app.Logger.PrintError(err, map[string]string{
+					"context": "If-Match does not match the contact",
+				})
+				_ = repositoryErrorResponse(err, PreconditionFailed).WriteProblem(w, req, nil)
+				return
+			}
+			cond.Version = current.Version
+		}
+
+		contact := requestPayload.contact(contactID, userID)
+
+		created, err := app.Repository.PutContactObject(ctx, &contact, cond)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error replacing contact",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		response := requestPayload.response(contactID.String())
+
+		w.Header().Set("ETag", versionETag(contact.Version))
+		if created {
+			_ = ContactCreated.WriteToResponse(w, response)
+			return
+		}
+		_ = ContactUpdated.WriteToResponse(w, response)
+	}
+}
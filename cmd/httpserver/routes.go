@@ -5,40 +5,79 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/cors"
 	"go_chi_pgx/state"
-	"time"
+	"net/http"
 )
 
 func routes(s *state.State) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(middleware.Timeout(requestTimeout))
 
 	corsOptions := cors.Options{
 		AllowedOrigins:   []string{"http://localhost"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Content-Length"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Content-Length", "ETag"},
 		AllowCredentials: true,
 	}
 	r.Use(cors.New(corsOptions).Handler)
 
+	r.NotFound(func(w http.ResponseWriter, req *http.Request) {
+		_ = RouteNotFound.WriteProblem(w, req, nil)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, req *http.Request) {
+		_ = MethodNotAllowed.WriteProblem(w, req, nil)
+	})
+
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Post("/users", HandleRegisterUser(s))
 		r.Post("/users/activate", HandleActivateUser(s))
+		r.Post("/users/password-reset", HandleRequestPasswordReset(s))
+		r.Put("/users/password", HandleResetPassword(s))
 		r.Post("/token/auth", HandleLogin(s))
 		r.Post("/token/refresh", HandleRefreshToken(s))
+		r.Post("/token/revoke", HandleRevokeToken(s))
 	})
 
 	r.Route("/api/v1/contacts", func(r chi.Router) {
 		r.Use(AuthMiddleware(s))
 		r.Get("/", HandlerGetAllContacts(s))
 		r.Post("/", HandlerCreateContact(s))
+		r.Post("/import", HandlerImportContacts(s))
+		r.Get("/export", HandlerExportContacts(s))
+		r.Get("/trash", HandlerGetContactTrash(s))
+		r.Post("/tag", HandlerTagContacts(s))
+		r.Post("/untag", HandlerUntagContacts(s))
+		r.Get("/duplicates", HandlerGetDuplicateContacts(s))
+		r.Post("/merge", HandlerMergeContacts(s))
 		r.Get("/{id}", HandlerGetContactByID(s))
+		r.Get("/{id}.vcf", HandlerGetContactVCard(s))
+		r.Put("/{id}", HandlerPutContactByID(s))
 		r.Patch("/{id}", HandlerPatchContactByID(s))
 		r.Delete("/{id}", HandlerDeleteContactByID(s))
+		r.Post("/{id}/restore", HandlerRestoreContactByID(s))
+		r.Get("/{id}/history", HandlerGetContactHistory(s))
+		r.Post("/{id}/revert", HandlerRevertContactByID(s))
+	})
+
+	r.Route("/api/v1/tags", func(r chi.Router) {
+		r.Use(AuthMiddleware(s))
+		r.Get("/", HandlerGetTags(s))
+		r.Post("/", HandlerCreateTag(s))
+		r.Get("/{id}", HandlerGetTagByID(s))
+		r.Patch("/{id}", HandlerRenameTag(s))
+		r.Delete("/{id}", HandlerDeleteTag(s))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(BasicAuthMiddleware(s, cardDAVRealm))
+		carddav := HandlerCardDAV(s)
+		r.Handle("/.well-known/carddav", carddav)
+		r.Mount(cardDAVPrefix, carddav)
 	})
 
 	return r
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/pkg/errors"
+	"go_chi_pgx/jobs"
 	"go_chi_pgx/state"
 	"log"
 	"net/http"
@@ -13,6 +14,27 @@ import (
 	"time"
 )
 
+// requestTimeout bounds every request through the context given to it by the
+// Timeout middleware.
+const requestTimeout = 60 * time.Second
+
+// extendDeadlines lets a request that moves a whole address book, such as an
+// import or an export, read and write for as long as its context lasts rather
+// than the few seconds the server gives other requests. Writers that cannot
+// change their deadlines, such as a ResponseRecorder, are left alone.
+func extendDeadlines(w http.ResponseWriter) error {
+	deadline := time.Now().Add(requestTimeout)
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(deadline)
+	if err == nil {
+		err = rc.SetWriteDeadline(deadline)
+	}
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
 func Serve(app *state.State) error {
 
 	srv := &http.Server{
@@ -24,6 +46,18 @@ func Serve(app *state.State) error {
 		WriteTimeout: 3 * time.Second,
 	}
 
+	workers := jobs.NewPool(app.Repository, app.Logger, JobHandlers(app), app.Config.JobWorkers, app.Config.JobPollInterval)
+	workers.Start(context.Background())
+
+	// A retention of 0 keeps deleted contacts in the trash forever.
+	purgerCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	if app.Config.TrashRetention > 0 && app.Config.TrashPurgeEvery > 0 {
+		app.Background(func() {
+			runTrashPurger(purgerCtx, app)
+		})
+	}
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -45,6 +79,8 @@ func Serve(app *state.State) error {
 		app.Logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
+		workers.Stop()
+		stopPurger()
 		app.Wg.Wait()
 		app.Repository.Close()
 		shutdownError <- nil
@@ -57,6 +93,7 @@ func Serve(app *state.State) error {
 
 	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
+		workers.Stop()
 		return err
 	}
 
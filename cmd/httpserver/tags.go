@@ -0,0 +1,299 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"strings"
+)
+
+type TagRequestPayload struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+// TagContactsPayload names the tags and contacts of a bulk tag or untag. Every
+// tag is given to or taken from every contact.
+type TagContactsPayload struct {
+	TagIDs     []uuid.UUID `json:"tag_ids" validate:"required,min=1,max=20"`
+	ContactIDs []uuid.UUID `json:"contact_ids" validate:"required,min=1,max=1000"`
+}
+
+type TagContactsResponse struct {
+	Changed int64 `json:"changed"` // Pairs that were not tagged, or untagged, already
+}
+
+// decodeTagPayload reads and validates the body of a tag create or rename.
+// The name is trimmed first, so "  team " and "team" are the same tag.
+func decodeTagPayload(app *state.State, w http.ResponseWriter, req *http.Request) (TagRequestPayload, bool) {
+	var payload TagRequestPayload
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"context": "Invalid JSON",
+		})
+		_ = ValidDataNotFound.WriteProblem(w, req, nil)
+		return payload, false
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if err := newValidator().Struct(payload); err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"context": "Invalid payload",
+		})
+		_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+		return payload, false
+	}
+	return payload, true
+}
+
+// tagErrorResponse is repositoryErrorResponse for tag writes, where the only
+// unique constraint is the name.
+func tagErrorResponse(err error) utils.ResponseState {
+	if errors.Is(err, repository.ErrUniqueViolation) {
+		return TagNameTaken
+	}
+	return repositoryErrorResponse(err, TagNotFound)
+}
+
+// HandlerGetTags lists the tags of the user with the number of live contacts
+// each one has.
+func HandlerGetTags(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		tags, err := app.Repository.GetTags(ctx, userID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching tags",
+			})
+			_ = repositoryErrorResponse(err, InternalError).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = TagsRetrieved.WriteToResponse(w, tags)
+	}
+}
+
+func HandlerCreateTag(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		payload, ok := decodeTagPayload(app, w, req)
+		if !ok {
+			return
+		}
+
+		tagID, err := uuid.NewV4()
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error generating UUID",
+			})
+			_ = InternalError.WriteProblem(w, req, nil)
+			return
+		}
+
+		tag := repository.Tag{ID: tagID, UserID: userID, Name: payload.Name}
+		if err = app.Repository.CreateTag(ctx, &tag); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error creating tag",
+			})
+			_ = tagErrorResponse(err).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = TagCreated.WriteToResponse(w, tag)
+	}
+}
+
+func HandlerGetTagByID(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		tagID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing tag ID",
+			})
+			_ = InvalidTagId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		tag, err := app.Repository.GetTagByID(ctx, userID, tagID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching tag",
+			})
+			_ = repositoryErrorResponse(err, TagNotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = TagsRetrieved.WriteToResponse(w, tag)
+	}
+}
+
+// HandlerRenameTag changes the name of a tag. The tag keeps its contacts.
+func HandlerRenameTag(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		tagID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing tag ID",
+			})
+			_ = InvalidTagId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		payload, ok := decodeTagPayload(app, w, req)
+		if !ok {
+			return
+		}
+
+		var tag *repository.Tag
+		err = app.Repository.InTx(ctx, func(ctx context.Context) error {
+			if err := app.Repository.RenameTag(ctx, userID, tagID, payload.Name); err != nil {
+				return err
+			}
+			tag, err = app.Repository.GetTagByID(ctx, userID, tagID)
+			return err
+		})
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error renaming tag",
+			})
+			_ = tagErrorResponse(err).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = TagUpdated.WriteToResponse(w, tag)
+	}
+}
+
+// HandlerDeleteTag deletes a tag. Its contacts lose the tag but are otherwise
+// left alone.
+func HandlerDeleteTag(app *state.State) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		tagID, err := uuid.FromString(chi.URLParam(req, "id"))
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing tag ID",
+			})
+			_ = InvalidTagId.WriteProblem(w, req, nil)
+			return
+		}
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		if err = app.Repository.DeleteTag(ctx, userID, tagID); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error deleting tag",
+			})
+			_ = repositoryErrorResponse(err, TagNotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandlerTagContacts gives every listed tag to every listed contact in one
+// transaction. Nothing is tagged unless all of them belong to the user.
+func HandlerTagContacts(app *state.State) http.HandlerFunc {
+	return handleTagContacts(app, app.Repository.TagContacts, ContactsTagged)
+}
+
+// HandlerUntagContacts takes every listed tag from every listed contact in one
+// transaction, failing like HandlerTagContacts.
+func HandlerUntagContacts(app *state.State) http.HandlerFunc {
+	return handleTagContacts(app, app.Repository.UntagContacts, ContactsUntagged)
+}
+
+func handleTagContacts(app *state.State, apply func(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) (int64, error), done utils.ResponseState) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID, err := GetUserUUIDFromContext(ctx)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error parsing UUID",
+			})
+			_ = InvalidUserId.WriteProblem(w, req, nil)
+			return
+		}
+
+		var payload TagContactsPayload
+		if err = json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid JSON",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
+		}
+		if err = newValidator().Struct(payload); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
+		}
+
+		changed, err := apply(ctx, userID, payload.TagIDs, payload.ContactIDs)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error tagging contacts",
+			})
+			_ = repositoryErrorResponse(err, TagTargetsNotFound).WriteProblem(w, req, nil)
+			return
+		}
+
+		_ = done.WriteToResponse(w, TagContactsResponse{Changed: changed})
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"github.com/go-chi/chi/v5"
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
+	"io"
+	"mime"
 	"net/http"
 )
 
+// HandlerPatchContactByID applies a JSON Merge Patch, or a JSON Patch when the
+// request is sent as application/json-patch+json, to a contact.
 func HandlerPatchContactByID(app *state.State) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -19,70 +24,115 @@ func HandlerPatchContactByID(app *state.State) http.HandlerFunc {
 			app.Logger.PrintError(err, map[string]string{
 				"context": "Error parsing contact ID",
 			})
-			_ = InvalidId.WriteToResponse(w, nil)
+			_ = InvalidId.WriteProblem(w, req, nil)
 			return
 		}
 		ctx := req.Context()
-
-		requestPayload := ContactRequestPayload{}
-		err = json.NewDecoder(req.Body).Decode(&requestPayload)
+		userID, err := GetUserUUIDFromContext(ctx)
 		if err != nil {
 			app.Logger.PrintError(err, map[string]string{
-				"context": "Invalid JSON",
+				"context": "Error parsing UUID",
 			})
-			_ = ValidDataNotFound.WriteToResponse(w, nil)
+			_ = InvalidUserId.WriteProblem(w, req, nil)
 			return
 		}
 
-		contact, err := app.Repository.GetContactByID(ctx, uuidContactID)
-		if err != nil {
-			_ = NotFound.WriteToResponse(w, nil)
+		var applyPatch func(contactDocument, []byte) (map[string]bool, error)
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch mediaType {
+		case "", "application/json", mergePatchMediaType:
+			applyPatch = applyMergePatch
+		case jsonPatchMediaType:
+			applyPatch = applyJSONPatch
+		default:
+			w.Header().Set("Accept-Patch", acceptPatch)
+			_ = UnsupportedMediaType.WriteProblem(w, req, nil)
 			return
 		}
 
-		if requestPayload.Phone != "" {
-			contact.Phone = requestPayload.Phone
+		body, err := io.ReadAll(req.Body)
+		if err == nil && !json.Valid(body) {
+			err = errors.New("malformed JSON")
 		}
-		if requestPayload.Street != "" {
-			contact.Street = requestPayload.Street
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid JSON",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			return
 		}
-		if requestPayload.City != "" {
-			contact.City = requestPayload.City
+
+		contact, err := app.Repository.GetContactByID(ctx, userID, uuidContactID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error fetching contact",
+			})
+			_ = repositoryErrorResponse(err, NotFound).WriteProblem(w, req, nil)
+			return
 		}
-		if requestPayload.State != "" {
-			contact.State = requestPayload.State
+
+		ifMatch := req.Header.Get("If-Match")
+		if ifMatch != "" && !etagMatches(ifMatch, versionETag(contact.Version), false) {
+			app.Logger.PrintError(repository.ErrPreconditionFailed, map[string]string{
+				"context": "If-Match does not match the contact",
+			})
+			_ = PreconditionFailed.WriteProblem(w, req, nil)
+			return
 		}
-		if requestPayload.ZipCode != "" {
-			contact.ZipCode = requestPayload.ZipCode
+
+		document := newContactDocument(contactPayload(contact))
+		touched, err := applyPatch(document, body)
+		var payload ContactRequestPayload
+		if err == nil {
+			payload, err = document.payload()
 		}
-		if requestPayload.Country != "" {
-			contact.Country = requestPayload.Country
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error applying patch",
+			})
+			var patchErr *patchError
+			switch {
+			case errors.Is(err, errPatchTestFailed):
+				_ = Conflict.WriteProblem(w, req, nil)
+			case errors.As(err, &patchErr):
+				_ = ValidDataNotFound.WriteProblem(w, req, []FieldError{FieldError(*patchErr)})
+			default:
+				_ = ValidDataNotFound.WriteProblem(w, req, nil)
+			}
+			return
 		}
 
-		updatedContact := repository.Contact{
-			Phone:   contact.Phone,
-			Street:  contact.Street,
-			City:    contact.City,
-			State:   contact.State,
-			ZipCode: contact.ZipCode,
-			Country: contact.Country,
+		if err = payload.syncAndValidatePatch(newValidator(), app.Config.PhoneRegion, touched["phones"], touched["addresses"], touched); err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Invalid payload",
+			})
+			_ = ValidDataNotFound.WriteProblem(w, req, fieldErrors(err))
+			return
 		}
 
-		err = app.Repository.PatchContactByID(ctx, uuidContactID, &updatedContact)
+		patch := payload.contactPatch(touched)
+		patch.Version = contact.Version
+
+		// The update only applies to the version read above, so a concurrent
+		// write in between is reported instead of silently overwritten. A patch
+		// that touches no field leaves the contact as it is.
+		if len(touched) > 0 {
+			err = app.Repository.PatchContactByID(ctx, userID, uuidContactID, &patch)
+		}
 		if err != nil {
-			_ = InternalError.WriteToResponse(w, err)
+			app.Logger.PrintError(err, map[string]string{
+				"context": "Error updating contact",
+			})
+			response := repositoryErrorResponse(err, NotFound)
+			if errors.Is(err, repository.ErrPreconditionFailed) && ifMatch == "" {
+				response = Conflict
+			}
+			_ = response.WriteProblem(w, req, nil)
 			return
 		}
-		response := ContactResponse{
-			ID:      contactID,
-			Phone:   contact.Phone,
-			Street:  contact.Street,
-			City:    contact.City,
-			State:   contact.State,
-			ZipCode: contact.ZipCode,
-			Country: contact.Country,
-		}
+		response := payload.response(contactID)
 
+		w.Header().Set("ETag", versionETag(patch.Version))
 		_ = ContactUpdated.WriteToResponse(w, response)
 		return
 	}
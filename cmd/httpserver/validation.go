@@ -0,0 +1,101 @@
+package httpserver
+
+import (
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"go_chi_pgx/geo"
+	utils "go_chi_pgx/utils"
+	"reflect"
+	"strings"
+)
+
+// FieldError describes why a single field of a payload was rejected. It is
+// reported in the errors of the problem details of a failed request.
+type FieldError = utils.FieldError
+
+// newValidator returns a validator that reports fields by their JSON names,
+// which are the names clients actually send.
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterStructValidation(validateContact, ContactRequestPayload{})
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return validate
+}
+
+// fieldErrors turns the error of validate.Struct into one FieldError per
+// failed field.
+func fieldErrors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []FieldError{{Message: err.Error()}}
+	}
+
+	result := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		result = append(result, FieldError{Field: fieldPath(fe), Message: fieldErrorMessage(fe)})
+	}
+	return result
+}
+
+// fieldPath names a field by its JSON path, such as phones[1].number, without
+// the name of the payload struct.
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at most %s entries", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "min":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at least %s entries", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "phone":
+		if fe.Param() == "" {
+			return "must be a valid phone number with its country code"
+		}
+		return "must be a valid phone number for " + fe.Param()
+	case "country":
+		return "must be a country name or ISO 3166-1 code"
+	case "subdivision":
+		return "must be a state or other subdivision of " + countryName(fe.Param())
+	case "postcode":
+		if example := geo.PostalCodeExample(fe.Param()); example != "" {
+			return fmt.Sprintf("must be a postal code of %s, such as %s", countryName(fe.Param()), example)
+		}
+		return "must be a postal code of " + countryName(fe.Param())
+	case "unique":
+		return "must not repeat an entry"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
+
+// countryName is the English name of the country with the alpha-2 code code.
+func countryName(code string) string {
+	if country, ok := geo.LookupCountry(code); ok {
+		return country.Name
+	}
+	return code
+}
@@ -0,0 +1,73 @@
+//go:build ignore
+
+// gen writes countries.tsv and subdivisions.tsv from the JSON files of the
+// iso-codes project (https://salsa.debian.org/iso-codes-team/iso-codes),
+// which most Linux distributions install under /usr/share/iso-codes/json.
+//
+//	go run gen.go /usr/share/iso-codes/json
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run gen.go <iso-codes json directory>")
+	}
+	dir := os.Args[1]
+
+	var countries struct {
+		Entries []map[string]string `json:"3166-1"`
+	}
+	read(filepath.Join(dir, "iso_3166-1.json"), &countries)
+	write("data/countries.tsv", countries.Entries, "alpha_2", "alpha_3", "numeric", "name", "official_name", "common_name")
+
+	var subdivisions struct {
+		Entries []map[string]string `json:"3166-2"`
+	}
+	read(filepath.Join(dir, "iso_3166-2.json"), &subdivisions)
+	write("data/subdivisions.tsv", subdivisions.Entries, "code", "name", "type", "parent")
+}
+
+func read(path string, v any) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+}
+
+// write stores entries sorted by their first column, one per line with the
+// given columns separated by tabs.
+func write(path string, entries []map[string]string, columns ...string) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i][columns[0]] < entries[j][columns[0]] })
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = strings.TrimSpace(entry[column])
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
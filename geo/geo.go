@@ -0,0 +1,421 @@
+// Package geo knows the countries and subdivisions of ISO 3166 and the postal
+// code format of the countries that have a fixed one, so addresses can be
+// checked and stored in a canonical form.
+//
+// countries.tsv and subdivisions.tsv are generated by gen.go from the
+// iso-codes project, which is licensed under the LGPL 2.1 or later.
+// postal_codes.tsv is kept by hand: the alpha-2 code of a country, an
+// example postal code and the regular expression every postal code of the
+// country matches.
+package geo
+
+//go:generate go run gen.go /usr/share/iso-codes/json
+
+import (
+	_ "embed"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	//go:embed data/countries.tsv
+	countriesTSV string
+	//go:embed data/subdivisions.tsv
+	subdivisionsTSV string
+	//go:embed data/postal_codes.tsv
+	postalCodesTSV string
+)
+
+// Country is a country of ISO 3166-1.
+type Country struct {
+	Code    string // Alpha-2 code, such as "US", which is how contacts store it
+	Alpha3  string // Alpha-3 code, such as "USA"
+	Numeric string // Numeric code, such as "840"
+	Name    string // Short English name, such as "United States"
+}
+
+// Subdivision is a state, province or other subdivision of ISO 3166-2.
+type Subdivision struct {
+	Code string // Code with its country, such as "US-CA"
+	Name string // Name in the language of the country, such as "Bayern"
+	Type string // Such as "State" or "Province"
+}
+
+// Short is the code without its country, such as "CA" for "US-CA", which is
+// how addresses write it and how contacts store it.
+func (s Subdivision) Short() string {
+	_, short, _ := strings.Cut(s.Code, "-")
+	return short
+}
+
+// postalCode is the format of the postal codes of a country.
+type postalCode struct {
+	example string
+	pattern *regexp.Regexp
+}
+
+type tables struct {
+	countries    map[string]Country        // By every code, name and alias, as keys
+	subdivisions map[string][]Subdivision  // By alpha-2 code of their country
+	lookup       map[string]map[string]int // By country, then by key of code or name, indexes into subdivisions
+	postalCodes  map[string]postalCode     // By alpha-2 code
+}
+
+// countryAliases are names people use for a country that are neither its ISO
+// name nor its official name.
+var countryAliases = map[string]string{
+	"uk":                               "GB",
+	"britain":                          "GB",
+	"great britain":                    "GB",
+	"england":                          "GB",
+	"scotland":                         "GB",
+	"wales":                            "GB",
+	"northern ireland":                 "GB",
+	"america":                          "US",
+	"russia":                           "RU",
+	"turkey":                           "TR",
+	"holland":                          "NL",
+	"czech republic":                   "CZ",
+	"brunei":                           "BN",
+	"ivory coast":                      "CI",
+	"cape verde":                       "CV",
+	"vatican":                          "VA",
+	"vatican city":                     "VA",
+	"macedonia":                        "MK",
+	"swaziland":                        "SZ",
+	"palestine":                        "PS",
+	"micronesia":                       "FM",
+	"dr congo":                         "CD",
+	"democratic republic of the congo": "CD",
+	"republic of the congo":            "CG",
+}
+
+// subdivisionAliases are names people use for a subdivision, by the alpha-2
+// code of its country, that are not its ISO name: mostly English names, as
+// ISO 3166-2 names subdivisions in the language of their country, and the
+// names the ISO data writes with an alternative in brackets.
+var subdivisionAliases = map[string]map[string]string{
+	"AT": {
+		"carinthia":     "2",
+		"lower austria": "3",
+		"upper austria": "4",
+		"styria":        "6",
+		"tyrol":         "7",
+		"vienna":        "9",
+	},
+	"BE": {
+		"brussels":         "BRU",
+		"bruxelles":        "BRU",
+		"flanders":         "VLG",
+		"wallonia":         "WAL",
+		"antwerp":          "VAN",
+		"flemish brabant":  "VBR",
+		"east flanders":    "VOV",
+		"west flanders":    "VWV",
+		"walloon brabant":  "WBR",
+		"brussels capital": "BRU",
+	},
+	"CH": {
+		"berne":        "BE",
+		"basel city":   "BS",
+		"basel land":   "BL",
+		"fribourg":     "FR",
+		"geneva":       "GE",
+		"grisons":      "GR",
+		"lucerne":      "LU",
+		"st gallen":    "SG",
+		"saint gallen": "SG",
+	},
+	"CN": {
+		"anhui":          "AH",
+		"beijing":        "BJ",
+		"chongqing":      "CQ",
+		"fujian":         "FJ",
+		"gansu":          "GS",
+		"guangdong":      "GD",
+		"guangxi":        "GX",
+		"guizhou":        "GZ",
+		"hainan":         "HI",
+		"hebei":          "HE",
+		"heilongjiang":   "HL",
+		"henan":          "HA",
+		"hong kong":      "HK",
+		"hubei":          "HB",
+		"hunan":          "HN",
+		"inner mongolia": "NM",
+		"jiangsu":        "JS",
+		"jiangxi":        "JX",
+		"jilin":          "JL",
+		"liaoning":       "LN",
+		"macao":          "MO",
+		"macau":          "MO",
+		"ningxia":        "NX",
+		"qinghai":        "QH",
+		"shaanxi":        "SN",
+		"shandong":       "SD",
+		"shanghai":       "SH",
+		"shanxi":         "SX",
+		"sichuan":        "SC",
+		"tianjin":        "TJ",
+		"tibet":          "XZ",
+		"xinjiang":       "XJ",
+		"xizang":         "XZ",
+		"yunnan":         "YN",
+		"zhejiang":       "ZJ",
+	},
+	"CZ": {
+		"prague": "10",
+		"praha":  "10",
+	},
+	"DE": {
+		"baden wuerttemberg":            "BW",
+		"bavaria":                       "BY",
+		"hesse":                         "HE",
+		"lower saxony":                  "NI",
+		"mecklenburg western pomerania": "MV",
+		"north rhine westphalia":        "NW",
+		"rhineland palatinate":          "RP",
+		"saxony":                        "SN",
+		"saxony anhalt":                 "ST",
+		"thuringia":                     "TH",
+	},
+	"ES": {
+		"a coruna":          "C",
+		"la coruna":         "C",
+		"alicante":          "A",
+		"alacant":           "A",
+		"andalusia":         "AN",
+		"araba":             "VI",
+		"alava":             "VI",
+		"balearic islands":  "PM",
+		"barcelona":         "B",
+		"basque country":    "PV",
+		"biscay":            "BI",
+		"vizcaya":           "BI",
+		"canary islands":    "CN",
+		"castellon":         "CS",
+		"castello":          "CS",
+		"castile and leon":  "CL",
+		"castile la mancha": "CM",
+		"catalonia":         "CT",
+		"cataluna":          "CT",
+		"galicia":           "GA",
+		"gerona":            "GI",
+		"girona":            "GI",
+		"guipuzcoa":         "SS",
+		"lerida":            "L",
+		"lleida":            "L",
+		"lugo":              "LU",
+		"navarra":           "NA",
+		"navarre":           "NA",
+		"orense":            "OR",
+		"ourense":           "OR",
+		"pontevedra":        "PO",
+		"seville":           "SE",
+		"tarragona":         "T",
+	},
+	"GB": {
+		"wales": "WLS",
+	},
+	"GR": {
+		"attica":            "I",
+		"central macedonia": "B",
+		"crete":             "M",
+	},
+	"IN": {
+		"orissa":      "OR",
+		"pondicherry": "PY",
+		"uttaranchal": "UT",
+	},
+	"IT": {
+		"aosta valley": "23",
+		"apulia":       "75",
+		"lombardy":     "25",
+		"piedmont":     "21",
+		"sardinia":     "88",
+		"sicily":       "82",
+		"south tyrol":  "BZ",
+		"tuscany":      "52",
+		"florence":     "FI",
+		"genoa":        "GE",
+		"milan":        "MI",
+		"naples":       "NA",
+		"rome":         "RM",
+		"turin":        "TO",
+		"venice":       "VE",
+	},
+	"MX": {
+		"cdmx":             "CMX",
+		"mexico city":      "CMX",
+		"state of mexico":  "MEX",
+		"estado de mexico": "MEX",
+		"coahuila":         "COA",
+		"michoacan":        "MIC",
+		"veracruz":         "VER",
+	},
+	"NL": {
+		"friesland":     "FR",
+		"north brabant": "NB",
+		"north holland": "NH",
+		"south holland": "ZH",
+	},
+	"PL": {
+		"greater poland": "30",
+		"lesser poland":  "12",
+		"lodz":           "10",
+		"lower silesia":  "02",
+		"masovia":        "14",
+		"pomerania":      "22",
+		"silesia":        "24",
+	},
+	"RU": {
+		"moscow":             "MOW",
+		"москва":             "MOW",
+		"moscow oblast":      "MOS",
+		"moscow region":      "MOS",
+		"saint petersburg":   "SPE",
+		"st petersburg":      "SPE",
+		"санкт петербург":    "SPE",
+		"leningrad oblast":   "LEN",
+		"bashkortostan":      "BA",
+		"chechnya":           "CE",
+		"dagestan":           "DA",
+		"krasnodar krai":     "KDA",
+		"novosibirsk oblast": "NVS",
+		"sverdlovsk oblast":  "SVE",
+		"tatarstan":          "TA",
+	},
+	"UA": {
+		"kiev": "30",
+	},
+}
+
+var data = sync.OnceValue(func() *tables {
+	t := &tables{
+		countries:    make(map[string]Country),
+		subdivisions: make(map[string][]Subdivision),
+		lookup:       make(map[string]map[string]int),
+		postalCodes:  make(map[string]postalCode),
+	}
+
+	for _, fields := range rows(countriesTSV) {
+		country := Country{Code: fields[0], Alpha3: fields[1], Numeric: fields[2], Name: fields[3]}
+		for _, name := range fields {
+			if name != "" {
+				t.countries[key(name)] = country
+			}
+		}
+	}
+	for alias, code := range countryAliases {
+		t.countries[alias] = t.countries[key(code)]
+	}
+
+	for _, fields := range rows(subdivisionsTSV) {
+		subdivision := Subdivision{Code: fields[0], Name: fields[1], Type: fields[2]}
+		country, _, _ := strings.Cut(subdivision.Code, "-")
+		t.subdivisions[country] = append(t.subdivisions[country], subdivision)
+	}
+	for country, subdivisions := range t.subdivisions {
+		lookup := make(map[string]int)
+		for i, subdivision := range subdivisions {
+			lookup[key(subdivision.Code)] = i
+			lookup[key(subdivision.Short())] = i
+		}
+		// Names come second, so a code never gives way to the name of
+		// another subdivision.
+		for i, subdivision := range subdivisions {
+			if _, taken := lookup[key(subdivision.Name)]; !taken {
+				lookup[key(subdivision.Name)] = i
+			}
+		}
+		for alias, short := range subdivisionAliases[country] {
+			if _, taken := lookup[alias]; !taken {
+				lookup[alias] = lookup[key(short)]
+			}
+		}
+		t.lookup[country] = lookup
+	}
+
+	for _, fields := range rows(postalCodesTSV) {
+		t.postalCodes[fields[0]] = postalCode{
+			example: fields[1],
+			pattern: regexp.MustCompile(`^(?:` + fields[2] + `)$`),
+		}
+	}
+	return t
+})
+
+// rows splits a TSV file into lines of fields.
+func rows(tsv string) [][]string {
+	var result [][]string
+	for _, line := range strings.Split(strings.TrimSpace(tsv), "\n") {
+		result = append(result, strings.Split(line, "\t"))
+	}
+	return result
+}
+
+// foldMarks removes accents, so "Cote d'Ivoire" finds "Côte d'Ivoire".
+var foldMarks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// key is how codes and names are compared: case, accents, punctuation, a
+// leading "the" and runs of spaces do not matter.
+func key(s string) string {
+	folded, _, err := transform.String(foldMarks, s)
+	if err != nil {
+		folded = s
+	}
+	words := strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// LookupCountry finds a country by its alpha-2, alpha-3 or numeric code, by
+// its short, official or common English name, or by a few everyday names
+// such as "UK".
+func LookupCountry(s string) (Country, bool) {
+	country, ok := data().countries[key(s)]
+	return country, ok
+}
+
+// HasSubdivisions tells whether ISO 3166-2 lists subdivisions for the
+// country with the alpha-2 code country.
+func HasSubdivisions(country string) bool {
+	return len(data().subdivisions[strings.ToUpper(country)]) > 0
+}
+
+// LookupSubdivision finds a subdivision of the country with the alpha-2 code
+// country by its code, with or without the country, by its name, or by a
+// common English name such as "Bavaria".
+func LookupSubdivision(country, s string) (Subdivision, bool) {
+	country = strings.ToUpper(country)
+	i, ok := data().lookup[country][key(s)]
+	if !ok {
+		return Subdivision{}, false
+	}
+	return data().subdivisions[country][i], true
+}
+
+// NormalizePostalCode returns postal code in upper case with single spaces,
+// and whether it has the format of the country with the alpha-2 code
+// country. Postal codes of countries without a known format are always
+// accepted.
+func NormalizePostalCode(country, code string) (string, bool) {
+	code = strings.ToUpper(strings.Join(strings.Fields(code), " "))
+	format, ok := data().postalCodes[strings.ToUpper(country)]
+	return code, !ok || format.pattern.MatchString(code)
+}
+
+// PostalCodeExample returns a postal code of the country with the alpha-2
+// code country, or "" when its format is not known.
+func PostalCodeExample(country string) string {
+	return data().postalCodes[strings.ToUpper(country)].example
+}
@@ -0,0 +1,205 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultMaxAttempts is how often a job is tried before it is dead-lettered.
+const DefaultMaxAttempts = 5
+
+// Handler runs a single job. Returning an error schedules a retry unless the
+// error is wrapped with Permanent.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Handlers maps a job kind to the handler that runs it.
+type Handlers map[string]Handler
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; the job is dead-lettered at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// NewJob builds a job of the given kind with payload encoded as JSON.
+func NewJob(kind string, payload any) (*repository.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &repository.Job{
+		Kind:        kind,
+		Payload:     data,
+		MaxAttempts: DefaultMaxAttempts,
+	}, nil
+}
+
+// Backoff returns the delay before the next try of a job that has failed
+// attempt times: 2^attempt seconds with up to 25% jitter, capped at one hour.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 12 {
+		attempt = 12
+	}
+	delay := time.Duration(1<<attempt) * time.Second
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay/4) + 1))
+	return delay + jitter
+}
+
+// Pool claims jobs from the repository and runs them on a fixed number of
+// worker goroutines.
+type Pool struct {
+	repo         repository.Repository
+	logger       *state.Logger
+	handlers     Handlers
+	workers      int
+	pollInterval time.Duration
+	jobTimeout   time.Duration
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+func NewPool(repo repository.Repository, logger *state.Logger, handlers Handlers, workers int, pollInterval time.Duration) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{
+		repo:         repo,
+		logger:       logger,
+		handlers:     handlers,
+		workers:      workers,
+		pollInterval: pollInterval,
+		jobTimeout:   time.Minute,
+	}
+}
+
+// Start launches the workers. They keep polling until Stop is called.
+func (p *Pool) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(ctx)
+		}()
+	}
+}
+
+// Stop tells the workers to stop claiming jobs and waits for the jobs they are
+// running to finish.
+func (p *Pool) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+func (p *Pool) work(ctx context.Context) {
+	for {
+		processed, err := p.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			p.logger.PrintError(err, map[string]string{
+				"context": "claiming jobs",
+			})
+		}
+		if processed && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.pollInterval):
+		}
+	}
+}
+
+// RunOnce claims and runs at most one job. It reports whether a job was found.
+func (p *Pool) RunOnce(ctx context.Context) (bool, error) {
+	claimed, err := p.repo.ClaimJobs(ctx, 1, 5*p.jobTimeout)
+	if err != nil || len(claimed) == 0 {
+		return false, err
+	}
+
+	// A claimed job runs to completion even if the pool is being stopped.
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.jobTimeout)
+	defer cancel()
+
+	p.run(jobCtx, claimed[0])
+	return true, nil
+}
+
+func (p *Pool) run(ctx context.Context, job repository.Job) {
+	properties := map[string]string{
+		"job_id":   fmt.Sprint(job.ID),
+		"job_kind": job.Kind,
+		"attempt":  fmt.Sprint(job.Attempts),
+	}
+
+	// ClaimJobs dead-letters lost jobs that used up their attempts, so this
+	// only guards against a job that is claimed past them anyway.
+	if job.Attempts > job.MaxAttempts {
+		properties["context"] = "running job"
+		p.logger.PrintError(errors.New(repository.JobWorkerLost), properties)
+		if err := p.repo.FailJob(ctx, job.ID, repository.JobWorkerLost, nil); err != nil {
+			p.logger.PrintError(err, properties)
+		}
+		return
+	}
+
+	err := p.execute(ctx, job)
+	if err == nil {
+		if err = p.repo.CompleteJob(ctx, job.ID); err != nil {
+			p.logger.PrintError(err, properties)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	var permanent permanentError
+	if !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+		next := time.Now().Add(Backoff(job.Attempts))
+		retryAt = &next
+	}
+
+	properties["context"] = "running job"
+	p.logger.PrintError(err, properties)
+
+	if err = p.repo.FailJob(ctx, job.ID, err.Error(), retryAt); err != nil {
+		p.logger.PrintError(err, properties)
+	}
+}
+
+func (p *Pool) execute(ctx context.Context, job repository.Job) (err error) {
+	handler, ok := p.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
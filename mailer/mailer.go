@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer delivers an email rendered from one of the embedded templates.
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// Message is a rendered email ready to be handed to a transport.
+type Message struct {
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Render executes the "subject", "plainBody" and "htmlBody" blocks of the
+// named template.
+func Render(recipient, templateFile string, data any) (*Message, error) {
+	textTmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err = textTmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return nil, err
+	}
+
+	// The HTML body goes through html/template so that values are escaped.
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxMailer is the development mailer. It renders emails exactly like
+// SMTPMailer but writes them to .eml files in dir, or to out when dir is empty,
+// instead of delivering them.
+type OutboxMailer struct {
+	dir    string
+	out    io.Writer
+	sender string
+	mu     sync.Mutex
+}
+
+func NewOutbox(dir string, out io.Writer, sender string) *OutboxMailer {
+	return &OutboxMailer{
+		dir:    dir,
+		out:    out,
+		sender: sender,
+	}
+}
+
+func (m *OutboxMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := Render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := buildMIME(m.sender, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.dir == "" {
+		_, err = fmt.Fprintf(m.out, "%s\n", body)
+		return err
+	}
+
+	if err = os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.TrimSuffix(filepath.Base(templateFile), filepath.Ext(templateFile)))
+	return os.WriteFile(filepath.Join(m.dir, name), body, 0o644)
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTPMailer sends email through an SMTP relay.
+type SMTPMailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+func NewSMTP(host string, port int, username, password, sender string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr:   net.JoinHostPort(host, strconv.Itoa(port)),
+		auth:   auth,
+		sender: sender,
+	}
+}
+
+// Send renders the template and delivers it in a single attempt; the email
+// jobs that call it are retried with backoff by the job queue.
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := Render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := buildMIME(m.sender, msg)
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.sender)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	return smtp.SendMail(m.addr, m.auth, from.Address, []string{recipient}, body)
+}
@@ -0,0 +1,13 @@
+CREATE TABLE refresh_tokens (
+  id UUID PRIMARY KEY,                                  -- Token ID, carried as the JWT "jti" claim
+  user_id UUID NOT NULL,                                -- Foreign key to users table
+  family_id UUID NOT NULL,                              -- All tokens rotated from the same login share a family
+  replaced_by UUID,                                     -- Token issued when this one was rotated
+  expires_at TIMESTAMPTZ NOT NULL,                      -- Expiry timestamp
+  revoked_at TIMESTAMPTZ,                               -- Set on logout or when reuse is detected
+  created_at TIMESTAMPTZ DEFAULT NOW(),                 -- Created timestamp
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE -- Foreign key constraint
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
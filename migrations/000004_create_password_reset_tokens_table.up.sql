@@ -0,0 +1,10 @@
+CREATE TABLE password_reset_tokens (
+  token_hash BYTEA PRIMARY KEY,                         -- SHA-256 of the token sent to the user
+  user_id UUID NOT NULL,                                -- Foreign key to users table
+  expires_at TIMESTAMPTZ NOT NULL,                      -- Expiry timestamp
+  used_at TIMESTAMPTZ,                                  -- Set once the token has been redeemed or superseded
+  created_at TIMESTAMPTZ DEFAULT NOW(),                 -- Created timestamp
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE -- Foreign key constraint
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
@@ -0,0 +1,16 @@
+CREATE TABLE jobs (
+  id BIGSERIAL PRIMARY KEY,                             -- Job ID
+  kind VARCHAR(100) NOT NULL,                           -- Selects the handler that runs the job
+  payload JSONB NOT NULL DEFAULT '{}',                  -- Handler input
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',        -- pending, running, done or dead
+  attempts INT NOT NULL DEFAULT 0,                      -- Number of times the job was claimed
+  max_attempts INT NOT NULL DEFAULT 5,                  -- Attempts before the job is dead-lettered
+  run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),            -- Earliest time the job may run
+  locked_at TIMESTAMPTZ,                                -- When a worker claimed the job
+  last_error TEXT,                                      -- Error of the latest failed attempt
+  created_at TIMESTAMPTZ DEFAULT NOW(),                 -- Created timestamp
+  updated_at TIMESTAMPTZ DEFAULT NOW()                  -- Updated timestamp
+);
+
+CREATE INDEX jobs_pending_run_at_idx ON jobs (run_at) WHERE status = 'pending';
+CREATE INDEX jobs_running_locked_at_idx ON jobs (locked_at) WHERE status = 'running';
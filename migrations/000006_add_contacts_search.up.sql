@@ -0,0 +1,23 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE contacts
+  -- Lower-cased concatenation of the searchable fields, used for trigram matching
+  ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+    lower(
+      coalesce(phone, '') || ' ' ||
+      coalesce(street, '') || ' ' ||
+      coalesce(city, '') || ' ' ||
+      coalesce(state, '') || ' ' ||
+      coalesce(zip_code, '') || ' ' ||
+      coalesce(country, '')
+    )
+  ) STORED,
+  -- Weighted full-text document: phone ranks highest, then place names, then the rest
+  ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(phone, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(city, '') || ' ' || coalesce(country, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(street, '') || ' ' || coalesce(state, '') || ' ' || coalesce(zip_code, '')), 'C')
+  ) STORED;
+
+CREATE INDEX contacts_search_vector_idx ON contacts USING GIN (search_vector);
+CREATE INDEX contacts_search_text_trgm_idx ON contacts USING GIN (search_text gin_trgm_ops);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS contacts_user_created_at_id_idx;
+ALTER TABLE contacts ALTER COLUMN created_at DROP NOT NULL;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Keyset pagination compares (created_at, id) row values, which never match NULL
+UPDATE contacts SET created_at = NOW() WHERE created_at IS NULL;
+ALTER TABLE contacts ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX contacts_user_created_at_id_idx ON contacts (user_id, created_at, id);
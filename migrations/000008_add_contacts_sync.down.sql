@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS contacts_clear_tombstone ON contacts;
+DROP TRIGGER IF EXISTS contacts_record_tombstone ON contacts;
+DROP TRIGGER IF EXISTS contacts_bump_sync_seq ON contacts;
+DROP FUNCTION IF EXISTS contacts_clear_tombstone();
+DROP FUNCTION IF EXISTS contacts_record_tombstone();
+DROP FUNCTION IF EXISTS contacts_bump_sync_seq();
+DROP FUNCTION IF EXISTS contacts_sync_lock(UUID);
+DROP TABLE IF EXISTS contact_tombstones;
+DROP INDEX IF EXISTS contacts_user_sync_seq_idx;
+ALTER TABLE contacts DROP COLUMN IF EXISTS dav_name, DROP COLUMN IF EXISTS sync_seq;
+DROP SEQUENCE IF EXISTS contacts_sync_seq;
\ No newline at end of file
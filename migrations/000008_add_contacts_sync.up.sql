@@ -0,0 +1,64 @@
+-- One counter shared by all users: every write to a contact takes the next
+-- value, so "everything above N" is a cheap change feed for CardDAV sync
+CREATE SEQUENCE contacts_sync_seq;
+
+ALTER TABLE contacts
+  ADD COLUMN sync_seq BIGINT NOT NULL DEFAULT nextval('contacts_sync_seq'), -- Bumped on every write, backs ETags and sync tokens
+  ADD COLUMN dav_name VARCHAR(255);                                      -- Resource name picked by a CardDAV client, NULL means "<id>.vcf"
+
+CREATE INDEX contacts_user_sync_seq_idx ON contacts (user_id, sync_seq);
+
+-- Deleted contacts, kept so sync can tell clients what disappeared. No foreign
+-- key on user_id: rows are written while a user's contacts are cascade deleted.
+CREATE TABLE contact_tombstones (
+  contact_id UUID PRIMARY KEY,                                              -- ID of the deleted contact
+  user_id UUID NOT NULL,                                                    -- Owner of the deleted contact
+  dav_name VARCHAR(255),                                                    -- Resource name the contact was synced under
+  sync_seq BIGINT NOT NULL DEFAULT nextval('contacts_sync_seq'),            -- Position of the deletion in the change feed
+  deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()                             -- Deleted timestamp
+);
+
+CREATE INDEX contact_tombstones_user_sync_seq_idx ON contact_tombstones (user_id, sync_seq);
+
+-- Writers hold a shared per-user lock until they commit and readers of the
+-- change feed take it exclusively, so a reader never hands out a sync token
+-- past a sequence value that an in-flight transaction may still commit.
+CREATE FUNCTION contacts_sync_lock(owner UUID) RETURNS void AS $$
+BEGIN
+  PERFORM pg_advisory_xact_lock_shared(hashtextextended(owner::text, 0));
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION contacts_bump_sync_seq() RETURNS trigger AS $$
+BEGIN
+  PERFORM contacts_sync_lock(NEW.user_id);
+  NEW.sync_seq := nextval('contacts_sync_seq');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION contacts_record_tombstone() RETURNS trigger AS $$
+BEGIN
+  PERFORM contacts_sync_lock(OLD.user_id);
+  INSERT INTO contact_tombstones (contact_id, user_id, dav_name)
+  VALUES (OLD.id, OLD.user_id, OLD.dav_name)
+  ON CONFLICT (contact_id) DO UPDATE
+  SET user_id = EXCLUDED.user_id, dav_name = EXCLUDED.dav_name,
+      sync_seq = nextval('contacts_sync_seq'), deleted_at = NOW();
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION contacts_clear_tombstone() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM contact_tombstones WHERE contact_id = NEW.id;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER contacts_bump_sync_seq BEFORE INSERT OR UPDATE ON contacts
+  FOR EACH ROW EXECUTE FUNCTION contacts_bump_sync_seq();
+CREATE TRIGGER contacts_record_tombstone AFTER DELETE ON contacts
+  FOR EACH ROW EXECUTE FUNCTION contacts_record_tombstone();
+CREATE TRIGGER contacts_clear_tombstone AFTER INSERT ON contacts
+  FOR EACH ROW EXECUTE FUNCTION contacts_clear_tombstone();
@@ -0,0 +1,2 @@
+ALTER TABLE contacts
+  ADD COLUMN version INTEGER NOT NULL DEFAULT 1; -- Bumped on every update, sent to clients as the ETag
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS contacts_deleted_at_idx;
+DROP INDEX IF EXISTS contacts_user_deleted_at_idx;
+ALTER TABLE contacts DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
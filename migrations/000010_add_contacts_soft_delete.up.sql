@@ -0,0 +1,6 @@
+ALTER TABLE contacts
+  ADD COLUMN deleted_at TIMESTAMPTZ; -- Set when the contact is moved to the trash, NULL while it is live
+
+-- The trash listing and the purger only ever look at deleted rows
+CREATE INDEX contacts_user_deleted_at_idx ON contacts (user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX contacts_deleted_at_idx ON contacts (deleted_at) WHERE deleted_at IS NOT NULL;
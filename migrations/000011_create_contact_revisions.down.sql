@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS contacts_record_revision ON contacts;
+DROP FUNCTION IF EXISTS contacts_record_revision();
+DROP FUNCTION IF EXISTS contacts_revision_data(contacts);
+DROP TABLE IF EXISTS contact_revisions;
\ No newline at end of file
@@ -0,0 +1,52 @@
+-- Every write to a contact adds a revision in the same transaction, numbered
+-- by the version the write left the contact at
+CREATE TABLE contact_revisions (
+  contact_id UUID NOT NULL,                             -- Contact the revision belongs to
+  revision INTEGER NOT NULL,                            -- contacts.version after the change
+  operation VARCHAR(20) NOT NULL,                       -- create, update, delete, restore or snapshot
+  changed_by UUID NOT NULL,                             -- User whose request made the change
+  data JSONB NOT NULL,                                  -- Contact fields after the change
+  changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),        -- Changed timestamp
+  PRIMARY KEY (contact_id, revision),
+  FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE -- Purged contacts take their history with them
+);
+
+-- The fields a revision records, keyed by their JSON names
+CREATE FUNCTION contacts_revision_data(c contacts) RETURNS jsonb AS $$
+  SELECT jsonb_build_object(
+    'phone', c.phone,
+    'street', c.street,
+    'city', c.city,
+    'state', c.state,
+    'zip_code', c.zip_code,
+    'country', c.country
+  );
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION contacts_record_revision() RETURNS trigger AS $$
+DECLARE
+  op VARCHAR(20) := 'update';
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    op := 'create';
+  ELSIF OLD.version = NEW.version THEN
+    RETURN NULL;
+  ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+    op := 'delete';
+  ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+    op := 'restore';
+  END IF;
+
+  INSERT INTO contact_revisions (contact_id, revision, operation, changed_by, data)
+  VALUES (NEW.id, NEW.version, op, NEW.user_id, contacts_revision_data(NEW));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER contacts_record_revision AFTER INSERT OR UPDATE ON contacts
+  FOR EACH ROW EXECUTE FUNCTION contacts_record_revision();
+
+-- Existing contacts start their history from their current state
+INSERT INTO contact_revisions (contact_id, revision, operation, changed_by, data, changed_at)
+SELECT id, version, 'snapshot', user_id, contacts_revision_data(contacts), COALESCE(updated_at, NOW())
+FROM contacts;
@@ -0,0 +1,18 @@
+DROP TRIGGER IF EXISTS contacts_record_revision ON contacts;
+CREATE TRIGGER contacts_record_revision AFTER INSERT OR UPDATE ON contacts
+  FOR EACH ROW EXECUTE FUNCTION contacts_record_revision();
+
+CREATE OR REPLACE FUNCTION contacts_revision_data(c contacts) RETURNS jsonb AS $$
+  SELECT jsonb_build_object(
+    'phone', c.phone,
+    'street', c.street,
+    'city', c.city,
+    'state', c.state,
+    'zip_code', c.zip_code,
+    'country', c.country
+  );
+$$ LANGUAGE sql STABLE;
+
+DROP TABLE IF EXISTS contact_addresses;
+DROP TABLE IF EXISTS contact_emails;
+DROP TABLE IF EXISTS contact_phones;
\ No newline at end of file
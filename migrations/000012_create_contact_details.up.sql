@@ -0,0 +1,103 @@
+-- A contact has any number of labeled phones, emails and postal addresses. The
+-- flat phone and address columns of contacts keep mirroring the primary phone
+-- and address, so single-field clients keep working
+CREATE TABLE contact_phones (
+  contact_id UUID NOT NULL,                             -- Contact the phone belongs to
+  position INTEGER NOT NULL,                            -- Order the client listed the phones in
+  label VARCHAR(20) NOT NULL,                           -- mobile, work, home or other
+  number VARCHAR(20) NOT NULL,                          -- Phone number
+  is_primary BOOLEAN NOT NULL DEFAULT FALSE,            -- Mirrored into contacts.phone
+  PRIMARY KEY (contact_id, position),
+  FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE contact_emails (
+  contact_id UUID NOT NULL,                             -- Contact the email belongs to
+  position INTEGER NOT NULL,                            -- Order the client listed the emails in
+  label VARCHAR(20) NOT NULL,                           -- home, work or other
+  address VARCHAR(254) NOT NULL,                        -- Email address
+  is_primary BOOLEAN NOT NULL DEFAULT FALSE,            -- Preferred email
+  PRIMARY KEY (contact_id, position),
+  FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE contact_addresses (
+  contact_id UUID NOT NULL,                             -- Contact the address belongs to
+  position INTEGER NOT NULL,                            -- Order the client listed the addresses in
+  label VARCHAR(20) NOT NULL,                           -- home, work or other
+  street VARCHAR(100) NOT NULL DEFAULT '',              -- Street address
+  city VARCHAR(50) NOT NULL DEFAULT '',                 -- City
+  state VARCHAR(50) NOT NULL DEFAULT '',                -- State
+  zip_code VARCHAR(20) NOT NULL DEFAULT '',             -- Zip code
+  country VARCHAR(50) NOT NULL DEFAULT '',              -- Country
+  is_primary BOOLEAN NOT NULL DEFAULT FALSE,            -- Mirrored into the contacts address columns
+  PRIMARY KEY (contact_id, position),
+  FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE
+);
+
+-- At most one primary entry of each kind per contact
+CREATE UNIQUE INDEX contact_phones_primary_idx ON contact_phones (contact_id) WHERE is_primary;
+CREATE UNIQUE INDEX contact_emails_primary_idx ON contact_emails (contact_id) WHERE is_primary;
+CREATE UNIQUE INDEX contact_addresses_primary_idx ON contact_addresses (contact_id) WHERE is_primary;
+
+-- Existing contacts get their flat phone and address as the primary entries
+INSERT INTO contact_phones (contact_id, position, label, number, is_primary)
+SELECT id, 0, 'mobile', phone, TRUE
+FROM contacts
+WHERE COALESCE(phone, '') <> '';
+
+INSERT INTO contact_addresses (contact_id, position, label, street, city, state, zip_code, country, is_primary)
+SELECT id, 0, 'home', COALESCE(street, ''), COALESCE(city, ''), COALESCE(state, ''), COALESCE(zip_code, ''), COALESCE(country, ''), TRUE
+FROM contacts
+WHERE COALESCE(street, '') || COALESCE(city, '') || COALESCE(state, '') || COALESCE(zip_code, '') || COALESCE(country, '') <> '';
+
+-- Revisions record the lists too
+CREATE OR REPLACE FUNCTION contacts_revision_data(c contacts) RETURNS jsonb AS $$
+  SELECT jsonb_build_object(
+    'phone', c.phone,
+    'street', c.street,
+    'city', c.city,
+    'state', c.state,
+    'zip_code', c.zip_code,
+    'country', c.country,
+    'phones', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'number', number, 'primary', is_primary) ORDER BY position), '[]')
+               FROM contact_phones WHERE contact_id = c.id),
+    'emails', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'address', address, 'primary', is_primary) ORDER BY position), '[]')
+               FROM contact_emails WHERE contact_id = c.id),
+    'addresses', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'street', street, 'city', city, 'state', state,
+                                                               'zip_code', zip_code, 'country', country, 'primary', is_primary) ORDER BY position), '[]')
+                  FROM contact_addresses WHERE contact_id = c.id)
+  );
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION contacts_record_revision() RETURNS trigger AS $$
+DECLARE
+  op VARCHAR(20) := 'update';
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    op := 'create';
+  ELSIF OLD.version = NEW.version THEN
+    RETURN NULL;
+  ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+    op := 'delete';
+  ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+    op := 'restore';
+  END IF;
+
+  -- The contact may have been purged later in the same transaction.
+  IF NOT EXISTS (SELECT 1 FROM contacts WHERE id = NEW.id) THEN
+    RETURN NULL;
+  END IF;
+
+  INSERT INTO contact_revisions (contact_id, revision, operation, changed_by, data)
+  VALUES (NEW.id, NEW.version, op, NEW.user_id, contacts_revision_data(NEW));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- The lists are written after the contacts row, so the revision is taken at
+-- commit to see them
+DROP TRIGGER contacts_record_revision ON contacts;
+CREATE CONSTRAINT TRIGGER contacts_record_revision AFTER INSERT OR UPDATE ON contacts
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION contacts_record_revision();
@@ -0,0 +1,52 @@
+DROP INDEX IF EXISTS contacts_user_family_name_idx;
+
+CREATE OR REPLACE FUNCTION contacts_revision_data(c contacts) RETURNS jsonb AS $$
+  SELECT jsonb_build_object(
+    'phone', c.phone,
+    'street', c.street,
+    'city', c.city,
+    'state', c.state,
+    'zip_code', c.zip_code,
+    'country', c.country,
+    'phones', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'number', number, 'primary', is_primary) ORDER BY position), '[]')
+               FROM contact_phones WHERE contact_id = c.id),
+    'emails', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'address', address, 'primary', is_primary) ORDER BY position), '[]')
+               FROM contact_emails WHERE contact_id = c.id),
+    'addresses', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'street', street, 'city', city, 'state', state,
+                                                               'zip_code', zip_code, 'country', country, 'primary', is_primary) ORDER BY position), '[]')
+                  FROM contact_addresses WHERE contact_id = c.id)
+  );
+$$ LANGUAGE sql STABLE;
+
+DROP INDEX IF EXISTS contacts_search_text_trgm_idx;
+DROP INDEX IF EXISTS contacts_search_vector_idx;
+ALTER TABLE contacts DROP COLUMN IF EXISTS search_vector, DROP COLUMN IF EXISTS search_text;
+
+ALTER TABLE contacts
+  ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+    lower(
+      coalesce(phone, '') || ' ' ||
+      coalesce(street, '') || ' ' ||
+      coalesce(city, '') || ' ' ||
+      coalesce(state, '') || ' ' ||
+      coalesce(zip_code, '') || ' ' ||
+      coalesce(country, '')
+    )
+  ) STORED,
+  ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(phone, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(city, '') || ' ' || coalesce(country, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(street, '') || ' ' || coalesce(state, '') || ' ' || coalesce(zip_code, '')), 'C')
+  ) STORED;
+
+CREATE INDEX contacts_search_vector_idx ON contacts USING GIN (search_vector);
+CREATE INDEX contacts_search_text_trgm_idx ON contacts USING GIN (search_text gin_trgm_ops);
+
+ALTER TABLE contacts
+  DROP COLUMN IF EXISTS notes,
+  DROP COLUMN IF EXISTS job_title,
+  DROP COLUMN IF EXISTS company,
+  DROP COLUMN IF EXISTS nickname,
+  DROP COLUMN IF EXISTS display_name,
+  DROP COLUMN IF EXISTS family_name,
+  DROP COLUMN IF EXISTS given_name;
\ No newline at end of file
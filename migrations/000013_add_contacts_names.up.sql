@@ -0,0 +1,74 @@
+ALTER TABLE contacts
+  ADD COLUMN given_name VARCHAR(100) NOT NULL DEFAULT '',   -- First name
+  ADD COLUMN family_name VARCHAR(100) NOT NULL DEFAULT '',  -- Last name
+  ADD COLUMN display_name VARCHAR(200) NOT NULL DEFAULT '', -- Name to show, when not just given and family name
+  ADD COLUMN nickname VARCHAR(100) NOT NULL DEFAULT '',     -- Nickname
+  ADD COLUMN company VARCHAR(200) NOT NULL DEFAULT '',      -- Organization the contact works for
+  ADD COLUMN job_title VARCHAR(100) NOT NULL DEFAULT '',    -- Job title at the company
+  ADD COLUMN notes TEXT NOT NULL DEFAULT '';                -- Free-form notes
+
+-- Generated columns cannot take a new expression, so search is rebuilt to
+-- cover the new fields
+DROP INDEX contacts_search_text_trgm_idx;
+DROP INDEX contacts_search_vector_idx;
+ALTER TABLE contacts DROP COLUMN search_vector, DROP COLUMN search_text;
+
+ALTER TABLE contacts
+  -- Lower-cased concatenation of the searchable fields, used for trigram matching
+  ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+    lower(
+      given_name || ' ' ||
+      family_name || ' ' ||
+      display_name || ' ' ||
+      nickname || ' ' ||
+      company || ' ' ||
+      job_title || ' ' ||
+      coalesce(phone, '') || ' ' ||
+      coalesce(street, '') || ' ' ||
+      coalesce(city, '') || ' ' ||
+      coalesce(state, '') || ' ' ||
+      coalesce(zip_code, '') || ' ' ||
+      coalesce(country, '') || ' ' ||
+      notes
+    )
+  ) STORED,
+  -- Weighted full-text document: names and phone rank highest, then the
+  -- company and place names, then the rest of the address, then the notes
+  ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', given_name || ' ' || family_name || ' ' || display_name || ' ' || nickname || ' ' || coalesce(phone, '')), 'A') ||
+    setweight(to_tsvector('simple', company || ' ' || job_title || ' ' || coalesce(city, '') || ' ' || coalesce(country, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(street, '') || ' ' || coalesce(state, '') || ' ' || coalesce(zip_code, '')), 'C') ||
+    setweight(to_tsvector('simple', notes), 'D')
+  ) STORED;
+
+CREATE INDEX contacts_search_vector_idx ON contacts USING GIN (search_vector);
+CREATE INDEX contacts_search_text_trgm_idx ON contacts USING GIN (search_text gin_trgm_ops);
+
+-- Revisions record the new fields too
+CREATE OR REPLACE FUNCTION contacts_revision_data(c contacts) RETURNS jsonb AS $$
+  SELECT jsonb_build_object(
+    'given_name', c.given_name,
+    'family_name', c.family_name,
+    'display_name', c.display_name,
+    'nickname', c.nickname,
+    'company', c.company,
+    'job_title', c.job_title,
+    'notes', c.notes,
+    'phone', c.phone,
+    'street', c.street,
+    'city', c.city,
+    'state', c.state,
+    'zip_code', c.zip_code,
+    'country', c.country,
+    'phones', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'number', number, 'primary', is_primary) ORDER BY position), '[]')
+               FROM contact_phones WHERE contact_id = c.id),
+    'emails', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'address', address, 'primary', is_primary) ORDER BY position), '[]')
+               FROM contact_emails WHERE contact_id = c.id),
+    'addresses', (SELECT COALESCE(jsonb_agg(jsonb_build_object('label', label, 'street', street, 'city', city, 'state', state,
+                                                               'zip_code', zip_code, 'country', country, 'primary', is_primary) ORDER BY position), '[]')
+                  FROM contact_addresses WHERE contact_id = c.id)
+  );
+$$ LANGUAGE sql STABLE;
+
+-- Name sorts only look at live contacts
+CREATE INDEX contacts_user_family_name_idx ON contacts (user_id, family_name, given_name) WHERE deleted_at IS NULL;
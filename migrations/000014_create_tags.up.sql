@@ -0,0 +1,23 @@
+-- Tags group a user's contacts by team, customer, project or anything else
+CREATE TABLE tags (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),       -- Unique ID for each tag
+  user_id UUID NOT NULL,                                -- Foreign key to users table
+  name VARCHAR(50) NOT NULL,                            -- Tag name, unique per user ignoring case
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),        -- Created timestamp
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),        -- Updated timestamp
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX tags_user_name_idx ON tags (user_id, lower(name));
+
+CREATE TABLE contact_tags (
+  contact_id UUID NOT NULL,                             -- Tagged contact
+  tag_id UUID NOT NULL,                                 -- Tag given to the contact
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),        -- Tagged timestamp
+  PRIMARY KEY (contact_id, tag_id),
+  FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE,
+  FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+-- Listing the contacts of a tag and counting them for facets
+CREATE INDEX contact_tags_tag_idx ON contact_tags (tag_id, contact_id);
@@ -0,0 +1,14 @@
+DELETE FROM jobs WHERE kind = 'backfill_phone_e164' AND status IN ('pending', 'running');
+
+CREATE OR REPLACE FUNCTION contacts_bump_sync_seq() RETURNS trigger AS $$
+BEGIN
+  PERFORM contacts_sync_lock(NEW.user_id);
+  NEW.sync_seq := nextval('contacts_sync_seq');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS contacts_user_phone_e164_idx;
+DROP INDEX IF EXISTS contact_phones_e164_trgm_idx;
+ALTER TABLE contact_phones DROP COLUMN IF EXISTS number_e164;
+ALTER TABLE contacts DROP COLUMN IF EXISTS phone_e164;
@@ -0,0 +1,26 @@
+-- Phone numbers are kept as typed and in E.164, which is what search and
+-- duplicate detection compare. Numbers stored before validation get theirs
+-- from the backfill_phone_e164 job queued below, parsed the same way new
+-- numbers are; those that don't parse keep ''
+ALTER TABLE contacts ADD COLUMN phone_e164 VARCHAR(16) NOT NULL DEFAULT '';      -- contacts.phone in E.164
+ALTER TABLE contact_phones ADD COLUMN number_e164 VARCHAR(16) NOT NULL DEFAULT ''; -- number in E.164
+
+-- Writes that only fill in columns CardDAV clients never see, like the E.164
+-- backfill, set contacts.keep_sync_seq for their transaction so the contacts
+-- keep their place in the change feed and clients don't resync them all
+CREATE OR REPLACE FUNCTION contacts_bump_sync_seq() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' AND current_setting('contacts.keep_sync_seq', true) = 'on' THEN
+    RETURN NEW;
+  END IF;
+  PERFORM contacts_sync_lock(NEW.user_id);
+  NEW.sync_seq := nextval('contacts_sync_seq');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+INSERT INTO jobs (kind) VALUES ('backfill_phone_e164');
+
+-- Searching by a fragment of a number, in any formatting
+CREATE INDEX contact_phones_e164_trgm_idx ON contact_phones USING GIN (number_e164 gin_trgm_ops);
+CREATE INDEX contacts_user_phone_e164_idx ON contacts (user_id, phone_e164) WHERE phone_e164 <> '';
@@ -0,0 +1,30 @@
+CREATE OR REPLACE FUNCTION contacts_record_revision() RETURNS trigger AS $$
+DECLARE
+  op VARCHAR(20) := 'update';
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    op := 'create';
+  ELSIF OLD.version = NEW.version THEN
+    RETURN NULL;
+  ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+    op := 'delete';
+  ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+    op := 'restore';
+  END IF;
+
+  -- The contact may have been purged later in the same transaction.
+  IF NOT EXISTS (SELECT 1 FROM contacts WHERE id = NEW.id) THEN
+    RETURN NULL;
+  END IF;
+
+  INSERT INTO contact_revisions (contact_id, revision, operation, changed_by, data)
+  VALUES (NEW.id, NEW.version, op, NEW.user_id, contacts_revision_data(NEW));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS contact_merge_sources;
+DROP TABLE IF EXISTS contact_merges;
+DROP INDEX IF EXISTS contact_phones_e164_idx;
+DROP INDEX IF EXISTS contacts_dedupe_name_trgm_idx;
+ALTER TABLE contacts DROP COLUMN IF EXISTS dedupe_address, DROP COLUMN IF EXISTS dedupe_name;
\ No newline at end of file
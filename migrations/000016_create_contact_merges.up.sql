@@ -0,0 +1,71 @@
+-- What duplicate detection compares: the name a contact goes by and its
+-- primary street address, lower-cased
+ALTER TABLE contacts
+  ADD COLUMN dedupe_name TEXT GENERATED ALWAYS AS (
+    lower(CASE WHEN given_name = '' AND family_name = '' THEN display_name ELSE btrim(given_name || ' ' || family_name) END)
+  ) STORED,
+  ADD COLUMN dedupe_address TEXT GENERATED ALWAYS AS (
+    lower(btrim(coalesce(street, '') || ' ' || coalesce(city, '') || ' ' || coalesce(zip_code, '')))
+  ) STORED;
+
+CREATE INDEX contacts_dedupe_name_trgm_idx ON contacts USING GIN (dedupe_name gin_trgm_ops) WHERE deleted_at IS NULL;
+-- Contacts sharing a number, however it was typed
+CREATE INDEX contact_phones_e164_idx ON contact_phones (number_e164) WHERE number_e164 <> '';
+
+-- Every merge of contacts into a survivor, written in the same transaction
+CREATE TABLE contact_merges (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),       -- Unique ID for each merge
+  user_id UUID NOT NULL,                                -- Owner of the contacts
+  survivor_id UUID NOT NULL,                            -- Contact the others were merged into
+  survivor_revision INTEGER NOT NULL,                   -- Revision of the survivor the merge wrote
+  fields JSONB NOT NULL,                                -- Contact each field was taken from, by JSON name
+  merged_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),         -- Merged timestamp
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (survivor_id) REFERENCES contacts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX contact_merges_survivor_idx ON contact_merges (survivor_id, survivor_revision);
+
+-- The contacts a merge moved to the trash. Their data is kept here, as their
+-- revisions go when the trash is purged
+CREATE TABLE contact_merge_sources (
+  merge_id UUID NOT NULL,                               -- Merge the contact was part of
+  contact_id UUID NOT NULL,                             -- Contact merged into the survivor
+  revision INTEGER NOT NULL,                            -- Revision of the contact that moved it to the trash
+  data JSONB NOT NULL,                                  -- Contact fields when it was merged
+  PRIMARY KEY (merge_id, contact_id),
+  FOREIGN KEY (merge_id) REFERENCES contact_merges(id) ON DELETE CASCADE
+);
+
+CREATE INDEX contact_merge_sources_contact_idx ON contact_merge_sources (contact_id, revision);
+
+-- Revisions written by a merge say so. The trigger runs at commit, after the
+-- merge has been recorded
+CREATE OR REPLACE FUNCTION contacts_record_revision() RETURNS trigger AS $$
+DECLARE
+  op VARCHAR(20) := 'update';
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    op := 'create';
+  ELSIF OLD.version = NEW.version THEN
+    RETURN NULL;
+  ELSIF EXISTS (SELECT 1 FROM contact_merges WHERE survivor_id = NEW.id AND survivor_revision = NEW.version) THEN
+    op := 'merge';
+  ELSIF EXISTS (SELECT 1 FROM contact_merge_sources WHERE contact_id = NEW.id AND revision = NEW.version) THEN
+    op := 'merged';
+  ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+    op := 'delete';
+  ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+    op := 'restore';
+  END IF;
+
+  -- The contact may have been purged later in the same transaction.
+  IF NOT EXISTS (SELECT 1 FROM contacts WHERE id = NEW.id) THEN
+    RETURN NULL;
+  END IF;
+
+  INSERT INTO contact_revisions (contact_id, revision, operation, changed_by, data)
+  VALUES (NEW.id, NEW.version, op, NEW.user_id, contacts_revision_data(NEW));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
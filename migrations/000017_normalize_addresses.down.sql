@@ -0,0 +1 @@
+DELETE FROM jobs WHERE kind = 'normalize_addresses' AND status IN ('pending', 'running');
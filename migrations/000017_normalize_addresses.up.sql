@@ -0,0 +1,6 @@
+-- Addresses stored before they were validated get ISO 3166 countries and
+-- subdivisions and canonical zip codes from the normalize_addresses job, so
+-- filtering by country code finds them. Contacts it rewrites take a new
+-- version, recorded as a revision, and a new sync_seq, as REST and CardDAV
+-- clients see the new addresses
+INSERT INTO jobs (kind) VALUES ('normalize_addresses');
@@ -5,12 +5,18 @@ import (
 	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/mock"
 	"go_chi_pgx/repository"
+	"time"
 )
 
 type MockRepository struct {
 	mock.Mock
 }
 
+// InTx runs fn directly; the mock has no transactions to manage.
+func (m *MockRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
 func (m *MockRepository) GetUserByEmail(ctx context.Context, email string) (*repository.User, error) {
 	args := m.Called(ctx, email)
 	return args.Get(0).(*repository.User), args.Error(1)
@@ -26,8 +32,8 @@ func (m *MockRepository) ActivateUserByID(ctx context.Context, userID uuid.UUID)
 	return args.Error(0)
 }
 
-func (m *MockRepository) GetAllContacts(ctx context.Context, userID uuid.UUID, limit, offset int) ([]repository.Contact, error) {
-	args := m.Called(ctx, userID, limit, offset)
+func (m *MockRepository) GetAllContacts(ctx context.Context, userID uuid.UUID, filter repository.ContactFilter, limit, offset int) ([]repository.Contact, error) {
+	args := m.Called(ctx, userID, filter, limit, offset)
 
 	// Ensure args.Get(0) is a non-nil and correct type ([]repository.Contact)
 	if contacts, ok := args.Get(0).([]repository.Contact); ok && contacts != nil {
@@ -36,34 +42,236 @@ func (m *MockRepository) GetAllContacts(ctx context.Context, userID uuid.UUID, l
 	return nil, args.Error(1)
 }
 
+func (m *MockRepository) GetContactsPage(ctx context.Context, userID uuid.UUID, filter repository.ContactFilter, key *repository.ContactKeyset, limit int) ([]repository.Contact, error) {
+	args := m.Called(ctx, userID, filter, key, limit)
+	if contacts, ok := args.Get(0).([]repository.Contact); ok && contacts != nil {
+		return contacts, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockRepository) CreateContact(ctx context.Context, contact *repository.Contact) error {
 	args := m.Called(ctx, contact)
 	return args.Error(0)
 }
 
-func (m *MockRepository) GetContactByID(ctx context.Context, contactID uuid.UUID) (*repository.ContactWithUserResponse, error) {
-	args := m.Called(ctx, contactID)
+func (m *MockRepository) CopyContacts(ctx context.Context, contacts []repository.Contact) (int64, error) {
+	args := m.Called(ctx, contacts)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// StreamContacts feeds the contacts given to Return to fn before returning
+// the configured error.
+func (m *MockRepository) StreamContacts(ctx context.Context, userID uuid.UUID, filter repository.ContactFilter, fn func(*repository.Contact) error) error {
+	args := m.Called(ctx, userID, filter)
+	contacts, _ := args.Get(0).([]repository.Contact)
+	for i := range contacts {
+		if err := fn(&contacts[i]); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockRepository) GetContactByID(ctx context.Context, userID, contactID uuid.UUID) (*repository.ContactWithUserResponse, error) {
+	args := m.Called(ctx, userID, contactID)
 	if contact, ok := args.Get(0).(*repository.ContactWithUserResponse); ok {
 		return contact, args.Error(1)
 	}
 	return nil, args.Error(1)
 }
 
-func (m *MockRepository) PatchContactByID(ctx context.Context, contactID uuid.UUID, contact *repository.Contact) error {
-	args := m.Called(ctx, contactID, contact)
+func (m *MockRepository) PatchContactByID(ctx context.Context, userID, contactID uuid.UUID, patch *repository.ContactPatch) error {
+	args := m.Called(ctx, userID, contactID, patch)
 	return args.Error(0)
 }
 
-func (m *MockRepository) DeleteContactByID(ctx context.Context, contactID uuid.UUID) error {
-	args := m.Called(ctx, contactID)
+func (m *MockRepository) DeleteContactByID(ctx context.Context, userID, contactID uuid.UUID) error {
+	args := m.Called(ctx, userID, contactID)
 	return args.Error(0)
 }
 
-func (m *MockRepository) GetContactsCount(ctx context.Context, userID uuid.UUID) (int, error) {
-	args := m.Called(ctx, userID)
+func (m *MockRepository) RestoreContactByID(ctx context.Context, userID, contactID uuid.UUID) error {
+	args := m.Called(ctx, userID, contactID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PurgeDeletedContacts(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	args := m.Called(ctx, deletedBefore, limit)
+	purged, _ := args.Get(0).(int64)
+	return purged, args.Error(1)
+}
+
+func (m *MockRepository) GetContactRevisions(ctx context.Context, userID, contactID uuid.UUID) ([]repository.ContactRevision, error) {
+	args := m.Called(ctx, userID, contactID)
+	revisions, _ := args.Get(0).([]repository.ContactRevision)
+	return revisions, args.Error(1)
+}
+
+func (m *MockRepository) GetContactRevision(ctx context.Context, userID, contactID uuid.UUID, revision int) (*repository.ContactRevision, error) {
+	args := m.Called(ctx, userID, contactID, revision)
+	result, _ := args.Get(0).(*repository.ContactRevision)
+	return result, args.Error(1)
+}
+
+func (m *MockRepository) GetContactsCount(ctx context.Context, userID uuid.UUID, filter repository.ContactFilter) (int, error) {
+	args := m.Called(ctx, userID, filter)
 	return args.Int(0), args.Error(1)
 }
 
+func (m *MockRepository) GetContactObject(ctx context.Context, userID, contactID uuid.UUID) (*repository.Contact, error) {
+	args := m.Called(ctx, userID, contactID)
+	if contact, ok := args.Get(0).(*repository.Contact); ok {
+		return contact, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockRepository) PutContactObject(ctx context.Context, contact *repository.Contact, cond repository.ContactPrecondition) (bool, error) {
+	args := m.Called(ctx, contact, cond)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetContactsSyncSeq(ctx context.Context, userID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, userID)
+	seq, _ := args.Get(0).(int64)
+	return seq, args.Error(1)
+}
+
+func (m *MockRepository) GetContactChanges(ctx context.Context, userID uuid.UUID, since int64, limit int) (*repository.ContactChanges, error) {
+	args := m.Called(ctx, userID, since, limit)
+	if changes, ok := args.Get(0).(*repository.ContactChanges); ok {
+		return changes, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockRepository) GetPhonesWithoutE164(ctx context.Context, after uuid.UUID, limit int) ([]repository.PhoneBackfill, error) {
+	args := m.Called(ctx, after, limit)
+	phones, _ := args.Get(0).([]repository.PhoneBackfill)
+	return phones, args.Error(1)
+}
+
+func (m *MockRepository) SetPhonesE164(ctx context.Context, phones []repository.PhoneBackfill) error {
+	args := m.Called(ctx, phones)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetAddressesToNormalize(ctx context.Context, after uuid.UUID, limit int) ([]repository.AddressBackfill, error) {
+	args := m.Called(ctx, after, limit)
+	addresses, _ := args.Get(0).([]repository.AddressBackfill)
+	return addresses, args.Error(1)
+}
+
+func (m *MockRepository) SetNormalizedAddresses(ctx context.Context, addresses []repository.AddressBackfill) error {
+	args := m.Called(ctx, addresses)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetTags(ctx context.Context, userID uuid.UUID) ([]repository.Tag, error) {
+	args := m.Called(ctx, userID)
+	tags, _ := args.Get(0).([]repository.Tag)
+	return tags, args.Error(1)
+}
+
+func (m *MockRepository) GetTagByID(ctx context.Context, userID, tagID uuid.UUID) (*repository.Tag, error) {
+	args := m.Called(ctx, userID, tagID)
+	tag, _ := args.Get(0).(*repository.Tag)
+	return tag, args.Error(1)
+}
+
+func (m *MockRepository) CreateTag(ctx context.Context, tag *repository.Tag) error {
+	args := m.Called(ctx, tag)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RenameTag(ctx context.Context, userID, tagID uuid.UUID, name string) error {
+	args := m.Called(ctx, userID, tagID, name)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteTag(ctx context.Context, userID, tagID uuid.UUID) error {
+	args := m.Called(ctx, userID, tagID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) TagContacts(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) (int64, error) {
+	args := m.Called(ctx, userID, tagIDs, contactIDs)
+	tagged, _ := args.Get(0).(int64)
+	return tagged, args.Error(1)
+}
+
+func (m *MockRepository) UntagContacts(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) (int64, error) {
+	args := m.Called(ctx, userID, tagIDs, contactIDs)
+	untagged, _ := args.Get(0).(int64)
+	return untagged, args.Error(1)
+}
+
+func (m *MockRepository) GetTagFacets(ctx context.Context, userID uuid.UUID, filter repository.ContactFilter) ([]repository.TagFacet, error) {
+	args := m.Called(ctx, userID, filter)
+	facets, _ := args.Get(0).([]repository.TagFacet)
+	return facets, args.Error(1)
+}
+
+func (m *MockRepository) FindDuplicateContacts(ctx context.Context, userID uuid.UUID, limit int) ([]repository.DuplicateMatch, error) {
+	args := m.Called(ctx, userID, limit)
+	matches, _ := args.Get(0).([]repository.DuplicateMatch)
+	return matches, args.Error(1)
+}
+
+func (m *MockRepository) MergeContacts(ctx context.Context, merge *repository.ContactMerge, survivor *repository.ContactPatch, mergedVersions []int) error {
+	args := m.Called(ctx, merge, survivor, mergedVersions)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CreateRefreshToken(ctx context.Context, token *repository.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RotateRefreshToken(ctx context.Context, tokenID uuid.UUID, next *repository.RefreshToken) error {
+	args := m.Called(ctx, tokenID, next)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RevokeRefreshTokenFamily(ctx context.Context, tokenID uuid.UUID) error {
+	args := m.Called(ctx, tokenID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CreatePasswordResetToken(ctx context.Context, token *repository.PasswordResetToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ResetPassword(ctx context.Context, tokenHash []byte, passwordHash string) error {
+	args := m.Called(ctx, tokenHash, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockRepository) EnqueueJob(ctx context.Context, job *repository.Job) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ClaimJobs(ctx context.Context, limit int, lockTimeout time.Duration) ([]repository.Job, error) {
+	args := m.Called(ctx, limit, lockTimeout)
+	if jobs, ok := args.Get(0).([]repository.Job); ok {
+		return jobs, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockRepository) CompleteJob(ctx context.Context, jobID int64) error {
+	args := m.Called(ctx, jobID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) FailJob(ctx context.Context, jobID int64, jobErr string, retryAt *time.Time) error {
+	args := m.Called(ctx, jobID, jobErr, retryAt)
+	return args.Error(0)
+}
+
 func (m *MockRepository) Close() {
 
 }
@@ -0,0 +1,80 @@
+// Package phone turns phone numbers as people type them into E.164, the
+// canonical form the contacts store next to the raw input.
+package phone
+
+import (
+	"github.com/nyaruka/phonenumbers"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalid is returned by Normalize for input that is not a valid phone
+// number in the region it was parsed for.
+var ErrInvalid = errors.New("invalid phone number")
+
+// dialable matches what people write a phone number with: digits, spacing and
+// punctuation, optionally followed by an extension such as "ext. 12" or "x12".
+// Letters, emoji and anything else are rejected rather than guessed at.
+var dialable = regexp.MustCompile(`^\s*\+?[\d\s\-().\/]+(?:(?i:ext\.?|x|#)\s*\d{1,6})?\s*$`)
+
+// Region returns the region a contact's numbers are parsed for: country when
+// it is a region code known to the numbering plan, such as "US" or "de", and
+// fallback otherwise.
+func Region(country, fallback string) string {
+	if code := strings.ToUpper(strings.TrimSpace(country)); phonenumbers.GetSupportedRegions()[code] {
+		return code
+	}
+	return strings.ToUpper(fallback)
+}
+
+// Normalize parses raw as dialled from region and returns it in E.164, such
+// as +12175550100. Numbers written with their country code, like
+// "+44 20 7946 0958", parse the same in every region. The number must be
+// valid, not just the right length, so "123" and "(555) 123" are rejected.
+// Extensions are accepted but not part of the E.164 form.
+func Normalize(raw, region string) (string, error) {
+	if !dialable.MatchString(raw) {
+		return "", ErrInvalid
+	}
+	number, err := phonenumbers.Parse(raw, strings.ToUpper(region))
+	if err != nil {
+		return "", errors.Wrap(ErrInvalid, err.Error())
+	}
+	if !phonenumbers.IsValidNumber(number) {
+		return "", ErrInvalid
+	}
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// SearchDigits returns the digits to look for in E.164 numbers when term looks
+// like all or part of a phone number, and "" for anything else, such as a name
+// or a street with a house number. Leading zeros are dropped, since trunk and
+// international prefixes like the 0 of "030 123456" or the 00 of "0049" are
+// not part of E.164.
+func SearchDigits(term string) string {
+	if !dialable.MatchString(term) {
+		return ""
+	}
+	digits := strings.TrimLeft(Digits(term), "0")
+	if len(digits) < minSearchDigits {
+		return ""
+	}
+	return digits
+}
+
+// minSearchDigits keeps short numbers in a search from matching most of the
+// address book.
+const minSearchDigits = 4
+
+// Digits returns the ASCII digits of s, which is how numbers are compared
+// regardless of formatting.
+func Digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
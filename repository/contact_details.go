@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// contactDetailColumns select the phones, emails and addresses of a contacts
+// row as JSON arrays, so listing contacts loads them in the same query
+// instead of one query per contact. They scan into the Contact lists.
+const contactDetailColumns = `
+	(SELECT COALESCE(json_agg(json_build_object('label', p.label, 'number', p.number, 'e164', p.number_e164, 'primary', p.is_primary) ORDER BY p.position), '[]')
+	 FROM contact_phones p WHERE p.contact_id = contacts.id),
+	(SELECT COALESCE(json_agg(json_build_object('label', e.label, 'address', e.address, 'primary', e.is_primary) ORDER BY e.position), '[]')
+	 FROM contact_emails e WHERE e.contact_id = contacts.id),
+	(SELECT COALESCE(json_agg(json_build_object('label', a.label, 'street', a.street, 'city', a.city, 'state', a.state,
+	                                            'zip_code', a.zip_code, 'country', a.country, 'primary', a.is_primary) ORDER BY a.position), '[]')
+	 FROM contact_addresses a WHERE a.contact_id = contacts.id)`
+
+// hasContactDetails reports whether writing contact touches any list.
+func hasContactDetails(contact *Contact) bool {
+	return contact.Phones != nil || contact.Emails != nil || contact.Addresses != nil
+}
+
+// replaceContactDetails replaces each non-nil list of a contact. Callers run
+// it in the transaction that writes the contacts row.
+func (repo *PgxRepository) replaceContactDetails(ctx context.Context, contactID uuid.UUID, phones []ContactPhone, emails []ContactEmail, addresses []ContactAddress) error {
+	if phones != nil {
+		if _, err := repo.conn(ctx).Exec(ctx, `DELETE FROM contact_phones WHERE contact_id = $1`, contactID); err != nil {
+			return mapError(err)
+		}
+	}
+	if emails != nil {
+		if _, err := repo.conn(ctx).Exec(ctx, `DELETE FROM contact_emails WHERE contact_id = $1`, contactID); err != nil {
+			return mapError(err)
+		}
+	}
+	if addresses != nil {
+		if _, err := repo.conn(ctx).Exec(ctx, `DELETE FROM contact_addresses WHERE contact_id = $1`, contactID); err != nil {
+			return mapError(err)
+		}
+	}
+	return repo.copyContactDetails(ctx, []Contact{{ID: contactID, Phones: phones, Emails: emails, Addresses: addresses}})
+}
+
+// copyContactDetails inserts the lists of contacts with the COPY protocol,
+// one statement per kind of list.
+func (repo *PgxRepository) copyContactDetails(ctx context.Context, contacts []Contact) error {
+	var phones, emails, addresses [][]any
+	for _, c := range contacts {
+		for i, p := range c.Phones {
+			phones = append(phones, []any{c.ID, i, p.Label, p.Number, p.E164, p.Primary})
+		}
+		for i, e := range c.Emails {
+			emails = append(emails, []any{c.ID, i, e.Label, e.Address, e.Primary})
+		}
+		for i, a := range c.Addresses {
+			addresses = append(addresses, []any{c.ID, i, a.Label, a.Street, a.City, a.State, a.ZipCode, a.Country, a.Primary})
+		}
+	}
+
+	for _, list := range []struct {
+		table   string
+		columns []string
+		rows    [][]any
+	}{
+		{"contact_phones", []string{"contact_id", "position", "label", "number", "number_e164", "is_primary"}, phones},
+		{"contact_emails", []string{"contact_id", "position", "label", "address", "is_primary"}, emails},
+		{"contact_addresses", []string{"contact_id", "position", "label", "street", "city", "state", "zip_code", "country", "is_primary"}, addresses},
+	} {
+		if len(list.rows) == 0 {
+			continue
+		}
+		if _, err := repo.conn(ctx).CopyFrom(ctx, pgx.Identifier{list.table}, list.columns, pgx.CopyFromRows(list.rows)); err != nil {
+			return mapError(err)
+		}
+	}
+	return nil
+}
+
+// GetPhonesWithoutE164 returns the numbers without an E.164 form of up to limit
+// contacts, the first ones by ID after the contact after, so a backfill can
+// walk all contacts in batches.
+func (repo *PgxRepository) GetPhonesWithoutE164(ctx context.Context, after uuid.UUID, limit int) ([]PhoneBackfill, error) {
+	query := `
+		SELECT p.contact_id, p.position, p.number, c.country
+		FROM contact_phones p
+		JOIN contacts c ON c.id = p.contact_id
+		WHERE p.number_e164 = '' AND p.number <> '' AND p.contact_id IN (
+			SELECT DISTINCT contact_id
+			FROM contact_phones
+			WHERE number_e164 = '' AND number <> '' AND contact_id > $1
+			ORDER BY contact_id
+			LIMIT $2
+		)
+		ORDER BY p.contact_id, p.position`
+
+	rows, err := repo.conn(ctx).Query(ctx, query, after, limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var phones []PhoneBackfill
+	for rows.Next() {
+		var phone PhoneBackfill
+		if err := rows.Scan(&phone.ContactID, &phone.Position, &phone.Number, &phone.Country); err != nil {
+			return nil, mapError(err)
+		}
+		phones = append(phones, phone)
+	}
+	return phones, mapError(rows.Err())
+}
+
+// SetPhonesE164 stores the E.164 form of phones, and of the contact phone of
+// those that are primary. Numbers changed since they were read and phones
+// without an E.164 form are left alone. The contacts keep their sync_seq:
+// CardDAV clients never see E.164, so there is nothing for them to resync.
+func (repo *PgxRepository) SetPhonesE164(ctx context.Context, phones []PhoneBackfill) error {
+	contactIDs := make([]uuid.UUID, 0, len(phones))
+	positions := make([]int, 0, len(phones))
+	numbers := make([]string, 0, len(phones))
+	e164s := make([]string, 0, len(phones))
+	for _, phone := range phones {
+		if phone.E164 == "" {
+			continue
+		}
+		contactIDs = append(contactIDs, phone.ContactID)
+		positions = append(positions, phone.Position)
+		numbers = append(numbers, phone.Number)
+		e164s = append(e164s, phone.E164)
+	}
+	if len(contactIDs) == 0 {
+		return nil
+	}
+
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if _, err := repo.conn(ctx).Exec(ctx, `SELECT set_config('contacts.keep_sync_seq', 'on', true)`); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE contact_phones p
+			SET number_e164 = b.e164
+			FROM unnest($1::uuid[], $2::int[], $3::text[], $4::text[]) AS b(contact_id, position, number, e164)
+			WHERE p.contact_id = b.contact_id AND p.position = b.position AND p.number = b.number AND p.number_e164 = ''`
+		if _, err := repo.conn(ctx).Exec(ctx, query, contactIDs, positions, numbers, e164s); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE contacts c
+			SET phone_e164 = p.number_e164
+			FROM contact_phones p
+			WHERE p.contact_id = c.id AND p.is_primary AND c.id = ANY($1)
+			  AND c.phone = p.number AND c.phone_e164 = '' AND p.number_e164 <> ''`
+		_, err := repo.conn(ctx).Exec(ctx, query, contactIDs)
+		return err
+	})
+	return mapError(err)
+}
+
+// GetAddressesToNormalize returns the addresses with a country of up to limit
+// contacts, the first ones by ID after the contact after, so a backfill can
+// walk all contacts in batches.
+func (repo *PgxRepository) GetAddressesToNormalize(ctx context.Context, after uuid.UUID, limit int) ([]AddressBackfill, error) {
+	query := `
+		SELECT contact_id, position, label, street, city, state, zip_code, country, is_primary
+		FROM contact_addresses
+		WHERE country <> '' AND contact_id IN (
+			SELECT DISTINCT contact_id
+			FROM contact_addresses
+			WHERE country <> '' AND contact_id > $1
+			ORDER BY contact_id
+			LIMIT $2
+		)
+		ORDER BY contact_id, position`
+
+	rows, err := repo.conn(ctx).Query(ctx, query, after, limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var addresses []AddressBackfill
+	for rows.Next() {
+		var address AddressBackfill
+		a := &address.Address
+		if err := rows.Scan(&address.ContactID, &address.Position, &a.Label, &a.Street, &a.City, &a.State, &a.ZipCode, &a.Country, &a.Primary); err != nil {
+			return nil, mapError(err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, mapError(rows.Err())
+}
+
+// SetNormalizedAddresses stores the normalized state, zip code and country of
+// addresses, and mirrors those of primary addresses into their contacts.
+// Addresses changed since they were read are left alone. The contacts take a
+// new version even when only another address changed, so their ETags change,
+// a revision records the rewrite and their sync_seq moves on for CardDAV
+// clients to fetch the new ADR lines.
+func (repo *PgxRepository) SetNormalizedAddresses(ctx context.Context, addresses []AddressBackfill) error {
+	if len(addresses) == 0 {
+		return nil
+	}
+	n := len(addresses)
+	contactIDs, positions := make([]uuid.UUID, n), make([]int, n)
+	states, zipCodes, countries := make([]string, n), make([]string, n), make([]string, n)
+	newStates, newZipCodes, newCountries := make([]string, n), make([]string, n), make([]string, n)
+	for i, address := range addresses {
+		contactIDs[i], positions[i] = address.ContactID, address.Position
+		states[i], zipCodes[i], countries[i] = address.Address.State, address.Address.ZipCode, address.Address.Country
+		newStates[i], newZipCodes[i], newCountries[i] = address.Normalized.State, address.Normalized.ZipCode, address.Normalized.Country
+	}
+
+	query := `
+		WITH changed AS (
+			UPDATE contact_addresses a
+			SET state = b.state, zip_code = b.zip_code, country = b.country
+			FROM unnest($1::uuid[], $2::int[], $3::text[], $4::text[], $5::text[], $6::text[], $7::text[], $8::text[])
+				AS b(contact_id, position, stored_state, stored_zip_code, stored_country, state, zip_code, country)
+			WHERE a.contact_id = b.contact_id AND a.position = b.position
+			  AND a.state = b.stored_state AND a.zip_code = b.stored_zip_code AND a.country = b.stored_country
+			RETURNING a.contact_id, a.is_primary, a.state, a.zip_code, a.country
+		)
+		UPDATE contacts c
+		SET state = COALESCE(p.state, c.state), zip_code = COALESCE(p.zip_code, c.zip_code), country = COALESCE(p.country, c.country),
+		    version = c.version + 1, updated_at = NOW()
+		FROM (SELECT DISTINCT contact_id FROM changed) t
+		LEFT JOIN changed p ON p.contact_id = t.contact_id AND p.is_primary
+		WHERE c.id = t.contact_id`
+	_, err := repo.conn(ctx).Exec(ctx, query, contactIDs, positions, states, zipCodes, countries, newStates, newZipCodes, newCountries)
+	return mapError(err)
+}
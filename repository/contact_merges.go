@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+)
+
+// Thresholds of FindDuplicateContacts, as trigram similarities from 0 to 1.
+const (
+	duplicateNameSimilarity    = 0.5 // Names at least this similar are compared further
+	duplicateAddressSimilarity = 0.5 // Similar names with addresses at least this similar are duplicates
+	duplicateSameName          = 0.8 // Names at least this similar are duplicates on their own
+)
+
+// FindDuplicateContacts returns up to limit pairs of live contacts that are
+// likely duplicates, best first. Two contacts match when they share a phone
+// number in E.164, when their names are nearly the same, or when their names
+// are similar and so are their primary addresses.
+func (repo *PgxRepository) FindDuplicateContacts(ctx context.Context, userID uuid.UUID, limit int) ([]DuplicateMatch, error) {
+	query := `
+		WITH candidates AS (
+			SELECT DISTINCT LEAST(pa.contact_id, pb.contact_id) AS a, GREATEST(pa.contact_id, pb.contact_id) AS b
+			FROM contacts c
+			JOIN contact_phones pa ON pa.contact_id = c.id
+			JOIN contact_phones pb ON pb.number_e164 = pa.number_e164 AND pb.contact_id <> pa.contact_id
+			WHERE c.user_id = $1 AND c.deleted_at IS NULL AND pa.number_e164 <> ''
+			UNION
+			SELECT a.id, b.id
+			FROM contacts a
+			JOIN contacts b ON b.dedupe_name % a.dedupe_name AND b.id > a.id
+			WHERE a.user_id = $1 AND b.user_id = $1 AND a.deleted_at IS NULL AND b.deleted_at IS NULL AND a.dedupe_name <> ''
+		), pairs AS (
+			SELECT a.id AS a, b.id AS b,
+				EXISTS (
+					SELECT 1 FROM contact_phones pa JOIN contact_phones pb ON pb.number_e164 = pa.number_e164
+					WHERE pa.contact_id = a.id AND pb.contact_id = b.id AND pa.number_e164 <> ''
+				) AS same_phone,
+				CASE WHEN a.dedupe_name <> '' AND b.dedupe_name <> ''
+					THEN similarity(a.dedupe_name, b.dedupe_name) ELSE 0 END AS name_similarity,
+				CASE WHEN a.dedupe_address <> '' AND b.dedupe_address <> ''
+					THEN similarity(a.dedupe_address, b.dedupe_address) ELSE 0 END AS address_similarity
+			FROM candidates c
+			JOIN contacts a ON a.id = c.a AND a.user_id = $1 AND a.deleted_at IS NULL
+			JOIN contacts b ON b.id = c.b AND b.user_id = $1 AND b.deleted_at IS NULL
+		)
+		SELECT a, b, same_phone, name_similarity, address_similarity,
+			((CASE WHEN same_phone THEN 1 ELSE 0 END) + name_similarity + address_similarity) / 3 AS score
+		FROM pairs
+		WHERE same_phone
+			OR name_similarity >= $3
+			OR (name_similarity >= $2 AND address_similarity >= $4)
+		ORDER BY score DESC, a, b
+		LIMIT $5`
+
+	rows, err := repo.conn(ctx).Query(ctx, query, userID,
+		duplicateNameSimilarity, duplicateSameName, duplicateAddressSimilarity, limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	matches := []DuplicateMatch{}
+	for rows.Next() {
+		var match DuplicateMatch
+		if err := rows.Scan(&match.ContactIDs[0], &match.ContactIDs[1], &match.SamePhone,
+			&match.NameSimilarity, &match.AddressSimilarity, &match.Score); err != nil {
+			return nil, mapError(err)
+		}
+		matches = append(matches, match)
+	}
+	return matches, mapError(rows.Err())
+}
+
+// MergeContacts applies survivor to merge.SurvivorID, moves the contacts in
+// merge.MergedIDs to the trash and gives the survivor their tags, all or
+// nothing, and records the merge. mergedVersions holds the version each
+// merged contact was read at; a contact that changed or went since returns
+// ErrPreconditionFailed, as does a stale survivor.Version. The ID, revision
+// and time of the merge are set on merge.
+func (repo *PgxRepository) MergeContacts(ctx context.Context, merge *ContactMerge, survivor *ContactPatch, mergedVersions []int) error {
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if err := repo.PatchContactByID(ctx, merge.UserID, merge.SurvivorID, survivor); err != nil {
+			return err
+		}
+		merge.SurvivorRevision = survivor.Version
+
+		query := `
+			INSERT INTO contact_merges (user_id, survivor_id, survivor_revision, fields)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, merged_at`
+		if err := repo.conn(ctx).QueryRow(ctx, query, merge.UserID, merge.SurvivorID, merge.SurvivorRevision, merge.Fields).
+			Scan(&merge.ID, &merge.MergedAt); err != nil {
+			return err
+		}
+
+		query = `
+			WITH merged AS (
+				UPDATE contacts c
+				SET deleted_at = NOW(), version = c.version + 1
+				FROM unnest($1::uuid[], $2::int[]) AS m(id, version)
+				WHERE c.id = m.id AND c.version = m.version AND c.user_id = $3 AND c.deleted_at IS NULL
+				RETURNING c.id, c.version, contacts_revision_data(c) AS data
+			)
+			INSERT INTO contact_merge_sources (merge_id, contact_id, revision, data)
+			SELECT $4, id, version, data FROM merged`
+		result, err := repo.conn(ctx).Exec(ctx, query, merge.MergedIDs, mergedVersions, merge.UserID, merge.ID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() != int64(len(merge.MergedIDs)) {
+			return ErrPreconditionFailed
+		}
+
+		query = `
+			INSERT INTO contact_tags (contact_id, tag_id)
+			SELECT $1, tag_id FROM contact_tags WHERE contact_id = ANY($2)
+			ON CONFLICT DO NOTHING`
+		_, err = repo.conn(ctx).Exec(ctx, query, merge.SurvivorID, merge.MergedIDs)
+		return err
+	})
+	return mapError(err)
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go_chi_pgx/phone"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSort is returned by ParseContactSort for fields that are not in
+// the sortable whitelist.
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// ContactFilter narrows the contacts returned by GetAllContacts and counted by
+// GetContactsCount. The zero value matches every live contact of the user.
+type ContactFilter struct {
+	Query         string        // Full-text and fuzzy search over names, company, phone, address and notes; number-like terms match any phone by its digits
+	City          string        // Exact match, case-insensitive
+	State         string        // Exact match, case-insensitive
+	Country       string        // Exact match, case-insensitive
+	ZipCodePrefix string        // Matches zip codes starting with the prefix
+	Tags          []string      // Tag names, case-insensitive; contacts must have every one
+	IDs           []uuid.UUID   // Only these contacts, ignored when empty
+	CreatedAfter  time.Time     // Inclusive lower bound, ignored when zero
+	CreatedBefore time.Time     // Exclusive upper bound, ignored when zero
+	Deleted       bool          // List the trash instead of the live contacts
+	Sort          []ContactSort // Ordering only, GetContactsCount ignores it
+}
+
+// ContactSort orders a listing by one whitelisted field.
+type ContactSort struct {
+	Field string
+	Desc  bool
+}
+
+// contactSortColumns whitelists the fields a listing can be sorted by. Only
+// these column names are ever interpolated into the ORDER BY clause.
+var contactSortColumns = map[string]string{
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"deleted_at":   "deleted_at",
+	"given_name":   "given_name",
+	"family_name":  "family_name",
+	"display_name": "display_name",
+	"nickname":     "nickname",
+	"company":      "company",
+	"job_title":    "job_title",
+	"phone":        "phone",
+	"street":       "street",
+	"city":         "city",
+	"state":        "state",
+	"zip_code":     "zip_code",
+	"country":      "country",
+	"score":        "score",
+}
+
+// ContactKeyset is the position of a row in a listing ordered by
+// (created_at, id), used for keyset pagination.
+type ContactKeyset struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	Backward  bool // Fetch the rows preceding the key instead of following it
+}
+
+// KeysetDescending reports whether a keyset listing with this filter runs
+// newest first. Keyset pages can only be ordered by created_at, so searching
+// or sorting by any other field returns ErrInvalidSort.
+func (f ContactFilter) KeysetDescending() (bool, error) {
+	if f.Query != "" {
+		return false, fmt.Errorf("%w: search results are ordered by score", ErrInvalidSort)
+	}
+	switch {
+	case len(f.Sort) == 0:
+		return true, nil
+	case len(f.Sort) == 1 && f.Sort[0].Field == "created_at":
+		return f.Sort[0].Desc, nil
+	default:
+		return false, fmt.Errorf("%w: cursor pages are ordered by created_at", ErrInvalidSort)
+	}
+}
+
+// ParseContactSort parses a comma separated list of fields such as
+// "-created_at,city", where a leading "-" sorts that field descending.
+func ParseContactSort(spec string) ([]ContactSort, error) {
+	var sorts []ContactSort
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		sort := ContactSort{Field: field}
+		if strings.HasPrefix(field, "-") {
+			sort = ContactSort{Field: field[1:], Desc: true}
+		}
+		if _, ok := contactSortColumns[sort.Field]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSort, sort.Field)
+		}
+		sorts = append(sorts, sort)
+	}
+	return sorts, nil
+}
+
+// contactQuery accumulates the WHERE conditions of a contact listing together
+// with their positional arguments.
+type contactQuery struct {
+	conditions []string
+	args       []interface{}
+	score      string // Relevance expression, empty unless the filter searches
+	sort       []ContactSort
+}
+
+func (q *contactQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *contactQuery) where() string {
+	return strings.Join(q.conditions, " AND ")
+}
+
+// orderBy returns the ORDER BY clause. Search results default to relevance,
+// everything else to newest first, and id always breaks ties so that pages
+// are stable.
+func (q *contactQuery) orderBy() string {
+	sorts := q.sort
+	if len(sorts) == 0 {
+		sorts = []ContactSort{{Field: "created_at", Desc: true}}
+		if q.score != "" {
+			sorts = []ContactSort{{Field: "score", Desc: true}}
+		}
+	}
+
+	terms := make([]string, 0, len(sorts)+1)
+	for _, sort := range sorts {
+		term := contactSortColumns[sort.Field]
+		if sort.Desc {
+			term += " DESC NULLS LAST"
+		} else {
+			term += " ASC NULLS LAST"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(append(terms, "id"), ", ")
+}
+
+// keyset restricts the listing to the rows past key and returns the matching
+// ORDER BY clause. Walking backward flips both the comparison and the order,
+// so the caller gets the rows nearest the key first.
+func (q *contactQuery) keyset(key *ContactKeyset, desc bool) string {
+	if key != nil && key.Backward {
+		desc = !desc
+	}
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if key != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf("(created_at, id) %s (%s, %s)", comparison, q.arg(key.CreatedAt), q.arg(key.ID)))
+	}
+	return fmt.Sprintf("created_at %s, id %s", direction, direction)
+}
+
+func buildContactQuery(userID uuid.UUID, filter ContactFilter) *contactQuery {
+	q := &contactQuery{sort: filter.Sort}
+	q.conditions = append(q.conditions, "user_id = "+q.arg(userID))
+	if filter.Deleted {
+		q.conditions = append(q.conditions, "deleted_at IS NOT NULL")
+	} else {
+		q.conditions = append(q.conditions, "deleted_at IS NULL")
+	}
+
+	if filter.Query != "" {
+		// Full-text search handles whole words in any order; word similarity
+		// catches typos and partial input such as "sprngfield" or "5551".
+		term := q.arg(filter.Query)
+		tsquery := fmt.Sprintf("websearch_to_tsquery('simple', %s)", term)
+		match := fmt.Sprintf("search_vector @@ %s OR lower(%s) <%% search_text", tsquery, term)
+		q.score = fmt.Sprintf("(ts_rank(search_vector, %s) + word_similarity(lower(%s), search_text))", tsquery, term)
+
+		// A term that looks like a phone number also matches any of the
+		// contact's numbers containing its digits, however either was typed.
+		if digits := phone.SearchDigits(filter.Query); digits != "" {
+			phoneMatch := `EXISTS (SELECT 1 FROM contact_phones p WHERE p.contact_id = contacts.id AND p.number_e164 LIKE ` +
+				q.arg("%"+digits+"%") + `)`
+			match += " OR " + phoneMatch
+			q.score = fmt.Sprintf("(%s + CASE WHEN %s THEN 1 ELSE 0 END)", q.score, phoneMatch)
+		}
+		q.conditions = append(q.conditions, "("+match+")")
+	}
+	if filter.City != "" {
+		q.conditions = append(q.conditions, "lower(city) = lower("+q.arg(filter.City)+")")
+	}
+	if filter.State != "" {
+		q.conditions = append(q.conditions, "lower(state) = lower("+q.arg(filter.State)+")")
+	}
+	if filter.Country != "" {
+		q.conditions = append(q.conditions, "lower(country) = lower("+q.arg(filter.Country)+")")
+	}
+	if filter.ZipCodePrefix != "" {
+		q.conditions = append(q.conditions, "zip_code ILIKE "+q.arg(escapeLike(filter.ZipCodePrefix)+"%")+` ESCAPE '\'`)
+	}
+	for _, tag := range filter.Tags {
+		q.conditions = append(q.conditions, `EXISTS (
+			SELECT 1 FROM contact_tags ct JOIN tags t ON t.id = ct.tag_id
+			WHERE ct.contact_id = contacts.id AND lower(t.name) = lower(`+q.arg(tag)+`))`)
+	}
+	if len(filter.IDs) > 0 {
+		q.conditions = append(q.conditions, "id = ANY("+q.arg(filter.IDs)+")")
+	}
+	if !filter.CreatedAfter.IsZero() {
+		q.conditions = append(q.conditions, "created_at >= "+q.arg(filter.CreatedAfter.UTC()))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		q.conditions = append(q.conditions, "created_at < "+q.arg(filter.CreatedBefore.UTC()))
+	}
+
+	return q
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes every character of s match literally in a LIKE pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// contactRevisionColumns are the columns scanned by scanContactRevision.
+const contactRevisionColumns = `r.contact_id, r.revision, r.operation, r.changed_by, r.data, r.changed_at`
+
+func scanContactRevision(row pgx.Row, revision *ContactRevision) error {
+	return row.Scan(
+		&revision.ContactID, &revision.Revision, &revision.Operation, &revision.ChangedBy, &revision.Data, &revision.ChangedAt,
+	)
+}
+
+// GetContactRevisions returns the history of a contact, oldest first. The
+// contacts_record_revision trigger writes a revision in the same transaction
+// as every write, so contacts in the trash keep their history until purged.
+func (repo *PgxRepository) GetContactRevisions(ctx context.Context, userID, contactID uuid.UUID) ([]ContactRevision, error) {
+	query := `
+		SELECT ` + contactRevisionColumns + `
+		FROM contact_revisions r
+		JOIN contacts c ON c.id = r.contact_id
+		WHERE r.contact_id = $1 AND c.user_id = $2
+		ORDER BY r.revision`
+
+	rows, err := repo.conn(ctx).Query(ctx, query, contactID, userID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var revisions []ContactRevision
+	for rows.Next() {
+		var revision ContactRevision
+		if err := scanContactRevision(rows, &revision); err != nil {
+			return nil, mapError(err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+	if len(revisions) == 0 {
+		return nil, ErrNotFound
+	}
+	return revisions, nil
+}
+
+// GetContactRevision returns one revision of a contact.
+func (repo *PgxRepository) GetContactRevision(ctx context.Context, userID, contactID uuid.UUID, revision int) (*ContactRevision, error) {
+	query := `
+		SELECT ` + contactRevisionColumns + `
+		FROM contact_revisions r
+		JOIN contacts c ON c.id = r.contact_id
+		WHERE r.contact_id = $1 AND c.user_id = $2 AND r.revision = $3`
+
+	var result ContactRevision
+	if err := scanContactRevision(repo.conn(ctx).QueryRow(ctx, query, contactID, userID, revision), &result); err != nil {
+		return nil, mapError(err)
+	}
+	return &result, nil
+}
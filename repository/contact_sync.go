@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// contactObjectColumns are the columns scanned by scanContactObject.
+const contactObjectColumns = `id, ` + contactProfileColumns + `, phone, phone_e164, street, city, state, zip_code, country, created_at, updated_at, sync_seq, COALESCE(dav_name, ''), version, deleted_at, ` + contactDetailColumns
+
+// ContactPrecondition mirrors the If-None-Match and If-Match headers of a
+// conditional write. The zero value writes unconditionally.
+type ContactPrecondition struct {
+	MustNotExist bool  // Only create the contact, fail if the ID is taken
+	SyncSeq      int64 // Only replace the contact while it is at this sync_seq
+	Version      int   // Only replace the contact while it is at this version
+}
+
+// ContactChanges is a page of the change feed of one user's contacts.
+type ContactChanges struct {
+	Updated   []Contact          // Contacts created or changed, in sync_seq order
+	Deleted   []ContactTombstone // Contacts deleted, in sync_seq order
+	SyncSeq   int64              // Position to resume the feed from
+	Truncated bool               // More changes follow SyncSeq
+}
+
+func scanContactObject(row pgx.Row, contact *Contact) error {
+	targets := append([]any{&contact.ID}, contact.scanTargets()...)
+	return row.Scan(append(targets,
+		&contact.Phone, &contact.PhoneE164, &contact.Street, &contact.City, &contact.State, &contact.ZipCode, &contact.Country,
+		&contact.CreatedAt, &contact.UpdatedAt, &contact.SyncSeq, &contact.DAVName, &contact.Version, &contact.DeletedAt,
+		&contact.Phones, &contact.Emails, &contact.Addresses,
+	)...)
+}
+
+// GetContactObject returns a contact with its sync metadata.
+func (repo *PgxRepository) GetContactObject(ctx context.Context, userID, contactID uuid.UUID) (*Contact, error) {
+	query := `SELECT ` + contactObjectColumns + ` FROM contacts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
+	contact := Contact{UserID: userID}
+	if err := scanContactObject(repo.conn(ctx).QueryRow(ctx, query, contactID, userID), &contact); err != nil {
+		return nil, mapError(err)
+	}
+	return &contact, nil
+}
+
+// contactObjectUpsert inserts a contact or replaces the one with the same ID,
+// restoring it from the trash. It leaves contacts of other users alone.
+const contactObjectUpsert = `
+	INSERT INTO contacts (id, user_id, phone, street, city, state, zip_code, country, dav_name, ` + contactProfileColumns + `, phone_e164, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NOW(), NOW())
+	ON CONFLICT (id) DO UPDATE
+	SET given_name = EXCLUDED.given_name, family_name = EXCLUDED.family_name, display_name = EXCLUDED.display_name,
+	    nickname = EXCLUDED.nickname, company = EXCLUDED.company, job_title = EXCLUDED.job_title, notes = EXCLUDED.notes,
+	    phone = EXCLUDED.phone, phone_e164 = EXCLUDED.phone_e164, street = EXCLUDED.street, city = EXCLUDED.city, state = EXCLUDED.state,
+	    zip_code = EXCLUDED.zip_code, country = EXCLUDED.country, dav_name = COALESCE(EXCLUDED.dav_name, contacts.dav_name),
+	    deleted_at = NULL, version = contacts.version + 1, updated_at = NOW()
+	WHERE contacts.user_id = EXCLUDED.user_id`
+
+// PutContactObject creates or replaces a contact as a whole, together with its
+// non-nil lists, and sets contact.SyncSeq and contact.Version to their new
+// values. An empty DAVName keeps the resource name of a contact being replaced. created reports
+// whether the contact did not exist before; a contact in the trash counts as
+// gone and is replaced. A failed precondition returns ErrPreconditionFailed;
+// an ID owned by another user a unique violation.
+func (repo *PgxRepository) PutContactObject(ctx context.Context, contact *Contact, cond ContactPrecondition) (bool, error) {
+	var davName *string
+	if contact.DAVName != "" {
+		davName = &contact.DAVName
+	}
+	args := append([]any{
+		contact.ID, contact.UserID, contact.Phone, contact.Street, contact.City, contact.State, contact.ZipCode, contact.Country, davName,
+	}, append(contact.values(), contact.PhoneE164)...)
+
+	var query string
+	switch {
+	case cond.MustNotExist:
+		query = contactObjectUpsert + ` AND contacts.deleted_at IS NOT NULL
+			RETURNING sync_seq, version, TRUE`
+	case cond.SyncSeq != 0 || cond.Version != 0:
+		query = `
+			UPDATE contacts
+			SET phone = $3, street = $4, city = $5, state = $6, zip_code = $7, country = $8, dav_name = COALESCE($9, dav_name),
+			    given_name = $10, family_name = $11, display_name = $12, nickname = $13, company = $14, job_title = $15, notes = $16,
+			    phone_e164 = $17,
+			    version = version + 1, updated_at = NOW()
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+		if cond.SyncSeq != 0 {
+			args = append(args, cond.SyncSeq)
+			query += fmt.Sprintf(" AND sync_seq = $%d", len(args))
+		}
+		if cond.Version != 0 {
+			args = append(args, cond.Version)
+			query += fmt.Sprintf(" AND version = $%d", len(args))
+		}
+		query += " RETURNING sync_seq, version, FALSE"
+	default:
+		// The CTE sees the row as it was before the statement.
+		query = `WITH previous AS (SELECT 1 FROM contacts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)` +
+			contactObjectUpsert + `
+			RETURNING sync_seq, version, NOT EXISTS (SELECT 1 FROM previous)`
+	}
+
+	var created bool
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if err := repo.conn(ctx).QueryRow(ctx, query, args...).Scan(&contact.SyncSeq, &contact.Version, &created); err != nil {
+			return err
+		}
+		if !hasContactDetails(contact) {
+			return nil
+		}
+		return repo.replaceContactDetails(ctx, contact.ID, contact.Phones, contact.Emails, contact.Addresses)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		if cond != (ContactPrecondition{}) {
+			return false, ErrPreconditionFailed
+		}
+		return false, &ConstraintError{Err: ErrUniqueViolation, Constraint: "contacts_pkey"}
+	}
+	if err != nil {
+		return false, mapError(err)
+	}
+	return created, nil
+}
+
+// GetContactsSyncSeq returns the change feed position of the user's latest
+// write, 0 when there is none.
+func (repo *PgxRepository) GetContactsSyncSeq(ctx context.Context, userID uuid.UUID) (int64, error) {
+	query := `
+		SELECT COALESCE(GREATEST(
+			(SELECT MAX(sync_seq) FROM contacts WHERE user_id = $1),
+			(SELECT MAX(sync_seq) FROM contact_tombstones WHERE user_id = $1)
+		), 0)`
+
+	var seq int64
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if err := repo.lockContactFeed(ctx, userID); err != nil {
+			return err
+		}
+		return mapError(repo.conn(ctx).QueryRow(ctx, query, userID).Scan(&seq))
+	})
+	return seq, err
+}
+
+// GetContactChanges returns up to limit changes made after since, or all of
+// them when limit is 0. Contacts moved to the trash are reported as deleted.
+// since 0 asks for an initial sync, which lists the current contacts and no
+// deletions. A since the feed never reached returns ErrInvalidSyncToken.
+func (repo *PgxRepository) GetContactChanges(ctx context.Context, userID uuid.UUID, since int64, limit int) (*ContactChanges, error) {
+	var fetch *int
+	if limit > 0 {
+		fetch = new(int)
+		*fetch = limit + 1
+	}
+
+	var updated []Contact
+	var deleted []ContactTombstone
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if err := repo.lockContactFeed(ctx, userID); err != nil {
+			return err
+		}
+
+		var current int64
+		if err := repo.conn(ctx).QueryRow(ctx, `SELECT last_value FROM contacts_sync_seq`).Scan(&current); err != nil {
+			return mapError(err)
+		}
+		if since < 0 || since > current {
+			return ErrInvalidSyncToken
+		}
+
+		query := `
+			SELECT ` + contactObjectColumns + `
+			FROM contacts
+			WHERE user_id = $1 AND sync_seq > $2 AND ($2 > 0 OR deleted_at IS NULL)
+			ORDER BY sync_seq
+			LIMIT $3`
+		rows, err := repo.conn(ctx).Query(ctx, query, userID, since, fetch)
+		if err != nil {
+			return mapError(err)
+		}
+		for rows.Next() {
+			contact := Contact{UserID: userID}
+			if err := scanContactObject(rows, &contact); err != nil {
+				rows.Close()
+				return mapError(err)
+			}
+			if contact.DeletedAt != nil {
+				deleted = append(deleted, ContactTombstone{ContactID: contact.ID, DAVName: contact.DAVName, SyncSeq: contact.SyncSeq})
+				continue
+			}
+			updated = append(updated, contact)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return mapError(err)
+		}
+
+		if since == 0 {
+			return nil
+		}
+		query = `
+			SELECT contact_id, COALESCE(dav_name, ''), sync_seq
+			FROM contact_tombstones
+			WHERE user_id = $1 AND sync_seq > $2
+			ORDER BY sync_seq
+			LIMIT $3`
+		rows, err = repo.conn(ctx).Query(ctx, query, userID, since, fetch)
+		if err != nil {
+			return mapError(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var tombstone ContactTombstone
+			if err := rows.Scan(&tombstone.ContactID, &tombstone.DAVName, &tombstone.SyncSeq); err != nil {
+				return mapError(err)
+			}
+			deleted = append(deleted, tombstone)
+		}
+		return mapError(rows.Err())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Trashed contacts and tombstones are each in order, but not together.
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].SyncSeq < deleted[j].SyncSeq })
+	return mergeContactChanges(updated, deleted, since, limit), nil
+}
+
+// mergeContactChanges keeps the first limit changes of both sorted lists.
+func mergeContactChanges(updated []Contact, deleted []ContactTombstone, since int64, limit int) *ContactChanges {
+	changes := &ContactChanges{SyncSeq: since}
+	i, j := 0, 0
+	for i < len(updated) || j < len(deleted) {
+		if limit > 0 && i+j == limit {
+			changes.Truncated = true
+			break
+		}
+		if j == len(deleted) || (i < len(updated) && updated[i].SyncSeq < deleted[j].SyncSeq) {
+			changes.SyncSeq = updated[i].SyncSeq
+			i++
+		} else {
+			changes.SyncSeq = deleted[j].SyncSeq
+			j++
+		}
+	}
+	changes.Updated = updated[:i]
+	changes.Deleted = deleted[:j]
+	return changes
+}
+
+// lockContactFeed waits for the user's in-flight contact writes to commit and
+// holds them off until the transaction ends, see contacts_sync_lock.
+func (repo *PgxRepository) lockContactFeed(ctx context.Context, userID uuid.UUID) error {
+	_, err := repo.conn(ctx).Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1::text, 0))`, userID)
+	return mapError(err)
+}
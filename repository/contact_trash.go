@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+// RestoreContactByID moves a contact out of the trash. A contact that is not
+// in the trash returns ErrNotFound.
+func (repo *PgxRepository) RestoreContactByID(ctx context.Context, userID, contactID uuid.UUID) error {
+	query := `
+		UPDATE contacts
+		SET deleted_at = NULL, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL`
+
+	result, err := repo.conn(ctx).Exec(ctx, query, contactID, userID)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PurgeDeletedContacts permanently deletes up to limit contacts that were
+// moved to the trash before deletedBefore and returns how many it deleted.
+// Rows locked by another purger are skipped, so purgers can run side by side.
+func (repo *PgxRepository) PurgeDeletedContacts(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM contacts
+		WHERE id IN (
+			SELECT id
+			FROM contacts
+			WHERE deleted_at < $1
+			ORDER BY deleted_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)`
+
+	result, err := repo.conn(ctx).Exec(ctx, query, deletedBefore, limit)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return result.RowsAffected(), nil
+}
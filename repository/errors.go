@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+// Errors returned by the repository. Callers should test for them with
+// errors.Is instead of matching on error strings.
+var (
+	ErrNotFound        = errors.New("record not found")
+	ErrConflict        = errors.New("record was modified concurrently")
+	ErrUniqueViolation = errors.New("unique constraint violation")
+	ErrForeignKey      = errors.New("foreign key violation")
+	ErrTimeout         = errors.New("database operation timed out")
+
+	// ErrPreconditionFailed is returned by conditional writes when the
+	// record was created or changed since the caller last read it.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrInvalidSyncToken   = errors.New("sync token is not valid")
+)
+
+var (
+	ErrRefreshTokenNotFound = fmt.Errorf("refresh token: %w", ErrNotFound)
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenRevoked  = errors.New("refresh token revoked")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+// ConstraintError reports which constraint a write violated. It unwraps to
+// ErrUniqueViolation or ErrForeignKey.
+type ConstraintError struct {
+	Err        error
+	Constraint string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.Constraint)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// PostgreSQL error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeUniqueViolation      = "23505"
+	codeForeignKeyViolation  = "23503"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+	codeLockNotAvailable     = "55P03"
+	codeQueryCanceled        = "57014"
+)
+
+// mapError translates pgx and pgconn errors into the repository taxonomy.
+// Errors it does not recognise are returned unchanged.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case codeUniqueViolation:
+			return &ConstraintError{Err: ErrUniqueViolation, Constraint: pgErr.ConstraintName}
+		case codeForeignKeyViolation:
+			return &ConstraintError{Err: ErrForeignKey, Constraint: pgErr.ConstraintName}
+		case codeSerializationFailure, codeDeadlockDetected, codeLockNotAvailable:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case codeQueryCanceled:
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+	}
+	return err
+}
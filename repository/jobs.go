@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// EnqueueJob inserts a pending job. Called with a context from InTx it is
+// committed atomically with the rest of the transaction.
+func (repo *PgxRepository) EnqueueJob(ctx context.Context, job *Job) error {
+	query := `
+		INSERT INTO jobs (kind, payload, status, max_attempts, run_at, created_at, updated_at)
+		VALUES ($1, $2, 'pending', $3, COALESCE($4, NOW()), NOW(), NOW())
+		RETURNING id, status, run_at, created_at`
+
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	err := repo.conn(ctx).QueryRow(ctx, query, job.Kind, job.Payload, job.MaxAttempts, runAt).Scan(
+		&job.ID, &job.Status, &job.RunAt, &job.CreatedAt,
+	)
+	return mapError(err)
+}
+
+// ClaimJobs marks up to limit due jobs as running and returns them. SKIP LOCKED
+// lets any number of workers claim concurrently without handing out the same
+// job twice. Jobs left running longer than lockTimeout, e.g. by a crashed
+// worker, are claimed again while they have attempts left; the others are
+// dead-lettered with JobWorkerLost, so a job that kills its worker every time
+// is not retried forever.
+func (repo *PgxRepository) ClaimJobs(ctx context.Context, limit int, lockTimeout time.Duration) ([]Job, error) {
+	query := `
+		WITH lost AS (
+			UPDATE jobs
+			SET status = 'dead', last_error = $3, locked_at = NULL, updated_at = NOW()
+			WHERE id IN (
+				SELECT id
+				FROM jobs
+				WHERE status = 'running' AND locked_at < NOW() - $2::interval AND attempts >= max_attempts
+				FOR UPDATE SKIP LOCKED
+			)
+		)
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id IN (
+			SELECT id
+			FROM jobs
+			WHERE (status = 'pending' AND run_at <= NOW())
+			   OR (status = 'running' AND locked_at < NOW() - $2::interval AND attempts < max_attempts)
+			ORDER BY run_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at`
+
+	rows, err := repo.conn(ctx).Query(ctx, query, limit, lockTimeout, JobWorkerLost)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(
+			&job.ID, &job.Kind, &job.Payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError, &job.CreatedAt,
+		)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, mapError(rows.Err())
+}
+
+func (repo *PgxRepository) CompleteJob(ctx context.Context, jobID int64) error {
+	query := `UPDATE jobs SET status = 'done', locked_at = NULL, updated_at = NOW() WHERE id = $1`
+	result, err := repo.conn(ctx).Exec(ctx, query, jobID)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FailJob records a failed attempt. The job is retried at retryAt unless it
+// has used up its attempts or retryAt is nil, in which case it is dead-lettered.
+func (repo *PgxRepository) FailJob(ctx context.Context, jobID int64, jobErr string, retryAt *time.Time) error {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN $3::timestamptz IS NULL OR attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+		    run_at = COALESCE($3, run_at),
+		    last_error = $2,
+		    locked_at = NULL,
+		    updated_at = NOW()
+		WHERE id = $1`
+	result, err := repo.conn(ctx).Exec(ctx, query, jobID, jobErr, retryAt)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"encoding/json"
 	"github.com/gofrs/uuid"
 	"time"
 )
@@ -15,28 +16,248 @@ type User struct {
 	UpdatedAt time.Time `db:"updated_at"` // Timestamp of the last update
 }
 
+// ContactProfile is who a contact is, as opposed to how to reach them.
+type ContactProfile struct {
+	GivenName   string `json:"given_name" db:"given_name"`     // First name
+	FamilyName  string `json:"family_name" db:"family_name"`   // Last name
+	DisplayName string `json:"display_name" db:"display_name"` // Name to show, when not just given and family name
+	Nickname    string `json:"nickname" db:"nickname"`         // Nickname
+	Company     string `json:"company" db:"company"`           // Organization the contact works for
+	JobTitle    string `json:"job_title" db:"job_title"`       // Job title at the company
+	Notes       string `json:"notes" db:"notes"`               // Free-form notes
+}
+
+// contactProfileColumns are the columns of ContactProfile, in the order of
+// its scan and values methods.
+const contactProfileColumns = `given_name, family_name, display_name, nickname, company, job_title, notes`
+
+func (p *ContactProfile) scanTargets() []any {
+	return []any{&p.GivenName, &p.FamilyName, &p.DisplayName, &p.Nickname, &p.Company, &p.JobTitle, &p.Notes}
+}
+
+func (p *ContactProfile) values() []any {
+	return []any{p.GivenName, p.FamilyName, p.DisplayName, p.Nickname, p.Company, p.JobTitle, p.Notes}
+}
+
 type Contact struct {
-	ID        uuid.UUID `json:"id" db:"id"`                 // Unique ID for each contact
-	UserID    uuid.UUID `json:"user_id" db:"user_id"`       // Foreign key to users table
-	Phone     string    `json:"phone" db:"phone"`           // Contact's phone number
-	Street    string    `json:"street" db:"street"`         // Street address
-	City      string    `json:"city" db:"city"`             // City
-	State     string    `json:"state" db:"state"`           // State
-	ZipCode   string    `json:"zip_code" db:"zip_code"`     // Zip code
-	Country   string    `json:"country" db:"country"`       // Country
-	CreatedAt time.Time `json:"created_at" db:"created_at"` // Created timestamp
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"` // Updated timestamp
+	ID     uuid.UUID `json:"id" db:"id"`           // Unique ID for each contact
+	UserID uuid.UUID `json:"user_id" db:"user_id"` // Foreign key to users table
+	ContactProfile
+	Phone     string     `json:"phone" db:"phone"`                     // Contact's phone number
+	PhoneE164 string     `json:"phone_e164" db:"phone_e164"`           // Phone in E.164, "" for numbers that do not parse
+	Street    string     `json:"street" db:"street"`                   // Street address
+	City      string     `json:"city" db:"city"`                       // City
+	State     string     `json:"state" db:"state"`                     // State
+	ZipCode   string     `json:"zip_code" db:"zip_code"`               // Zip code
+	Country   string     `json:"country" db:"country"`                 // Country
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`           // Created timestamp
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`           // Updated timestamp
+	Score     float64    `json:"score,omitempty" db:"score"`           // Search relevance, only set when searching
+	SyncSeq   int64      `json:"-" db:"sync_seq"`                      // Change feed position, bumped on every write
+	DAVName   string     `json:"-" db:"dav_name"`                      // CardDAV resource name, "" for "<id>.vcf"
+	Version   int        `json:"-" db:"version"`                       // Bumped on every update, used as the ETag
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"` // Set while the contact is in the trash
+
+	// The lists are written only when non-nil. Phone and the address fields
+	// mirror the primary phone and address.
+	Phones    []ContactPhone   `json:"phones,omitempty"`
+	Emails    []ContactEmail   `json:"emails,omitempty"`
+	Addresses []ContactAddress `json:"addresses,omitempty"`
+}
+
+type ContactPhone struct {
+	Label   string `json:"label" db:"label"`        // mobile, work, home or other
+	Number  string `json:"number" db:"number"`      // Phone number as typed
+	E164    string `json:"e164" db:"number_e164"`   // Number in E.164
+	Primary bool   `json:"primary" db:"is_primary"` // Mirrored into Contact.Phone
+}
+
+// PhoneBackfill is a stored phone number without its E.164 form, as numbers
+// saved before they were normalized are.
+type PhoneBackfill struct {
+	ContactID uuid.UUID // Contact the phone belongs to
+	Position  int       // Position of the phone in the contact's list
+	Number    string    // Phone number as typed
+	Country   string    // Country of the contact's primary address
+	E164      string    // Number in E.164, to be filled in
+}
+
+// AddressBackfill is a stored address and its canonical form, as addresses
+// saved before they were normalized are rewritten to.
+type AddressBackfill struct {
+	ContactID  uuid.UUID      // Contact the address belongs to
+	Position   int            // Position of the address in the contact's list
+	Address    ContactAddress // Address as stored
+	Normalized ContactAddress // Address with ISO codes, to be filled in
+}
+
+type ContactEmail struct {
+	Label   string `json:"label" db:"label"`        // home, work or other
+	Address string `json:"address" db:"address"`    // Email address
+	Primary bool   `json:"primary" db:"is_primary"` // Preferred email
+}
+
+type ContactAddress struct {
+	Label   string `json:"label" db:"label"`        // home, work or other
+	Street  string `json:"street" db:"street"`      // Street address
+	City    string `json:"city" db:"city"`          // City
+	State   string `json:"state" db:"state"`        // State
+	ZipCode string `json:"zip_code" db:"zip_code"`  // Zip code
+	Country string `json:"country" db:"country"`    // Country
+	Primary bool   `json:"primary" db:"is_primary"` // Mirrored into the Contact address fields
+}
+
+// ContactPatch is a partial update of a contact. Nil fields are left as they
+// are and a pointer to "" clears the field.
+type ContactPatch struct {
+	GivenName   *string
+	FamilyName  *string
+	DisplayName *string
+	Nickname    *string
+	Company     *string
+	JobTitle    *string
+	Notes       *string
+	Phone       *string
+	PhoneE164   *string
+	Street      *string
+	City        *string
+	State       *string
+	ZipCode     *string
+	Country     *string
+
+	// Non-nil lists replace the contact's list of that kind.
+	Phones    []ContactPhone
+	Emails    []ContactEmail
+	Addresses []ContactAddress
+
+	Version int // Only update this version when non-zero, set to the new version on success
+}
+
+// Operations recorded in ContactRevision.Operation.
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionRestore  = "restore"
+	RevisionSnapshot = "snapshot"
+	RevisionMerge    = "merge"  // The survivor of a merge, with the fields taken from the others
+	RevisionMerged   = "merged" // A contact merged into another and moved to the trash
+)
+
+// ContactRevision is the state of a contact after one write to it.
+type ContactRevision struct {
+	ContactID uuid.UUID      `db:"contact_id"` // Contact the revision belongs to
+	Revision  int            `db:"revision"`   // Contact version after the change
+	Operation string         `db:"operation"`  // One of the Revision constants
+	ChangedBy uuid.UUID      `db:"changed_by"` // User whose request made the change
+	Data      map[string]any `db:"data"`       // Contact fields after the change, keyed by JSON name
+	ChangedAt time.Time      `db:"changed_at"` // Changed timestamp
+}
+
+// ContactTombstone records a deleted contact for the CardDAV change feed.
+type ContactTombstone struct {
+	ContactID uuid.UUID `db:"contact_id"` // ID of the deleted contact
+	DAVName   string    `db:"dav_name"`   // CardDAV resource name, "" for "<id>.vcf"
+	SyncSeq   int64     `db:"sync_seq"`   // Change feed position of the deletion
 }
 
 type ContactWithUserResponse struct {
 	ContactID uuid.UUID `json:"contact_id"`
-	Phone     string    `json:"phone"`
-	Street    string    `json:"street"`
-	City      string    `json:"city"`
-	State     string    `json:"state"`
-	ZipCode   string    `json:"zip_code"`
-	Country   string    `json:"country"`
+	ContactProfile
+	Phone     string `json:"phone"`
+	PhoneE164 string `json:"phone_e164"`
+	Street    string `json:"street"`
+	City      string `json:"city"`
+	State     string `json:"state"`
+	ZipCode   string `json:"zip_code"`
+	Country   string `json:"country"`
+	Version   int    `json:"-"`
+
+	Phones    []ContactPhone   `json:"phones"`
+	Emails    []ContactEmail   `json:"emails"`
+	Addresses []ContactAddress `json:"addresses"`
 
 	UserName  string `json:"user_name"`
 	UserEmail string `json:"user_email"`
 }
+
+// Tag groups contacts of one user.
+type Tag struct {
+	ID           uuid.UUID `json:"id" db:"id"`                       // Unique ID for each tag
+	UserID       uuid.UUID `json:"-" db:"user_id"`                   // Foreign key to users table
+	Name         string    `json:"name" db:"name"`                   // Unique per user ignoring case
+	ContactCount int       `json:"contact_count" db:"contact_count"` // Live contacts with the tag, set when reading
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`       // Created timestamp
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`       // Updated timestamp
+}
+
+// TagFacet counts the contacts of a listing that have a tag.
+type TagFacet struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Count int       `json:"count"`
+}
+
+// DuplicateMatch is a pair of live contacts that are likely the same person,
+// with the similarities that make them so.
+type DuplicateMatch struct {
+	ContactIDs        [2]uuid.UUID `json:"contact_ids"`
+	SamePhone         bool         `json:"same_phone"`         // They share a phone number, compared in E.164
+	NameSimilarity    float64      `json:"name_similarity"`    // Trigram similarity of their names, 0 to 1
+	AddressSimilarity float64      `json:"address_similarity"` // Trigram similarity of their primary addresses, 0 to 1
+	Score             float64      `json:"score"`              // Mean of the three, 0 to 1
+}
+
+// ContactMerge records contacts merged into a survivor, which took each
+// field from the contact named in Fields. The merged contacts are moved to
+// the trash.
+type ContactMerge struct {
+	ID               uuid.UUID         `json:"id" db:"id"`
+	UserID           uuid.UUID         `json:"-" db:"user_id"`
+	SurvivorID       uuid.UUID         `json:"survivor_id" db:"survivor_id"`
+	SurvivorRevision int               `json:"survivor_revision" db:"survivor_revision"` // Revision of the survivor the merge wrote
+	MergedIDs        []uuid.UUID       `json:"merged_ids"`                               // Contacts merged into the survivor
+	Fields           map[string]string `json:"fields" db:"fields"`                       // Contact ID each field was taken from, or "all" for a combined list, keyed by JSON name
+	MergedAt         time.Time         `json:"merged_at" db:"merged_at"`
+}
+
+type RefreshToken struct {
+	ID         uuid.UUID  `db:"id"`          // Token ID, matches the JWT "jti" claim
+	UserID     uuid.UUID  `db:"user_id"`     // Foreign key to users table
+	FamilyID   uuid.UUID  `db:"family_id"`   // Shared by every token rotated from one login
+	ReplacedBy *uuid.UUID `db:"replaced_by"` // Set once the token has been rotated
+	ExpiresAt  time.Time  `db:"expires_at"`  // Expiry timestamp
+	RevokedAt  *time.Time `db:"revoked_at"`  // Set on logout or reuse detection
+	CreatedAt  time.Time  `db:"created_at"`  // Created timestamp
+}
+
+type PasswordResetToken struct {
+	Hash      []byte     `db:"token_hash"` // SHA-256 of the token sent to the user
+	UserID    uuid.UUID  `db:"user_id"`    // Foreign key to users table
+	ExpiresAt time.Time  `db:"expires_at"` // Expiry timestamp
+	UsedAt    *time.Time `db:"used_at"`    // Set once redeemed or superseded
+	CreatedAt time.Time  `db:"created_at"` // Created timestamp
+}
+
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusDead    = "dead"
+)
+
+// JobWorkerLost is the error of a job whose worker never reported back, as
+// when it crashed or hung on every attempt.
+const JobWorkerLost = "worker lost: the job was still running after its lock timed out"
+
+type Job struct {
+	ID          int64           `db:"id"`           // Job ID
+	Kind        string          `db:"kind"`         // Selects the handler that runs the job
+	Payload     json.RawMessage `db:"payload"`      // Handler input
+	Status      string          `db:"status"`       // One of the JobStatus constants
+	Attempts    int             `db:"attempts"`     // Number of times the job was claimed
+	MaxAttempts int             `db:"max_attempts"` // Attempts before the job is dead-lettered
+	RunAt       time.Time       `db:"run_at"`       // Earliest time the job may run
+	LastError   *string         `db:"last_error"`   // Error of the latest failed attempt
+	CreatedAt   time.Time       `db:"created_at"`   // Created timestamp
+}
@@ -2,9 +2,9 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pkg/errors"
@@ -92,9 +92,9 @@ func monitorPoolStats(pool *pgxpool.Pool) {
 func (repo *PgxRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	var user User
 	query := `SELECT id, name, email, password, is_active FROM users WHERE email = $1`
-	err := repo.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.IsActive)
+	err := repo.conn(ctx).QueryRow(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.IsActive)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &user, nil
 }
@@ -102,189 +102,461 @@ func (repo *PgxRepository) GetUserByEmail(ctx context.Context, email string) (*U
 func (repo *PgxRepository) CreateUser(ctx context.Context, user *User) error {
 	query := `INSERT INTO users (id, name, email, password, is_active,created_at, updated_at) 
 	          VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING id`
-	err := repo.db.QueryRow(ctx, query, user.ID, user.Name, user.Email, user.Password, user.IsActive).Scan(&user.ID)
+	err := repo.conn(ctx).QueryRow(ctx, query, user.ID, user.Name, user.Email, user.Password, user.IsActive).Scan(&user.ID)
 	if err != nil {
-		return err
+		return mapError(err)
 	}
 	return nil
 }
 
 func (repo *PgxRepository) ActivateUserByID(ctx context.Context, userID uuid.UUID) error {
 	query := `UPDATE users SET is_active = TRUE WHERE id = $1`
-	result, err := repo.db.Exec(ctx, query, userID)
-	rowsAffected := result.RowsAffected()
+	result, err := repo.conn(ctx).Exec(ctx, query, userID)
 	if err != nil {
-		return err
+		return mapError(err)
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("user with ID %s not found", userID)
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
 	}
 	return nil
 }
 
-func (repo *PgxRepository) GetAllContacts(ctx context.Context, userID uuid.UUID, limit, offset int) ([]Contact, error) {
-	query := `
-		SELECT id, phone, street, city, state, zip_code, country 
-		FROM contacts 
-		WHERE user_id = $1 
-		LIMIT $2 OFFSET $3`
-	rows, err := repo.db.Query(ctx, query, userID, limit, offset)
+func (repo *PgxRepository) GetAllContacts(ctx context.Context, userID uuid.UUID, filter ContactFilter, limit, offset int) ([]Contact, error) {
+	q := buildContactQuery(userID, filter)
+
+	score := "0"
+	if q.score != "" {
+		score = q.score
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, %s, phone, phone_e164, street, city, state, zip_code, country, deleted_at, %s AS score, %s
+		FROM contacts
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s OFFSET %s`, contactProfileColumns, score, contactDetailColumns, q.where(), q.orderBy(), q.arg(limit), q.arg(offset))
+	rows, err := repo.conn(ctx).Query(ctx, query, q.args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var contacts []Contact
+	for rows.Next() {
+		var contact Contact
+		targets := append([]any{&contact.ID}, contact.scanTargets()...)
+		targets = append(targets, &contact.Phone, &contact.PhoneE164, &contact.Street, &contact.City, &contact.State, &contact.ZipCode, &contact.Country, &contact.DeletedAt, &contact.Score,
+			&contact.Phones, &contact.Emails, &contact.Addresses)
+		err := rows.Scan(targets...)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		contacts = append(contacts, contact)
+	}
+
+	return contacts, mapError(rows.Err())
+}
+
+// GetContactsPage returns up to limit contacts following key in (created_at, id)
+// order, or the first page when key is nil. Rows are always returned in display
+// order, including when walking backward.
+func (repo *PgxRepository) GetContactsPage(ctx context.Context, userID uuid.UUID, filter ContactFilter, key *ContactKeyset, limit int) ([]Contact, error) {
+	desc, err := filter.KeysetDescending()
 	if err != nil {
 		return nil, err
 	}
+
+	q := buildContactQuery(userID, filter)
+	orderBy := q.keyset(key, desc)
+	query := fmt.Sprintf(`
+		SELECT id, %s, phone, phone_e164, street, city, state, zip_code, country, created_at, %s
+		FROM contacts
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s`, contactProfileColumns, contactDetailColumns, q.where(), orderBy, q.arg(limit))
+	rows, err := repo.conn(ctx).Query(ctx, query, q.args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
 	defer rows.Close()
 
 	var contacts []Contact
 	for rows.Next() {
 		var contact Contact
-		err := rows.Scan(&contact.ID, &contact.Phone, &contact.Street, &contact.City, &contact.State, &contact.ZipCode, &contact.Country)
+		targets := append([]any{&contact.ID}, contact.scanTargets()...)
+		targets = append(targets, &contact.Phone, &contact.PhoneE164, &contact.Street, &contact.City, &contact.State, &contact.ZipCode, &contact.Country, &contact.CreatedAt,
+			&contact.Phones, &contact.Emails, &contact.Addresses)
+		err := rows.Scan(targets...)
 		if err != nil {
-			return nil, err
+			return nil, mapError(err)
 		}
 		contacts = append(contacts, contact)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
 
-	return contacts, rows.Err()
+	if key != nil && key.Backward {
+		for i, j := 0, len(contacts)-1; i < j; i, j = i+1, j-1 {
+			contacts[i], contacts[j] = contacts[j], contacts[i]
+		}
+	}
+	return contacts, nil
 }
 
+// CreateContact inserts a contact together with its lists.
 func (repo *PgxRepository) CreateContact(ctx context.Context, contact *Contact) error {
 	query := `
         INSERT INTO contacts 
-        (id, user_id, phone, street, city, state, zip_code, country, created_at, updated_at) 
+        (id, user_id, phone, phone_e164, street, city, state, zip_code, country, ` + contactProfileColumns + `, created_at, updated_at) 
         VALUES 
-        ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+        ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NOW(), NOW())
+        RETURNING version
     `
-	_, err := repo.db.Exec(
-		ctx, query,
-		contact.ID, contact.UserID, contact.Phone, contact.Street, contact.City, contact.State, contact.ZipCode, contact.Country,
-	)
-	return err
+	args := append([]any{contact.ID, contact.UserID, contact.Phone, contact.PhoneE164, contact.Street, contact.City, contact.State, contact.ZipCode, contact.Country}, contact.values()...)
+	return repo.InTx(ctx, func(ctx context.Context) error {
+		err := repo.conn(ctx).QueryRow(ctx, query, args...).Scan(&contact.Version)
+		if err != nil {
+			return mapError(err)
+		}
+		return repo.copyContactDetails(ctx, []Contact{*contact})
+	})
 }
 
-func (repo *PgxRepository) GetContactByID(ctx context.Context, contactID uuid.UUID) (*ContactWithUserResponse, error) {
+// CopyContacts bulk inserts contacts and their lists with the COPY protocol.
+// It is meant for imports, so callers pass a bounded batch and run the batches
+// in one InTx.
+func (repo *PgxRepository) CopyContacts(ctx context.Context, contacts []Contact) (int64, error) {
+	columns := append([]string{"id", "user_id", "phone", "phone_e164", "street", "city", "state", "zip_code", "country"}, strings.Split(contactProfileColumns, ", ")...)
+	count, err := repo.conn(ctx).CopyFrom(ctx, pgx.Identifier{"contacts"}, columns, pgx.CopyFromSlice(len(contacts), func(i int) ([]any, error) {
+		c := contacts[i]
+		return append([]any{c.ID, c.UserID, c.Phone, c.PhoneE164, c.Street, c.City, c.State, c.ZipCode, c.Country}, c.values()...), nil
+	}))
+	if err != nil {
+		return count, mapError(err)
+	}
+	return count, repo.copyContactDetails(ctx, contacts)
+}
+
+// StreamContacts calls fn for every contact of the user matching filter, one
+// row at a time, so exports never hold the whole address book in memory. The
+// iteration stops at the first error returned by fn.
+func (repo *PgxRepository) StreamContacts(ctx context.Context, userID uuid.UUID, filter ContactFilter, fn func(*Contact) error) error {
+	q := buildContactQuery(userID, filter)
+
+	score := "0"
+	if q.score != "" {
+		score = q.score
+	}
+
+	// The rows carry their relevance as score, which searches are ordered by.
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM (SELECT *, %s AS score FROM contacts WHERE %s) AS contacts
+		ORDER BY %s`, contactObjectColumns, score, q.where(), q.orderBy())
+	rows, err := repo.conn(ctx).Query(ctx, query, q.args...)
+	if err != nil {
+		return mapError(err)
+	}
+	defer rows.Close()
+
+	contact := Contact{UserID: userID}
+	for rows.Next() {
+		if err := scanContactObject(rows, &contact); err != nil {
+			return mapError(err)
+		}
+		if err := fn(&contact); err != nil {
+			return err
+		}
+	}
+	return mapError(rows.Err())
+}
+
+func (repo *PgxRepository) GetContactByID(ctx context.Context, userID, contactID uuid.UUID) (*ContactWithUserResponse, error) {
 	query := `
        SELECT
            contacts.id AS contact_id,
+           ` + contactProfileColumns + `,
            contacts.phone,
+           contacts.phone_e164,
            contacts.street,
            contacts.city,
            contacts.state,
            contacts.zip_code,
            contacts.country,
+           contacts.version,
            users.name AS user_name,
-           users.email AS user_email
+           users.email AS user_email,
+           ` + contactDetailColumns + `
        FROM
            contacts
        JOIN
            users ON contacts.user_id = users.id
        WHERE
-           contacts.id = $1;
+           contacts.id = $1 AND contacts.user_id = $2 AND contacts.deleted_at IS NULL;
    `
 
 	var response ContactWithUserResponse
-	err := repo.db.QueryRow(ctx, query, contactID).Scan(
-		&response.ContactID,
+	targets := append([]any{&response.ContactID}, response.scanTargets()...)
+	err := repo.conn(ctx).QueryRow(ctx, query, contactID, userID).Scan(append(targets,
 		&response.Phone,
+		&response.PhoneE164,
 		&response.Street,
 		&response.City,
 		&response.State,
 		&response.ZipCode,
 		&response.Country,
+		&response.Version,
 		&response.UserName,
 		&response.UserEmail,
-	)
+		&response.Phones,
+		&response.Emails,
+		&response.Addresses,
+	)...)
 
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("no contact found with ID: %s", contactID)
-		}
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &response, nil
 }
 
-func (repo *PgxRepository) PatchContactByID(ctx context.Context, contactID uuid.UUID, contact *Contact) error {
+// PatchContactByID applies the non-nil fields of patch and sets patch.Version
+// to the new version. Lists are replaced as a whole. A non-zero patch.Version
+// makes the update conditional on the row still being at that version,
+// checked in the same statement; otherwise ErrPreconditionFailed is returned.
+func (repo *PgxRepository) PatchContactByID(ctx context.Context, userID, contactID uuid.UUID, patch *ContactPatch) error {
 
 	var queryParts []string
 	var args []interface{}
 	argID := 1
 
-	if contact.Phone != "" {
-		queryParts = append(queryParts, fmt.Sprintf("phone = $%d", argID))
-		args = append(args, contact.Phone)
-		argID++
-	}
-	if contact.Street != "" {
-		queryParts = append(queryParts, fmt.Sprintf("street = $%d", argID))
-		args = append(args, contact.Street)
-		argID++
-	}
-	if contact.City != "" {
-		queryParts = append(queryParts, fmt.Sprintf("city = $%d", argID))
-		args = append(args, contact.City)
-		argID++
-	}
-	if contact.State != "" {
-		queryParts = append(queryParts, fmt.Sprintf("state = $%d", argID))
-		args = append(args, contact.State)
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"given_name", patch.GivenName},
+		{"family_name", patch.FamilyName},
+		{"display_name", patch.DisplayName},
+		{"nickname", patch.Nickname},
+		{"company", patch.Company},
+		{"job_title", patch.JobTitle},
+		{"notes", patch.Notes},
+		{"phone", patch.Phone},
+		{"phone_e164", patch.PhoneE164},
+		{"street", patch.Street},
+		{"city", patch.City},
+		{"state", patch.State},
+		{"zip_code", patch.ZipCode},
+		{"country", patch.Country},
+	} {
+		if field.value == nil {
+			continue
+		}
+		queryParts = append(queryParts, fmt.Sprintf("%s = $%d", field.column, argID))
+		args = append(args, *field.value)
 		argID++
 	}
-	if contact.ZipCode != "" {
-		queryParts = append(queryParts, fmt.Sprintf("zip_code = $%d", argID))
-		args = append(args, contact.ZipCode)
-		argID++
+
+	hasDetails := patch.Phones != nil || patch.Emails != nil || patch.Addresses != nil
+	if len(queryParts) == 0 && !hasDetails {
+		return fmt.Errorf("no fields provided to update")
 	}
-	if contact.Country != "" {
-		queryParts = append(queryParts, fmt.Sprintf("country = $%d", argID))
-		args = append(args, contact.Country)
-		argID++
+
+	queryParts = append(queryParts, "version = version + 1", "updated_at = NOW()")
+	query := fmt.Sprintf("UPDATE contacts SET %s WHERE id = $%d AND user_id = $%d AND deleted_at IS NULL", strings.Join(queryParts, ", "), argID, argID+1)
+	args = append(args, contactID, userID)
+	if patch.Version != 0 {
+		query += fmt.Sprintf(" AND version = $%d", argID+2)
+		args = append(args, patch.Version)
 	}
+	query += " RETURNING version"
 
-	if len(queryParts) == 0 {
-		return fmt.Errorf("no fields provided to update")
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if err := repo.conn(ctx).QueryRow(ctx, query, args...).Scan(&patch.Version); err != nil {
+			return err
+		}
+		if !hasDetails {
+			return nil
+		}
+		return repo.replaceContactDetails(ctx, contactID, patch.Phones, patch.Emails, patch.Addresses)
+	})
+	if errors.Is(err, pgx.ErrNoRows) && patch.Version != 0 {
+		// Tell a stale version apart from a contact that is gone.
+		var exists bool
+		query = `SELECT EXISTS (SELECT 1 FROM contacts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`
+		if err := repo.conn(ctx).QueryRow(ctx, query, contactID, userID).Scan(&exists); err != nil {
+			return mapError(err)
+		}
+		if exists {
+			return ErrPreconditionFailed
+		}
 	}
+	return mapError(err)
+}
 
-	query := fmt.Sprintf("UPDATE contacts SET %s WHERE id = $%d", strings.Join(queryParts, ", "), argID)
-	args = append(args, contactID)
+// DeleteContactByID moves a contact to the trash, from where it can be
+// restored until PurgeDeletedContacts removes it for good.
+func (repo *PgxRepository) DeleteContactByID(ctx context.Context, userID, contactID uuid.UUID) error {
+	query := `
+       UPDATE contacts
+       SET deleted_at = NOW(), version = version + 1
+       WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL;
+   `
 
-	_, err := repo.db.Exec(ctx, query, args...)
+	result, err := repo.conn(ctx).Exec(ctx, query, contactID, userID)
 	if err != nil {
-		return err
+		return mapError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
 	}
 
 	return nil
 }
 
-func (repo *PgxRepository) DeleteContactByID(ctx context.Context, contactID uuid.UUID) error {
+func (repo *PgxRepository) GetContactsCount(ctx context.Context, userID uuid.UUID, filter ContactFilter) (int, error) {
+	q := buildContactQuery(userID, filter)
 	query := `
-       DELETE FROM contacts
-       WHERE id = $1;
-   `
+		SELECT COUNT(*)
+		FROM contacts
+		WHERE ` + q.where()
 
-	result, err := repo.db.Exec(ctx, query, contactID)
+	var count int
+	err := repo.conn(ctx).QueryRow(ctx, query, q.args...).Scan(&count)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return count, nil
+}
+
+func (repo *PgxRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, family_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())`
+	_, err := repo.conn(ctx).Exec(ctx, query, token.ID, token.UserID, token.FamilyID, token.ExpiresAt)
+	return mapError(err)
+}
+
+// RotateRefreshToken exchanges the token identified by tokenID for next, which
+// joins the same family. Presenting a token that was already rotated means it
+// has leaked, so the whole family is revoked and ErrRefreshTokenReused returned.
+func (repo *PgxRepository) RotateRefreshToken(ctx context.Context, tokenID uuid.UUID, next *RefreshToken) error {
+	tx, err := repo.conn(ctx).Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current RefreshToken
+	var expired bool
+	query := `
+		SELECT id, user_id, family_id, replaced_by, revoked_at, expires_at <= NOW()
+		FROM refresh_tokens
+		WHERE id = $1
+		FOR UPDATE`
+	err = tx.QueryRow(ctx, query, tokenID).Scan(
+		&current.ID, &current.UserID, &current.FamilyID, &current.ReplacedBy, &current.RevokedAt, &expired,
+	)
 	if err != nil {
-		return err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRefreshTokenNotFound
+		}
+		return mapError(err)
 	}
 
-	rowsAffected := result.RowsAffected()
+	if current.UserID != next.UserID {
+		return ErrRefreshTokenNotFound
+	}
+	if current.RevokedAt != nil {
+		return ErrRefreshTokenRevoked
+	}
+	if current.ReplacedBy != nil {
+		if _, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, current.FamilyID); err != nil {
+			return mapError(err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return mapError(err)
+		}
+		return ErrRefreshTokenReused
+	}
+	if expired {
+		return ErrRefreshTokenExpired
+	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	next.FamilyID = current.FamilyID
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())`,
+		next.ID, next.UserID, next.FamilyID, next.ExpiresAt,
+	)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE refresh_tokens SET replaced_by = $1 WHERE id = $2`, next.ID, current.ID); err != nil {
+		return mapError(err)
 	}
 
+	return mapError(tx.Commit(ctx))
+}
+
+// RevokeRefreshTokenFamily revokes the token identified by tokenID together
+// with every token rotated from the same login.
+func (repo *PgxRepository) RevokeRefreshTokenFamily(ctx context.Context, tokenID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE id = $1)`
+
+	result, err := repo.conn(ctx).Exec(ctx, query, tokenID)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRefreshTokenNotFound
+	}
 	return nil
 }
 
-func (repo *PgxRepository) GetContactsCount(ctx context.Context, userID uuid.UUID) (int, error) {
+func (repo *PgxRepository) CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error {
 	query := `
-		SELECT COUNT(*) 
-		FROM contacts 
-		WHERE user_id = $1`
+		INSERT INTO password_reset_tokens (token_hash, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())`
+	_, err := repo.conn(ctx).Exec(ctx, query, token.Hash, token.UserID, token.ExpiresAt)
+	return mapError(err)
+}
 
-	var count int
-	err := repo.db.QueryRow(ctx, query, userID).Scan(&count)
+// ResetPassword redeems an unused, unexpired reset token and sets the owner's
+// password. Every other outstanding reset token and every refresh token of the
+// user is invalidated in the same transaction. Unknown, used or expired tokens
+// yield ErrNotFound.
+func (repo *PgxRepository) ResetPassword(ctx context.Context, tokenHash []byte, passwordHash string) error {
+	tx, err := repo.conn(ctx).Begin(ctx)
 	if err != nil {
-		return 0, err
+		return mapError(err)
 	}
-	return count, nil
+	defer tx.Rollback(ctx)
+
+	var userID uuid.UUID
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`
+	if err = tx.QueryRow(ctx, query, tokenHash).Scan(&userID); err != nil {
+		return mapError(err)
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2`, passwordHash, userID); err != nil {
+		return mapError(err)
+	}
+	if _, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return mapError(err)
+	}
+	if _, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return mapError(err)
+	}
+
+	return mapError(tx.Commit(ctx))
 }
@@ -3,19 +3,55 @@ package repository
 import (
 	"context"
 	"github.com/gofrs/uuid"
+	"time"
 )
 
 // Repository defines the methods for user and contact management.
 
 type Repository interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	CreateUser(ctx context.Context, user *User) error
 	ActivateUserByID(ctx context.Context, userID uuid.UUID) error
-	GetAllContacts(ctx context.Context, userID uuid.UUID, limit, offset int) ([]Contact, error)
+	GetAllContacts(ctx context.Context, userID uuid.UUID, filter ContactFilter, limit, offset int) ([]Contact, error)
+	GetContactsPage(ctx context.Context, userID uuid.UUID, filter ContactFilter, key *ContactKeyset, limit int) ([]Contact, error)
 	CreateContact(ctx context.Context, contact *Contact) error
-	GetContactByID(ctx context.Context, contactID uuid.UUID) (*ContactWithUserResponse, error)
-	PatchContactByID(ctx context.Context, contactID uuid.UUID, contact *Contact) error
-	DeleteContactByID(ctx context.Context, contactID uuid.UUID) error
-	GetContactsCount(ctx context.Context, userID uuid.UUID) (int, error)
+	CopyContacts(ctx context.Context, contacts []Contact) (int64, error)
+	StreamContacts(ctx context.Context, userID uuid.UUID, filter ContactFilter, fn func(*Contact) error) error
+	GetContactByID(ctx context.Context, userID, contactID uuid.UUID) (*ContactWithUserResponse, error)
+	PatchContactByID(ctx context.Context, userID, contactID uuid.UUID, patch *ContactPatch) error
+	DeleteContactByID(ctx context.Context, userID, contactID uuid.UUID) error
+	RestoreContactByID(ctx context.Context, userID, contactID uuid.UUID) error
+	PurgeDeletedContacts(ctx context.Context, deletedBefore time.Time, limit int) (int64, error)
+	GetContactRevisions(ctx context.Context, userID, contactID uuid.UUID) ([]ContactRevision, error)
+	GetContactRevision(ctx context.Context, userID, contactID uuid.UUID, revision int) (*ContactRevision, error)
+	GetContactsCount(ctx context.Context, userID uuid.UUID, filter ContactFilter) (int, error)
+	GetContactObject(ctx context.Context, userID, contactID uuid.UUID) (*Contact, error)
+	PutContactObject(ctx context.Context, contact *Contact, cond ContactPrecondition) (bool, error)
+	GetContactsSyncSeq(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetContactChanges(ctx context.Context, userID uuid.UUID, since int64, limit int) (*ContactChanges, error)
+	GetPhonesWithoutE164(ctx context.Context, after uuid.UUID, limit int) ([]PhoneBackfill, error)
+	SetPhonesE164(ctx context.Context, phones []PhoneBackfill) error
+	GetAddressesToNormalize(ctx context.Context, after uuid.UUID, limit int) ([]AddressBackfill, error)
+	SetNormalizedAddresses(ctx context.Context, addresses []AddressBackfill) error
+	GetTags(ctx context.Context, userID uuid.UUID) ([]Tag, error)
+	GetTagByID(ctx context.Context, userID, tagID uuid.UUID) (*Tag, error)
+	CreateTag(ctx context.Context, tag *Tag) error
+	RenameTag(ctx context.Context, userID, tagID uuid.UUID, name string) error
+	DeleteTag(ctx context.Context, userID, tagID uuid.UUID) error
+	TagContacts(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) (int64, error)
+	UntagContacts(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) (int64, error)
+	GetTagFacets(ctx context.Context, userID uuid.UUID, filter ContactFilter) ([]TagFacet, error)
+	FindDuplicateContacts(ctx context.Context, userID uuid.UUID, limit int) ([]DuplicateMatch, error)
+	MergeContacts(ctx context.Context, merge *ContactMerge, survivor *ContactPatch, mergedVersions []int) error
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	RotateRefreshToken(ctx context.Context, tokenID uuid.UUID, next *RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, tokenID uuid.UUID) error
+	CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error
+	ResetPassword(ctx context.Context, tokenHash []byte, passwordHash string) error
+	EnqueueJob(ctx context.Context, job *Job) error
+	ClaimJobs(ctx context.Context, limit int, lockTimeout time.Duration) ([]Job, error)
+	CompleteJob(ctx context.Context, jobID int64) error
+	FailJob(ctx context.Context, jobID int64, jobErr string, retryAt *time.Time) error
 	Close()
 }
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// tagColumns are the columns scanned by scanTag. The contact count leaves out
+// contacts in the trash.
+const tagColumns = `t.id, t.user_id, t.name,
+	(SELECT COUNT(*) FROM contact_tags ct JOIN contacts c ON c.id = ct.contact_id
+	 WHERE ct.tag_id = t.id AND c.deleted_at IS NULL),
+	t.created_at, t.updated_at`
+
+func scanTag(row pgx.Row, tag *Tag) error {
+	return row.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.ContactCount, &tag.CreatedAt, &tag.UpdatedAt)
+}
+
+// GetTags returns the tags of a user ordered by name.
+func (repo *PgxRepository) GetTags(ctx context.Context, userID uuid.UUID) ([]Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags t
+		WHERE t.user_id = $1
+		ORDER BY lower(t.name), t.id`
+
+	rows, err := repo.conn(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := scanTag(rows, &tag); err != nil {
+			return nil, mapError(err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, mapError(rows.Err())
+}
+
+func (repo *PgxRepository) GetTagByID(ctx context.Context, userID, tagID uuid.UUID) (*Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags t
+		WHERE t.id = $1 AND t.user_id = $2`
+
+	var tag Tag
+	if err := scanTag(repo.conn(ctx).QueryRow(ctx, query, tagID, userID), &tag); err != nil {
+		return nil, mapError(err)
+	}
+	return &tag, nil
+}
+
+// CreateTag inserts tag and sets its timestamps. A name the user already has,
+// in any case, gives ErrUniqueViolation.
+func (repo *PgxRepository) CreateTag(ctx context.Context, tag *Tag) error {
+	query := `
+		INSERT INTO tags (id, user_id, name)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, updated_at`
+
+	err := repo.conn(ctx).QueryRow(ctx, query, tag.ID, tag.UserID, tag.Name).Scan(&tag.CreatedAt, &tag.UpdatedAt)
+	return mapError(err)
+}
+
+// RenameTag changes the name of a tag, which keeps its contacts.
+func (repo *PgxRepository) RenameTag(ctx context.Context, userID, tagID uuid.UUID, name string) error {
+	query := `
+		UPDATE tags SET name = $3, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2`
+
+	result, err := repo.conn(ctx).Exec(ctx, query, tagID, userID, name)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteTag deletes a tag and untags its contacts. The contacts themselves
+// are left alone.
+func (repo *PgxRepository) DeleteTag(ctx context.Context, userID, tagID uuid.UUID) error {
+	result, err := repo.conn(ctx).Exec(ctx, `DELETE FROM tags WHERE id = $1 AND user_id = $2`, tagID, userID)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TagContacts gives every tag in tagIDs to every contact in contactIDs, all or
+// nothing, and returns how many pairs were not tagged already. It returns
+// ErrNotFound unless every tag and every contact belongs to the user and no
+// contact is in the trash.
+func (repo *PgxRepository) TagContacts(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) (int64, error) {
+	var tagged int64
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if err := repo.checkTagTargets(ctx, userID, tagIDs, contactIDs); err != nil {
+			return err
+		}
+		query := `
+			INSERT INTO contact_tags (contact_id, tag_id)
+			SELECT c, t FROM unnest($1::uuid[]) c CROSS JOIN unnest($2::uuid[]) t
+			ON CONFLICT DO NOTHING`
+		result, err := repo.conn(ctx).Exec(ctx, query, contactIDs, tagIDs)
+		tagged = result.RowsAffected()
+		return err
+	})
+	return tagged, mapError(err)
+}
+
+// UntagContacts takes every tag in tagIDs from every contact in contactIDs and
+// returns how many pairs were tagged. It fails like TagContacts.
+func (repo *PgxRepository) UntagContacts(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) (int64, error) {
+	var untagged int64
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if err := repo.checkTagTargets(ctx, userID, tagIDs, contactIDs); err != nil {
+			return err
+		}
+		query := `DELETE FROM contact_tags WHERE contact_id = ANY($1) AND tag_id = ANY($2)`
+		result, err := repo.conn(ctx).Exec(ctx, query, contactIDs, tagIDs)
+		untagged = result.RowsAffected()
+		return err
+	})
+	return untagged, mapError(err)
+}
+
+// checkTagTargets returns ErrNotFound unless the user owns every tag and every
+// live contact listed. The contacts are locked so they cannot be deleted
+// before the transaction commits.
+func (repo *PgxRepository) checkTagTargets(ctx context.Context, userID uuid.UUID, tagIDs, contactIDs []uuid.UUID) error {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM tags WHERE id = ANY($2) AND user_id = $1) = cardinality(ARRAY(SELECT DISTINCT unnest($2::uuid[]))),
+			(SELECT COUNT(*) FROM (SELECT id FROM contacts WHERE id = ANY($3) AND user_id = $1 AND deleted_at IS NULL FOR SHARE) c)
+				= cardinality(ARRAY(SELECT DISTINCT unnest($3::uuid[])))`
+
+	var tagsFound, contactsFound bool
+	if err := repo.conn(ctx).QueryRow(ctx, query, userID, tagIDs, contactIDs).Scan(&tagsFound, &contactsFound); err != nil {
+		return err
+	}
+	if !tagsFound || !contactsFound {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetTagFacets counts, for every tag of the user, the contacts matching filter
+// that have it. Tags no matching contact has are included with a count of 0.
+// buildContactQuery always binds userID first, so the tags use $1 too.
+func (repo *PgxRepository) GetTagFacets(ctx context.Context, userID uuid.UUID, filter ContactFilter) ([]TagFacet, error) {
+	q := buildContactQuery(userID, filter)
+	query := `
+		SELECT t.id, t.name, COUNT(f.id)
+		FROM tags t
+		LEFT JOIN contact_tags ct ON ct.tag_id = t.id
+		LEFT JOIN (SELECT id FROM contacts WHERE ` + q.where() + `) f ON f.id = ct.contact_id
+		WHERE t.user_id = $1
+		GROUP BY t.id, t.name
+		ORDER BY lower(t.name), t.id`
+
+	rows, err := repo.conn(ctx).Query(ctx, query, q.args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	facets := []TagFacet{}
+	for rows.Next() {
+		var facet TagFacet
+		if err := rows.Scan(&facet.ID, &facet.Name, &facet.Count); err != nil {
+			return nil, mapError(err)
+		}
+		facets = append(facets, facet)
+	}
+	return facets, mapError(rows.Err())
+}
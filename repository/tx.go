@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// dbtx is the subset of pgxpool.Pool and pgx.Tx that repository methods use,
+// so each method runs either on the pool or inside the caller's transaction.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+type txKey struct{}
+
+// conn returns the transaction started by InTx if ctx carries one, and the
+// connection pool otherwise.
+func (repo *PgxRepository) conn(ctx context.Context) dbtx {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return repo.db
+}
+
+// InTx runs fn inside a transaction. Repository calls made with the context
+// passed to fn join that transaction, which is committed when fn returns nil
+// and rolled back otherwise. Nested calls become savepoints.
+func (repo *PgxRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := repo.conn(ctx).Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	return mapError(tx.Commit(ctx))
+}
@@ -2,20 +2,57 @@ package state
 
 import (
 	"github.com/caarlos0/env/v9"
+	utils "go_chi_pgx/utils"
+	"time"
 )
 
 type Config struct {
-	ApplicationPort int     `env:"APPLICATION_PORT" envDefault:""`
-	DatabaseUrl     string  `env:"DATABASE_URL" envDefault:""`
-	LogLevel        string  `env:"LOG_LEVEL" envDefault:"debug"`
-	SecretKey       string  `env:"SECRET_KEY" envDefault:"my_jwt_secret"`
-	Rps             float64 `env:"limiter_rps" envDefault:"0"`
-	Burst           int     `env:"limiter_burst" envDefault:"0"`
-	LimiterEnabled  bool    `env:"limiter_enabled" envDefault:"false"`
+	ApplicationPort int           `env:"APPLICATION_PORT" envDefault:""`
+	DatabaseUrl     string        `env:"DATABASE_URL" envDefault:""`
+	LogLevel        string        `env:"LOG_LEVEL" envDefault:"debug"`
+	SecretKey       string        `env:"SECRET_KEY" envDefault:"my_jwt_secret"`
+	ActivationKey   string        `env:"ACTIVATION_SECRET_KEY" envDefault:""` // Derived from SecretKey when unset
+	RefreshKey      string        `env:"REFRESH_SECRET_KEY" envDefault:""`    // Derived from SecretKey when unset
+	CursorKey       string        `env:"CURSOR_SECRET_KEY" envDefault:""`     // Derived from SecretKey when unset
+	RefreshTTL      time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"168h"`
+	ResetTTL        time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"15m"`
+	SMTPHost        string        `env:"SMTP_HOST" envDefault:""`
+	SMTPPort        int           `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername    string        `env:"SMTP_USERNAME" envDefault:""`
+	SMTPPassword    string        `env:"SMTP_PASSWORD" envDefault:""`
+	SMTPSender      string        `env:"SMTP_SENDER" envDefault:"Contacts <no-reply@contacts.local>"`
+	MailOutboxDir   string        `env:"MAIL_OUTBOX_DIR" envDefault:""`
+	JobWorkers      int           `env:"JOB_WORKERS" envDefault:"2"`
+	JobPollInterval time.Duration `env:"JOB_POLL_INTERVAL" envDefault:"1s"`
+	TrashRetention  time.Duration `env:"CONTACT_TRASH_RETENTION" envDefault:"720h"`
+	TrashPurgeEvery time.Duration `env:"CONTACT_TRASH_PURGE_INTERVAL" envDefault:"1h"`
+	PhoneRegion     string        `env:"PHONE_DEFAULT_REGION" envDefault:"US"`
+	Rps             float64       `env:"limiter_rps" envDefault:"0"`
+	Burst           int           `env:"limiter_burst" envDefault:"0"`
+	LimiterEnabled  bool          `env:"limiter_enabled" envDefault:"false"`
 }
 
 func NewConfig() (*Config, error) {
 	cfg := &Config{}
 	err := env.ParseWithOptions(cfg, env.Options{RequiredIfNoDef: true})
+	if cfg.ActivationKey == "" {
+		cfg.ActivationKey = utils.DeriveKey(cfg.SecretKey, utils.ScopeActivation)
+	}
+	if cfg.RefreshKey == "" {
+		cfg.RefreshKey = utils.DeriveKey(cfg.SecretKey, utils.ScopeRefresh)
+	}
+	if cfg.CursorKey == "" {
+		cfg.CursorKey = utils.DeriveKey(cfg.SecretKey, "cursor")
+	}
 	return cfg, err
 }
+
+// TokenKeys returns the signing key for every token scope. SecretKey keeps
+// signing access tokens so existing deployments don't need a new variable.
+func (c *Config) TokenKeys() utils.ScopeKeys {
+	return utils.ScopeKeys{
+		Activation:     c.ActivationKey,
+		Authentication: c.SecretKey,
+		Refresh:        c.RefreshKey,
+	}
+}
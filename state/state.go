@@ -1,6 +1,8 @@
 package state
 
 import (
+	"fmt"
+	"go_chi_pgx/mailer"
 	"go_chi_pgx/repository"
 	"sync"
 )
@@ -9,13 +11,33 @@ type State struct {
 	Config     *Config
 	Repository repository.Repository
 	Logger     *Logger
+	Mailer     mailer.Mailer
 	Wg         sync.WaitGroup
 }
 
-func NewState(cfg *Config, db repository.Repository, logger *Logger) *State {
+func NewState(cfg *Config, db repository.Repository, logger *Logger, mailer mailer.Mailer) *State {
 	return &State{
 		Config:     cfg,
 		Repository: db,
 		Logger:     logger,
+		Mailer:     mailer,
 	}
 }
+
+// Background runs fn in its own goroutine tracked by Wg, so that graceful
+// shutdown waits for it. Panics are recovered and logged.
+func (s *State) Background(fn func()) {
+	s.Wg.Add(1)
+
+	go func() {
+		defer s.Wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				s.Logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -14,6 +14,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestHandleActivateUser_Success(t *testing.T) {
@@ -27,12 +28,11 @@ func TestHandleActivateUser_Success(t *testing.T) {
 	}
 
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	userID := "b7358195-6291-4138-b115-2a046fe848f1"
 	claims := utils.Claims{UserID: uuid.FromStringOrNil(userID)}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString([]byte(cfg.SecretKey))
+	tokenString, _ := utils.GenerateJWT(claims.UserID, utils.ScopeActivation, cfg.ActivationKey, time.Hour)
 
 	mockRepo.On("ActivateUserByID", mock.Anything, claims.UserID).Return(nil)
 
@@ -58,7 +58,7 @@ func TestHandleActivateUser_InvalidToken(t *testing.T) {
 	}
 
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	userID := "b7358195-6291-4138-b115-2a046fe848f1"
 	claims := utils.Claims{UserID: uuid.FromStringOrNil(userID)}
@@ -88,12 +88,11 @@ func TestHandleActivateUser_ActivationError(t *testing.T) {
 	}
 
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	userID := "b7358195-6291-4138-b115-2a046fe848f1"
 	claims := utils.Claims{UserID: uuid.FromStringOrNil(userID)}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString([]byte(cfg.SecretKey))
+	tokenString, _ := utils.GenerateJWT(claims.UserID, utils.ScopeActivation, cfg.ActivationKey, time.Hour)
 
 	mockRepo.On("ActivateUserByID", mock.Anything, claims.UserID).Return(errors.New("db error"))
 
@@ -108,3 +107,31 @@ func TestHandleActivateUser_ActivationError(t *testing.T) {
 
 	mockRepo.AssertCalled(t, "ActivateUserByID", mock.Anything, claims.UserID)
 }
+
+func TestHandleActivateUser_WrongScope(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		logger.PrintError(err, map[string]string{
+			"context": "Error loading env value",
+		})
+	}
+
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	userID := uuid.FromStringOrNil("b7358195-6291-4138-b115-2a046fe848f1")
+	accessToken, _ := utils.GenerateJWT(userID, utils.ScopeAuthentication, cfg.SecretKey, time.Hour)
+
+	req := httptest.NewRequest(http.MethodGet, "/activate?token="+accessToken, nil)
+	w := httptest.NewRecorder()
+
+	handler := httpserver.HandleActivateUser(appState)
+	handler(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), "Token is not valid for this resource")
+
+	mockRepo.AssertNotCalled(t, "ActivateUserByID")
+}
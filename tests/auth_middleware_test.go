@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	userID := uuid.Must(uuid.NewV4())
+	protected := httpserver.AuthMiddleware(appState)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := httpserver.GetUserIDFromContext(r.Context())
+		assert.Equal(t, userID.String(), id)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	accessToken, _ := utils.GenerateJWT(userID, utils.ScopeAuthentication, cfg.SecretKey, time.Hour)
+	activationToken, _ := utils.GenerateJWT(userID, utils.ScopeActivation, cfg.ActivationKey, time.Hour)
+	refreshToken, _ := utils.GenerateRefreshToken(userID, uuid.Must(uuid.NewV4()), cfg.RefreshKey, cfg.RefreshTTL)
+	expiredToken, _ := utils.GenerateJWT(userID, utils.ScopeAuthentication, cfg.SecretKey, -time.Minute)
+	// A token carrying the authentication scope but signed with another scope's key.
+	forgedToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, utils.Claims{
+		UserID: userID,
+		Scope:  utils.ScopeAuthentication,
+	}).SignedString([]byte(cfg.ActivationKey))
+
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{name: "Access Token", token: accessToken, expectedCode: http.StatusOK},
+		{name: "Missing Token", token: "", expectedCode: http.StatusUnauthorized},
+		{name: "Activation Token", token: activationToken, expectedCode: http.StatusForbidden},
+		{name: "Refresh Token", token: refreshToken, expectedCode: http.StatusForbidden},
+		{name: "Expired Token", token: expiredToken, expectedCode: http.StatusUnauthorized},
+		{name: "Forged Token", token: forgedToken, expectedCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/contacts", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+
+			protected.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
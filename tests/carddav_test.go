@@ -0,0 +1,372 @@
+package tests
+
+import (
+	"context"
+	govcard "github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/carddav"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"go_chi_pgx/vcard"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCardDAV(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(httpserver.BasicAuthMiddleware(appState, "Contacts"))
+		r.Handle("/.well-known/carddav", httpserver.HandlerCardDAV(appState))
+		r.Mount("/carddav", httpserver.HandlerCardDAV(appState))
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	password := "correct horse"
+	hash, err := utils.HashPassword(password)
+	assert.NoError(t, err)
+	user := &repository.User{ID: uuid.Must(uuid.NewV4()), Email: "homer@example.com", Password: hash, IsActive: true}
+
+	principal := "/carddav/" + user.ID.String() + "/"
+	bookPath := principal + "contacts/default/"
+	client, err := carddav.NewClient(webdav.HTTPClientWithBasicAuth(server.Client(), user.Email, password), server.URL+"/carddav")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	expectLogin := func() {
+		mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	}
+	send := func(method, path, body string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.SetBasicAuth(user.Email, password)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+	readBody := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		mockRepo.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return((*repository.User)(nil), repository.ErrNotFound)
+
+		req, _ := http.NewRequest("PROPFIND", server.URL+bookPath, nil)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("WWW-Authenticate"), `Basic realm="Contacts"`)
+
+		req.SetBasicAuth("nobody@example.com", password)
+		resp, err = server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Discovery", func(t *testing.T) {
+		expectLogin()
+
+		found, err := client.FindCurrentUserPrincipal(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, principal, found)
+
+		homeSet, err := client.FindAddressBookHomeSet(ctx, found)
+		assert.NoError(t, err)
+		assert.Equal(t, principal+"contacts/", homeSet)
+
+		books, err := client.FindAddressBooks(ctx, homeSet)
+		assert.NoError(t, err)
+		assert.Len(t, books, 1)
+		assert.Equal(t, bookPath, books[0].Path)
+
+		noRedirect := *server.Client()
+		noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/.well-known/carddav", nil)
+		req.SetBasicAuth(user.Email, password)
+		resp, err := noRedirect.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+		assert.Equal(t, principal, resp.Header.Get("Location"))
+
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Address Book Properties", func(t *testing.T) {
+		expectLogin()
+		mockRepo.On("GetContactsSyncSeq", mock.Anything, user.ID).Return(int64(42), nil)
+
+		body := `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">` +
+			`<d:prop><d:sync-token/><cs:getctag/><d:resourcetype/><d:quota-used-bytes/></d:prop></d:propfind>`
+		resp := send("PROPFIND", bookPath, body, map[string]string{"Depth": "0", "Content-Type": "application/xml"})
+
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		xmlBody := readBody(resp)
+		assert.Contains(t, xmlBody, `<sync-token xmlns="DAV:">urn:go-chi-pgx:contacts:sync:42</sync-token>`)
+		assert.Contains(t, xmlBody, `<getctag xmlns="http://calendarserver.org/ns/">urn:go-chi-pgx:contacts:sync:42</getctag>`)
+		assert.Contains(t, xmlBody, `<addressbook xmlns="urn:ietf:params:xml:ns:carddav">`)
+		assert.Contains(t, xmlBody, `<quota-used-bytes xmlns="DAV:"></quota-used-bytes></prop><status>HTTP/1.1 404 Not Found</status>`)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	homer := repository.Contact{
+		ID: uuid.Must(uuid.NewV4()), UserID: user.ID, Phone: "217-555-0100", City: "Springfield",
+		SyncSeq: 7, UpdatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	marge := repository.Contact{
+		ID: uuid.NewV5(user.ID, "marge.vcf"), UserID: user.ID, Phone: "217-555-0199", City: "Shelbyville",
+		SyncSeq: 8, DAVName: "marge.vcf",
+	}
+
+	t.Run("Query And Multiget", func(t *testing.T) {
+		expectLogin()
+		mockRepo.On("StreamContacts", mock.Anything, user.ID, repository.ContactFilter{}).Return([]repository.Contact{homer, marge}, nil)
+		mockRepo.On("GetContactObject", mock.Anything, user.ID, marge.ID).Return(&marge, nil)
+		mockRepo.On("GetContactObject", mock.Anything, user.ID, homer.ID).Return(&homer, nil)
+
+		aos, err := client.QueryAddressBook(ctx, bookPath, &carddav.AddressBookQuery{
+			DataRequest: carddav.AddressDataRequest{AllProp: true},
+			PropFilters: []carddav.PropFilter{{Name: govcard.FieldTelephone, TextMatches: []carddav.TextMatch{{Text: "0100"}}}},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, aos, 1)
+		assert.Equal(t, bookPath+homer.ID.String()+".vcf", aos[0].Path)
+		assert.Equal(t, "7", aos[0].ETag)
+
+		aos, err = client.MultiGetAddressBook(ctx, bookPath, &carddav.AddressBookMultiGet{
+			Paths:       []string{bookPath + "marge.vcf"},
+			DataRequest: carddav.AddressDataRequest{AllProp: true},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, aos, 1)
+		assert.Equal(t, "217-555-0199", aos[0].Card.Value(govcard.FieldTelephone))
+
+		ao, err := client.GetAddressObject(ctx, bookPath+homer.ID.String()+".vcf")
+		assert.NoError(t, err)
+		assert.Equal(t, "7", ao.ETag)
+		assert.Equal(t, "Springfield", ao.Card.Address().Locality)
+
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Put", func(t *testing.T) {
+		expectLogin()
+		bartID := uuid.NewV5(user.ID, "bart.vcf")
+		mockRepo.On("PutContactObject", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return contact.ID == bartID && contact.UserID == user.ID && contact.DAVName == "bart.vcf" && contact.Phone == "555-0142" && contact.PhoneE164 == ""
+		}), repository.ContactPrecondition{}).Return(true, nil)
+		mockRepo.On("PutContactObject", mock.Anything, mock.Anything, repository.ContactPrecondition{SyncSeq: 5}).
+			Return(false, repository.ErrPreconditionFailed)
+
+		card := govcard.Card{}
+		card.SetValue(govcard.FieldVersion, "3.0")
+		card.SetValue(govcard.FieldFormattedName, "Bart Simpson")
+		card.SetValue(govcard.FieldTelephone, "555-0142")
+		ao, err := client.PutAddressObject(ctx, bookPath+"bart.vcf", card)
+		assert.NoError(t, err)
+		assert.Equal(t, "", ao.ETag)
+
+		// Devices keep local numbers without an area code; they are stored as
+		// sent instead of stalling the sync.
+		vcf := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Bart\r\nTEL:555-0142\r\nEND:VCARD\r\n"
+		resp := send(http.MethodPut, bookPath+"bart.vcf", vcf, map[string]string{"Content-Type": "text/vcard"})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp = send(http.MethodPut, bookPath+"bart.vcf", vcf, map[string]string{"Content-Type": "text/vcard", "If-Match": `"5"`})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+		resp = send(http.MethodPut, bookPath+"lisa.vcf", "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Lisa\r\nEND:VCARD\r\n", map[string]string{"Content-Type": "text/vcard"})
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Contains(t, readBody(resp), "valid-address-data")
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Put Unknown Address Values", func(t *testing.T) {
+		expectLogin()
+		var stored []*repository.Contact
+		mockRepo.On("PutContactObject", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			stored = append(stored, contact)
+			return true
+		}), repository.ContactPrecondition{}).Return(true, nil)
+
+		// A country in the language of the device is kept as sent, and so are a
+		// state and zip code that aren't known for a known country.
+		vcf := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Carl\r\nTEL:+49 89 1234567\r\n" +
+			"ADR:;;Marienplatz 1;München;Bayern-Land;8033;Deutschland\r\n" +
+			"END:VCARD\r\n"
+		resp := send(http.MethodPut, bookPath+"carl.vcf", vcf, map[string]string{"Content-Type": "text/vcard"})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		vcf = "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Lenny\r\nTEL:+49 89 1234567\r\n" +
+			"ADR:;;Marienplatz 1;München;Bayern-Land;8033;Germany\r\n" +
+			"END:VCARD\r\n"
+		resp = send(http.MethodPut, bookPath+"lenny.vcf", vcf, map[string]string{"Content-Type": "text/vcard"})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		if assert.Len(t, stored, 2) {
+			assert.Equal(t, "Deutschland", stored[0].Country)
+			assert.Equal(t, "Bayern-Land", stored[0].State)
+			assert.Equal(t, "8033", stored[0].ZipCode)
+			assert.Equal(t, "DE", stored[1].Country)
+			assert.Equal(t, "Bayern-Land", stored[1].State)
+			assert.Equal(t, "8033", stored[1].ZipCode)
+			assert.Equal(t, "+49891234567", stored[1].PhoneE164)
+		}
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Escaped Semicolons Round Trip", func(t *testing.T) {
+		expectLogin()
+		lennyID := uuid.NewV5(user.ID, "lenny.vcf")
+		var stored *repository.Contact
+		mockRepo.On("PutContactObject", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			stored = contact
+			return contact.ID == lennyID
+		}), repository.ContactPrecondition{}).Return(true, nil)
+
+		vcf := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Lenny\r\nTEL:217-555-0177\r\n" +
+			"ORG:Sector 7G\\; Nuclear Plant\r\n" +
+			"ADR:;;742 Evergreen Terrace\\; Apt 1;Springfield;OR;97477;US\r\n" +
+			"END:VCARD\r\n"
+		resp := send(http.MethodPut, bookPath+"lenny.vcf", vcf, map[string]string{"Content-Type": "text/vcard"})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		if assert.NotNil(t, stored) {
+			assert.Equal(t, "Sector 7G; Nuclear Plant", stored.Company)
+			assert.Equal(t, "742 Evergreen Terrace; Apt 1", stored.Street)
+			assert.Equal(t, "Springfield", stored.City)
+
+			mockRepo.On("GetContactObject", mock.Anything, user.ID, lennyID).Return(stored, nil)
+			ao, err := client.GetAddressObject(ctx, bookPath+"lenny.vcf")
+			assert.NoError(t, err)
+			fetched := vcard.ToContact(vcard.FromLibrary(ao.Card))
+			assert.Equal(t, stored.Company, fetched.Company)
+			assert.Equal(t, stored.Street, fetched.Street)
+		}
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		expectLogin()
+		mockRepo.On("GetContactObject", mock.Anything, user.ID, homer.ID).Return(&homer, nil)
+		mockRepo.On("DeleteContactByID", mock.Anything, user.ID, homer.ID).Return(nil).Once()
+
+		resp := send(http.MethodDelete, bookPath+homer.ID.String()+".vcf", "", map[string]string{"If-Match": `"6"`})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+		mockRepo.AssertNotCalled(t, "DeleteContactByID", mock.Anything, user.ID, homer.ID)
+
+		resp = send(http.MethodDelete, bookPath+homer.ID.String()+".vcf", "", map[string]string{"If-Match": `"7"`})
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Sync Collection", func(t *testing.T) {
+		expectLogin()
+		mockRepo.On("GetContactChanges", mock.Anything, user.ID, int64(40), 0).Return(&repository.ContactChanges{
+			Updated: []repository.Contact{marge},
+			Deleted: []repository.ContactTombstone{{ContactID: uuid.NewV5(user.ID, "maude.vcf"), DAVName: "maude.vcf", SyncSeq: 9}},
+			SyncSeq: 9,
+		}, nil)
+		mockRepo.On("GetContactChanges", mock.Anything, user.ID, int64(99), 0).Return(nil, repository.ErrInvalidSyncToken)
+		mockRepo.On("GetContactChanges", mock.Anything, user.ID, int64(0), 1).Return(&repository.ContactChanges{
+			Updated:   []repository.Contact{homer},
+			SyncSeq:   7,
+			Truncated: true,
+		}, nil)
+
+		changes, err := client.SyncCollection(ctx, bookPath, &carddav.SyncQuery{
+			SyncToken:   "urn:go-chi-pgx:contacts:sync:40",
+			DataRequest: carddav.AddressDataRequest{AllProp: true},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "urn:go-chi-pgx:contacts:sync:9", changes.SyncToken)
+		assert.Len(t, changes.Updated, 1)
+		assert.Equal(t, bookPath+"marge.vcf", changes.Updated[0].Path)
+		assert.Equal(t, "8", changes.Updated[0].ETag)
+		assert.Equal(t, []string{bookPath + "maude.vcf"}, changes.Deleted)
+
+		for _, token := range []string{"urn:go-chi-pgx:contacts:sync:99", "http://example.com/other-server"} {
+			body := `<d:sync-collection xmlns:d="DAV:"><d:sync-token>` + token + `</d:sync-token>` +
+				`<d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+			resp := send("REPORT", bookPath, body, map[string]string{"Content-Type": "application/xml"})
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Contains(t, readBody(resp), "valid-sync-token")
+		}
+
+		body := `<d:sync-collection xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav"><d:sync-token/>` +
+			`<d:sync-level>1</d:sync-level><d:limit><d:nresults>1</d:nresults></d:limit>` +
+			`<d:prop><d:getetag/><c:address-data version="4.0"/></d:prop></d:sync-collection>`
+		resp := send("REPORT", bookPath, body, map[string]string{"Content-Type": "application/xml"})
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		xmlBody := readBody(resp)
+		assert.Contains(t, xmlBody, "VERSION:4.0")
+		assert.Contains(t, xmlBody, `<href>`+bookPath+`</href><status>HTTP/1.1 507 Insufficient Storage</status>`)
+		assert.Contains(t, xmlBody, `<sync-token>urn:go-chi-pgx:contacts:sync:7</sync-token>`)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go_chi_pgx/state"
+	"testing"
+)
+
+func TestConfigTokenKeys(t *testing.T) {
+	t.Run("Derived From Secret Key", func(t *testing.T) {
+		t.Setenv("SECRET_KEY", "s3cret")
+		t.Setenv("ACTIVATION_SECRET_KEY", "")
+		t.Setenv("REFRESH_SECRET_KEY", "")
+		t.Setenv("CURSOR_SECRET_KEY", "")
+
+		cfg, err := state.NewConfig()
+		assert.NoError(t, err)
+		assert.NotEmpty(t, cfg.ActivationKey)
+		assert.NotEmpty(t, cfg.RefreshKey)
+		assert.NotEqual(t, cfg.SecretKey, cfg.ActivationKey)
+		assert.NotEqual(t, cfg.SecretKey, cfg.RefreshKey)
+		assert.NotEqual(t, cfg.ActivationKey, cfg.RefreshKey)
+		assert.NotEmpty(t, cfg.CursorKey)
+		assert.NotContains(t, []string{cfg.SecretKey, cfg.ActivationKey, cfg.RefreshKey}, cfg.CursorKey)
+
+		t.Setenv("SECRET_KEY", "another")
+		other, err := state.NewConfig()
+		assert.NoError(t, err)
+		assert.NotEqual(t, cfg.ActivationKey, other.ActivationKey)
+	})
+
+	t.Run("Set Explicitly", func(t *testing.T) {
+		t.Setenv("ACTIVATION_SECRET_KEY", "activation")
+		t.Setenv("REFRESH_SECRET_KEY", "refresh")
+		t.Setenv("CURSOR_SECRET_KEY", "cursor")
+
+		cfg, err := state.NewConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, "activation", cfg.ActivationKey)
+		assert.Equal(t, "refresh", cfg.RefreshKey)
+		assert.Equal(t, "cursor", cfg.CursorKey)
+	})
+}
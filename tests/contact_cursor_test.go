@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestContactsCursorPagination(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Get("/contacts", httpserver.HandlerGetAllContacts(appState))
+
+	userID := uuid.Must(uuid.NewV4()).String()
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	contacts := make([]repository.Contact, 3)
+	for i := range contacts {
+		contacts[i] = repository.Contact{
+			ID:        uuid.Must(uuid.NewV4()),
+			City:      "Springfield",
+			CreatedAt: created.Add(-time.Duration(i) * time.Minute),
+		}
+	}
+
+	get := func(target string) (*httptest.ResponseRecorder, ContactsResponse) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response ContactsResponse
+		_ = json.NewDecoder(w.Body).Decode(&response)
+		return w, response
+	}
+
+	cursorOf := func(t *testing.T, link string) string {
+		parsed, err := url.Parse(link)
+		assert.NoError(t, err)
+		return parsed.Query().Get("cursor")
+	}
+
+	t.Run("First Page", func(t *testing.T) {
+		filter := repository.ContactFilter{City: "Springfield"}
+		mockRepo.On("GetContactsPage", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter, (*repository.ContactKeyset)(nil), 3).Return(contacts, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return(5, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return([]repository.TagFacet{}, nil)
+
+		w, response := get("/contacts?page_size=2&city=Springfield")
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, httpserver.PaginationCursor, response.Data.Mode)
+		assert.Equal(t, 5, response.Data.TotalCount)
+		assert.Len(t, response.Data.Contacts, 2)
+		assert.Equal(t, "", response.Data.Previous)
+		assert.Contains(t, response.Data.Next, "city=Springfield")
+		assert.Contains(t, response.Data.Next, "page_size=2")
+
+		var cursor struct {
+			CreatedAt time.Time `json:"t"`
+			ID        uuid.UUID `json:"id"`
+			Backward  bool      `json:"b"`
+		}
+		err := utils.VerifyCursor(cursorOf(t, response.Data.Next), cfg.CursorKey, &cursor)
+		assert.NoError(t, err)
+		assert.Equal(t, contacts[1].ID, cursor.ID)
+		assert.True(t, contacts[1].CreatedAt.Equal(cursor.CreatedAt))
+		assert.False(t, cursor.Backward)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Follow Next And Previous", func(t *testing.T) {
+		next, err := utils.SignCursor(map[string]interface{}{"t": contacts[0].CreatedAt, "id": contacts[0].ID}, cfg.CursorKey)
+		assert.NoError(t, err)
+
+		forward := &repository.ContactKeyset{CreatedAt: contacts[0].CreatedAt, ID: contacts[0].ID}
+		mockRepo.On("GetContactsPage", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}, forward, 3).Return(contacts[1:], nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return(3, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return([]repository.TagFacet{}, nil)
+
+		w, response := get("/contacts?page_size=2&cursor=" + url.QueryEscape(next))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Len(t, response.Data.Contacts, 2)
+		assert.Equal(t, "", response.Data.Next)
+		assert.NotEqual(t, "", response.Data.Previous)
+
+		backward := &repository.ContactKeyset{CreatedAt: contacts[1].CreatedAt, ID: contacts[1].ID, Backward: true}
+		mockRepo.On("GetContactsPage", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}, backward, 3).Return(contacts[:1], nil)
+
+		w, response = get("/contacts?page_size=2&cursor=" + url.QueryEscape(cursorOf(t, response.Data.Previous)))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Len(t, response.Data.Contacts, 1)
+		assert.Equal(t, contacts[0].ID.String(), response.Data.Contacts[0].ID)
+		assert.Equal(t, "", response.Data.Previous)
+		assert.NotEqual(t, "", response.Data.Next)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Rejected Cursors", func(t *testing.T) {
+		forged, err := utils.SignCursor(map[string]interface{}{"id": contacts[0].ID}, "not-the-cursor-key")
+		assert.NoError(t, err)
+
+		for _, query := range []string{
+			"cursor=" + url.QueryEscape(forged),
+			"cursor=garbage",
+			"page_size=0",
+			"page_size=10&q=springfield",
+			"page_size=10&sort=city",
+		} {
+			w, _ := get("/contacts?" + query)
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, query)
+		}
+		mockRepo.AssertNotCalled(t, "GetContactsPage")
+	})
+
+	t.Run("Offset Mode", func(t *testing.T) {
+		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}, 10, 0).Return(contacts, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return(3, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return([]repository.TagFacet{}, nil)
+
+		w, response := get("/contacts")
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, httpserver.PaginationOffset, response.Data.Mode)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
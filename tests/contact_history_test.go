@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestContactHistory(t *testing.T) {
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Get("/contacts/{id}/history", httpserver.HandlerGetContactHistory(appState))
+	r.Post("/contacts/{id}/revert", httpserver.HandlerRevertContactByID(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	contactID := uuid.Must(uuid.NewV4())
+	changedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	revisions := []repository.ContactRevision{
+		{ContactID: contactID, Revision: 1, Operation: repository.RevisionCreate, ChangedBy: userID, ChangedAt: changedAt,
+			Data: map[string]any{"phone": "217-555-0100", "city": "Springfield", "street": "742 Evergreen Terrace"}},
+		{ContactID: contactID, Revision: 2, Operation: repository.RevisionUpdate, ChangedBy: userID, ChangedAt: changedAt.Add(time.Hour),
+			Data: map[string]any{"phone": "217-555-0199", "city": "Springfield", "street": ""}},
+		{ContactID: contactID, Revision: 3, Operation: repository.RevisionDelete, ChangedBy: userID, ChangedAt: changedAt.Add(2 * time.Hour),
+			Data: map[string]any{"phone": "217-555-0199", "city": "Springfield", "street": ""}},
+	}
+
+	t.Run("History", func(t *testing.T) {
+		mockRepo.On("GetContactRevisions", mock.Anything, userID, contactID).Return(revisions, nil)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/"+contactID.String()+"/history", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var response struct {
+			Data []httpserver.ContactRevisionResponse `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Len(t, response.Data, 3)
+		assert.Len(t, response.Data[0].Changes, 3)
+		assert.Equal(t, []httpserver.FieldChange{
+			{Field: "phone", Old: "217-555-0100", New: "217-555-0199"},
+			{Field: "street", Old: "742 Evergreen Terrace", New: ""},
+		}, response.Data[1].Changes)
+		assert.Equal(t, "delete", response.Data[2].Operation)
+		assert.Empty(t, response.Data[2].Changes)
+		assert.Equal(t, userID.String(), response.Data[2].ChangedBy)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("History Of Unknown Contact", func(t *testing.T) {
+		mockRepo.On("GetContactRevisions", mock.Anything, userID, contactID).Return(nil, repository.ErrNotFound)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/"+contactID.String()+"/history", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Revert", func(t *testing.T) {
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(&repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-0199",
+			City:      "Springfield",
+			Version:   4,
+		}, nil)
+		mockRepo.On("GetContactRevision", mock.Anything, userID, contactID, 1).Return(&revisions[0], nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return patch.Version == 4 && *patch.Phone == "217-555-0100" && *patch.Street == "742 Evergreen Terrace" &&
+				patch.Country == nil && patch.GivenName == nil
+		})).Run(func(args mock.Arguments) {
+			args.Get(3).(*repository.ContactPatch).Version = 5
+		}).Return(nil)
+
+		w := serve(httptest.NewRequest(http.MethodPost, "/contacts/"+contactID.String()+"/revert?revision=1", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"street":"742 Evergreen Terrace"`)
+		assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Revert To Unknown Revision", func(t *testing.T) {
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(&repository.ContactWithUserResponse{ContactID: contactID, Version: 4}, nil)
+		mockRepo.On("GetContactRevision", mock.Anything, userID, contactID, 9).Return(nil, repository.ErrNotFound)
+
+		w := serve(httptest.NewRequest(http.MethodPost, "/contacts/"+contactID.String()+"/revert?revision=9", nil))
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "Revision not found")
+
+		w = serve(httptest.NewRequest(http.MethodPost, "/contacts/"+contactID.String()+"/revert?revision=latest", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		mockRepo.AssertNotCalled(t, "PatchContactByID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
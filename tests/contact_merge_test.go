@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestContactDuplicates(t *testing.T) {
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Get("/contacts/duplicates", httpserver.HandlerGetDuplicateContacts(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	a, b, c := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	d, e := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	matches := []repository.DuplicateMatch{
+		{ContactIDs: [2]uuid.UUID{a, b}, SamePhone: true, NameSimilarity: 1, AddressSimilarity: 1, Score: 1},
+		{ContactIDs: [2]uuid.UUID{d, e}, NameSimilarity: 0.9, AddressSimilarity: 0.6, Score: 0.5},
+		{ContactIDs: [2]uuid.UUID{b, c}, SamePhone: true, Score: 1.0 / 3},
+	}
+
+	t.Run("Clusters", func(t *testing.T) {
+		mockRepo.On("FindDuplicateContacts", mock.Anything, userID, 1000).Return(matches, nil)
+		mockRepo.On("GetAllContacts", mock.Anything, userID, mock.MatchedBy(func(filter repository.ContactFilter) bool {
+			return len(filter.IDs) == 5
+		}), 5, 0).Return([]repository.Contact{
+			{ID: a, Phone: "217-555-0100"},
+			{ID: b, Phone: "217-555-0100"},
+			{ID: c, Phone: "217-555-0100"},
+			{ID: d},
+			// e was deleted since, so its cluster has one contact left
+		}, nil)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/duplicates", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var response struct {
+			Data httpserver.DuplicatesResponse `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		if assert.Len(t, response.Data.Clusters, 1) {
+			cluster := response.Data.Clusters[0]
+			assert.Equal(t, 1.0, cluster.Score)
+			assert.Len(t, cluster.Contacts, 3)
+			assert.Len(t, cluster.Matches, 2)
+		}
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		mockRepo.On("FindDuplicateContacts", mock.Anything, userID, 1000).Return(matches, nil)
+		mockRepo.On("GetAllContacts", mock.Anything, userID, mock.MatchedBy(func(filter repository.ContactFilter) bool {
+			return len(filter.IDs) == 3
+		}), 3, 0).Return([]repository.Contact{{ID: a}, {ID: b}, {ID: c}}, nil)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/duplicates?limit=1", nil))
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		w = serve(httptest.NewRequest(http.MethodGet, "/contacts/duplicates?limit=0", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("None", func(t *testing.T) {
+		mockRepo.On("FindDuplicateContacts", mock.Anything, userID, 1000).Return([]repository.DuplicateMatch{}, nil)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/duplicates", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"clusters":[]`)
+		mockRepo.AssertNotCalled(t, "GetAllContacts", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
+
+func TestMergeContacts(t *testing.T) {
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Post("/contacts/merge", httpserver.HandlerMergeContacts(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/contacts/merge", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	survivorID, otherID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	survivor := &repository.ContactWithUserResponse{
+		ContactID:      survivorID,
+		ContactProfile: repository.ContactProfile{GivenName: "Homer", FamilyName: "Simpson"},
+		Phone:          "217-555-0100",
+		PhoneE164:      "+12175550100",
+		Phones:         []repository.ContactPhone{{Label: "home", Number: "217-555-0100", E164: "+12175550100", Primary: true}},
+		Emails:         []repository.ContactEmail{{Label: "home", Address: "homer@example.com", Primary: true}},
+		Version:        3,
+	}
+	other := &repository.ContactWithUserResponse{
+		ContactID:      otherID,
+		ContactProfile: repository.ContactProfile{GivenName: "Homer J.", FamilyName: "Simpson", Company: "Springfield Nuclear"},
+		Phone:          "(217) 555-0100",
+		PhoneE164:      "+12175550100",
+		Phones: []repository.ContactPhone{
+			{Label: "home", Number: "(217) 555-0100", E164: "+12175550100", Primary: true},
+			{Label: "work", Number: "217-555-0142", E164: "+12175550142"},
+		},
+		Emails:  []repository.ContactEmail{{Label: "work", Address: "HOMER@example.com", Primary: true}},
+		Version: 7,
+	}
+	body := `{"survivor_id":"` + survivorID.String() + `","contact_ids":["` + otherID.String() + `"]}`
+
+	t.Run("Success", func(t *testing.T) {
+		mockRepo.On("GetContactByID", mock.Anything, userID, survivorID).Return(survivor, nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, otherID).Return(other, nil)
+		mockRepo.On("MergeContacts", mock.Anything, mock.MatchedBy(func(merge *repository.ContactMerge) bool {
+			return merge.SurvivorID == survivorID && len(merge.MergedIDs) == 1 && merge.MergedIDs[0] == otherID &&
+				merge.Fields["given_name"] == survivorID.String() && merge.Fields["company"] == otherID.String() &&
+				merge.Fields["phones"] == "all"
+		}), mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return patch.Version == 3 && *patch.GivenName == "Homer" && *patch.Company == "Springfield Nuclear" &&
+				len(patch.Phones) == 2 && patch.Phones[0].Primary && !patch.Phones[1].Primary &&
+				len(patch.Emails) == 1 && *patch.Phone == "217-555-0100"
+		}), []int{7}).Run(func(args mock.Arguments) {
+			args.Get(1).(*repository.ContactMerge).SurvivorRevision = 4
+			args.Get(2).(*repository.ContactPatch).Version = 4
+		}).Return(nil)
+
+		w := serve(body)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+		var response struct {
+			Data httpserver.ContactMergeResponse `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, 4, response.Data.Merge.SurvivorRevision)
+		assert.Equal(t, "Springfield Nuclear", response.Data.Contact.Company)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Chosen Fields", func(t *testing.T) {
+		mockRepo.On("GetContactByID", mock.Anything, userID, survivorID).Return(survivor, nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, otherID).Return(other, nil)
+		mockRepo.On("MergeContacts", mock.Anything, mock.Anything, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return *patch.GivenName == "Homer J." && len(patch.Phones) == 1 && patch.Phones[0].Number == "217-555-0100" &&
+				len(patch.Emails) == 1 && patch.Emails[0].Address == "HOMER@example.com"
+		}), []int{7}).Return(nil)
+
+		w := serve(`{"survivor_id":"` + survivorID.String() + `","contact_ids":["` + otherID.String() + `"],` +
+			`"fields":{"given_name":"` + otherID.String() + `","phones":"` + survivorID.String() + `","emails":"` + otherID.String() + `"}}`)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Invalid Payload", func(t *testing.T) {
+		w := serve(`{"survivor_id":"` + survivorID.String() + `","contact_ids":["` + survivorID.String() + `"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "must not include the survivor")
+
+		w = serve(`{"survivor_id":"` + survivorID.String() + `","contact_ids":["` + otherID.String() + `","` + otherID.String() + `"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "must not repeat an entry")
+
+		w = serve(`{"survivor_id":"` + survivorID.String() + `","contact_ids":[]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		mockRepo.On("GetContactByID", mock.Anything, userID, survivorID).Return(survivor, nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, otherID).Return(other, nil)
+		w = serve(`{"survivor_id":"` + survivorID.String() + `","contact_ids":["` + otherID.String() + `"],` +
+			`"fields":{"user_name":"` + otherID.String() + `","company":"all","notes":"someone"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "fields.company")
+		assert.Contains(t, w.Body.String(), "fields.notes")
+		assert.Contains(t, w.Body.String(), "fields.user_name")
+
+		mockRepo.AssertNotCalled(t, "MergeContacts", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Unknown Contact", func(t *testing.T) {
+		mockRepo.On("GetContactByID", mock.Anything, userID, survivorID).Return(survivor, nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, otherID).Return(nil, repository.ErrNotFound)
+
+		w := serve(body)
+
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		mockRepo.AssertNotCalled(t, "MergeContacts", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Changed Since Read", func(t *testing.T) {
+		mockRepo.On("GetContactByID", mock.Anything, userID, survivorID).Return(survivor, nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, otherID).Return(other, nil)
+		mockRepo.On("MergeContacts", mock.Anything, mock.Anything, mock.Anything, []int{7}).Return(repository.ErrPreconditionFailed)
+
+		w := serve(body)
+
+		assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestContactOwnership checks that the user ID taken from the access token is
+// the one every contact lookup is scoped by, so another user's contact is
+// indistinguishable from a missing one.
+func TestContactOwnership(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Route("/contacts", func(r chi.Router) {
+		r.Use(httpserver.AuthMiddleware(appState))
+		r.Get("/{id}", httpserver.HandlerGetContactByID(appState))
+		r.Patch("/{id}", httpserver.HandlerPatchContactByID(appState))
+		r.Delete("/{id}", httpserver.HandlerDeleteContactByID(appState))
+	})
+
+	ownerID := uuid.Must(uuid.NewV4())
+	intruderID := uuid.Must(uuid.NewV4())
+	contactID := uuid.Must(uuid.NewV4())
+	intruderToken, _ := utils.GenerateJWT(intruderID, utils.ScopeAuthentication, cfg.SecretKey, time.Hour)
+
+	mockRepo.On("GetContactByID", mock.Anything, ownerID, contactID).Return(&repository.ContactWithUserResponse{ContactID: contactID}, nil)
+	mockRepo.On("GetContactByID", mock.Anything, intruderID, contactID).Return(nil, repository.ErrNotFound)
+	mockRepo.On("DeleteContactByID", mock.Anything, intruderID, contactID).Return(repository.ErrNotFound)
+
+	tests := []struct {
+		name   string
+		method string
+		body   []byte
+	}{
+		{name: "Get", method: http.MethodGet},
+		{name: "Patch", method: http.MethodPatch, body: []byte(`{"phone": "217-555-0100"}`)},
+		{name: "Delete", method: http.MethodDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/contacts/"+contactID.String(), bytes.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+intruderToken)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Contains(t, w.Body.String(), "Contact Not found")
+		})
+	}
+
+	mockRepo.AssertNotCalled(t, "GetContactByID", mock.Anything, ownerID, contactID)
+	mockRepo.AssertNotCalled(t, "PatchContactByID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "DeleteContactByID", mock.Anything, ownerID, contactID)
+}
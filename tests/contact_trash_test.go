@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestContactTrash(t *testing.T) {
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Get("/contacts/trash", httpserver.HandlerGetContactTrash(appState))
+	r.Post("/contacts/{id}/restore", httpserver.HandlerRestoreContactByID(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("List Trash", func(t *testing.T) {
+		deletedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		filter := repository.ContactFilter{
+			City:    "Springfield",
+			Deleted: true,
+			Sort:    []repository.ContactSort{{Field: "deleted_at", Desc: true}},
+		}
+		mockRepo.On("GetAllContacts", mock.Anything, userID, filter, 10, 0).Return([]repository.Contact{
+			{ID: uuid.Must(uuid.NewV4()), Phone: "217-555-0100", City: "Springfield", DeletedAt: &deletedAt},
+		}, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, userID, filter).Return(1, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, userID, filter).Return([]repository.TagFacet{}, nil)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/trash?city=Springfield", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var response struct {
+			Data httpserver.ContactsResponse `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, 1, response.Data.TotalCount)
+		assert.Len(t, response.Data.Contacts, 1)
+		assert.Equal(t, deletedAt, *response.Data.Contacts[0].DeletedAt)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("RestoreContactByID", mock.Anything, userID, contactID).Return(nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(&repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-0100",
+			Version:   4,
+		}, nil)
+
+		w := serve(httptest.NewRequest(http.MethodPost, "/contacts/"+contactID.String()+"/restore", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "Contact restored successfully")
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Restore Contact Not In Trash", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("RestoreContactByID", mock.Anything, userID, contactID).Return(repository.ErrNotFound)
+
+		w := serve(httptest.NewRequest(http.MethodPost, "/contacts/"+contactID.String()+"/restore", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		mockRepo.AssertNotCalled(t, "GetContactByID", mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		cutoff := mock.MatchedBy(func(deletedBefore time.Time) bool {
+			return time.Since(deletedBefore).Round(time.Hour) == cfg.TrashRetention
+		})
+		mockRepo.On("PurgeDeletedContacts", mock.Anything, cutoff, 500).Return(int64(500), nil).Once()
+		mockRepo.On("PurgeDeletedContacts", mock.Anything, cutoff, 500).Return(int64(3), nil).Once()
+
+		purged, err := httpserver.PurgeDeletedContacts(context.Background(), appState)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(503), purged)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
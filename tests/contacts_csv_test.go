@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ImportResponse struct {
+	Message string                  `json:"message"`
+	Data    httpserver.ImportReport `json:"data"`
+}
+
+func TestImportContactsCSV(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Post("/contacts/import", httpserver.HandlerImportContacts(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	post := func(target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Header Aliases And Row Errors", func(t *testing.T) {
+		var copied []repository.Contact
+		mockRepo.On("CopyContacts", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			copied = append(copied, args.Get(1).([]repository.Contact)...)
+		}).Return(int64(2), nil)
+
+		body := "\ufeffTelephone,Street Address,Town,Province,Postal Code,Country,Notes\n" +
+			"555-0100,1 Main St,Springfield,IL,62701,US,first\n" +
+			",2 Main St,Springfield,IL,62701,US,no phone\n" +
+			"217-555-0102,3 Main St,Springfield,IL,62701-123456789012345,US,zip too long\n" +
+			"217-555-0103,\"4 Main St, Apt 2\",Shelbyville,IL,62565,US,quoted\n"
+		w := post("/contacts/import", "text/csv; charset=utf-8", body)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		var response ImportResponse
+		err := json.NewDecoder(w.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, response.Data.Imported)
+		assert.Equal(t, 2, response.Data.Failed)
+		assert.Equal(t, []httpserver.ImportRowError{
+			{Line: 3, Errors: []httpserver.FieldError{{Field: "phone", Message: "is required"}}},
+			{Line: 4, Errors: []httpserver.FieldError{{Field: "zip_code", Message: "must be at most 20 characters long"}}},
+		}, response.Data.Errors)
+
+		assert.Len(t, copied, 2)
+		assert.Equal(t, userID, copied[0].UserID)
+		assert.Equal(t, "555-0100", copied[0].Phone)
+		assert.Empty(t, copied[0].PhoneE164)
+		assert.Equal(t, "+12175550103", copied[1].PhoneE164)
+		assert.Equal(t, "62701", copied[0].ZipCode)
+		assert.Equal(t, "4 Main St, Apt 2", copied[1].Street)
+		assert.Equal(t, "Shelbyville", copied[1].City)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Explicit Mapping", func(t *testing.T) {
+		mockRepo.On("CopyContacts", mock.Anything, mock.MatchedBy(func(contacts []repository.Contact) bool {
+			return len(contacts) == 1 && contacts[0].Phone == "217-555-0199" && contacts[0].City == "Ogdenville"
+		})).Return(int64(1), nil)
+
+		w := post("/contacts/import?map.phone=Cell&map.city=Where", "text/csv", "Cell,Where\n217-555-0199,Ogdenville\n")
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Slow Upload Outlives The Server Read Timeout", func(t *testing.T) {
+		mockRepo.On("CopyContacts", mock.Anything, mock.Anything).Return(int64(1), nil)
+
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), "userid", userID.String())))
+		}))
+		srv.Config.ReadTimeout = 100 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		body, upload := io.Pipe()
+		go func() {
+			_, _ = io.WriteString(upload, "phone,city\n")
+			time.Sleep(300 * time.Millisecond)
+			_, _ = io.WriteString(upload, "217-555-0100,Springfield\n")
+			_ = upload.Close()
+		}()
+		resp, err := http.Post(srv.URL+"/contacts/import", "text/csv", body)
+
+		if assert.NoError(t, err) {
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Rejected Uploads", func(t *testing.T) {
+		w := post("/contacts/import", "application/json", `{"phone":"217-555-0100"}`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Result().StatusCode)
+
+		w = post("/contacts/import", "text/csv", "")
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		w = post("/contacts/import", "text/csv", "foo,bar\n1,2\n")
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		mockRepo.AssertNotCalled(t, "CopyContacts", mock.Anything, mock.Anything)
+	})
+}
+
+func TestExportContactsCSV(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Get("/contacts/export", httpserver.HandlerExportContacts(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Streams Rows", func(t *testing.T) {
+		created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		contacts := []repository.Contact{
+			{ID: uuid.Must(uuid.NewV4()), Phone: "217-555-0100", Street: "1 Main St, Apt 2", City: "Springfield", CreatedAt: created, UpdatedAt: created},
+			{ID: uuid.Must(uuid.NewV4()), Phone: "217-555-0101", City: "Shelbyville", CreatedAt: created, UpdatedAt: created},
+		}
+		filter := repository.ContactFilter{City: "Springfield"}
+		mockRepo.On("StreamContacts", mock.Anything, userID, filter).Return(contacts, nil)
+
+		w := get("/contacts/export?format=csv&city=Springfield")
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "contacts.csv")
+
+		records, err := csv.NewReader(w.Body).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, 3)
+		assert.Equal(t, []string{"id", "given_name", "family_name", "display_name", "nickname", "company", "job_title",
+			"phone", "street", "city", "state", "zip_code", "country", "notes", "created_at", "updated_at"}, records[0])
+		assert.Equal(t, contacts[0].ID.String(), records[1][0])
+		assert.Equal(t, "1 Main St, Apt 2", records[1][8])
+		assert.Equal(t, "2024-03-01T10:00:00Z", records[2][14])
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Search By Relevance", func(t *testing.T) {
+		created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		contacts := []repository.Contact{
+			{ID: uuid.Must(uuid.NewV4()), ContactProfile: repository.ContactProfile{FamilyName: "Smith"}, Phone: "217-555-0100", CreatedAt: created, UpdatedAt: created},
+		}
+		for target, filter := range map[string]repository.ContactFilter{
+			"/contacts/export?q=smith":            {Query: "smith"},
+			"/contacts/export?q=smith&sort=score": {Query: "smith", Sort: []repository.ContactSort{{Field: "score"}}},
+		} {
+			mockRepo.On("StreamContacts", mock.Anything, userID, filter).Return(contacts, nil).Once()
+
+			w := get(target)
+
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode, target)
+			records, err := csv.NewReader(w.Body).ReadAll()
+			assert.NoError(t, err)
+			assert.Len(t, records, 2)
+			assert.Equal(t, "Smith", records[1][2])
+		}
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Empty Export Has Header", func(t *testing.T) {
+		mockRepo.On("StreamContacts", mock.Anything, userID, repository.ContactFilter{}).Return(nil, nil)
+
+		w := get("/contacts/export")
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, "id,given_name,family_name,display_name,nickname,company,job_title,phone,street,city,state,zip_code,country,notes,created_at,updated_at\n", w.Body.String())
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Failure Before First Row", func(t *testing.T) {
+		mockRepo.On("StreamContacts", mock.Anything, userID, repository.ContactFilter{}).Return(nil, repository.ErrTimeout)
+
+		w := get("/contacts/export")
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Unsupported Format", func(t *testing.T) {
+		w := get("/contacts/export?format=xlsx")
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+}
@@ -8,10 +8,13 @@ import (
 	"github.com/stretchr/testify/mock"
 	"go_chi_pgx/cmd/httpserver"
 	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -26,15 +29,15 @@ func TestCreateContactHandler_Success(t *testing.T) {
 	}
 
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	requestPayload := httpserver.ContactRequestPayload{
-		Phone:   "1234567890",
+		Phone:   "2175557890",
 		Street:  "123 Test St",
 		City:    "Test City",
-		State:   "TS",
-		ZipCode: "12345",
-		Country: "Testland",
+		State:   "Illinois",
+		ZipCode: "62701",
+		Country: "United States",
 	}
 
 	userID := "b7358195-6291-4138-b115-2a046fe848f1"
@@ -64,7 +67,7 @@ func TestCreateContactHandler_InvalidPayload(t *testing.T) {
 	}
 
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	body := []byte(`{"invalid":`)
 
@@ -77,3 +80,289 @@ func TestCreateContactHandler_InvalidPayload(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
 	mockRepo.AssertNotCalled(t, "CreateContact")
 }
+
+func TestCreateContactHandler_Lists(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+	userID := "b7358195-6291-4138-b115-2a046fe848f1"
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/contacts", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+		httpserver.HandlerCreateContact(appState)(w, req)
+		return w
+	}
+
+	t.Run("Primary Entries Fill The Flat Fields", func(t *testing.T) {
+		mockRepo.On("CreateContact", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return contact.Phone == "217-555-0101" && contact.City == "Shelbyville" &&
+				len(contact.Phones) == 2 && contact.Phones[0].Label == "mobile" && !contact.Phones[0].Primary && contact.Phones[1].Primary &&
+				len(contact.Emails) == 1 && contact.Emails[0].Primary && contact.Emails[0].Label == "work" &&
+				len(contact.Addresses) == 1 && contact.Addresses[0].Primary && contact.Addresses[0].Label == "home"
+		})).Return(nil).Once()
+
+		w := post(`{
+			"phones": [{"number": "217-555-0100"}, {"label": "work", "number": "217-555-0101", "primary": true}],
+			"emails": [{"label": "work", "address": "homer@example.com"}],
+			"addresses": [{"city": "Shelbyville"}]
+		}`)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"phone":"217-555-0101"`)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Flat Fields Become The Primary Entries", func(t *testing.T) {
+		mockRepo.On("CreateContact", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return reflect.DeepEqual(contact.Phones, []repository.ContactPhone{{Label: "mobile", Number: "217-555-0100", E164: "+12175550100", Primary: true}}) &&
+				reflect.DeepEqual(contact.Addresses, []repository.ContactAddress{{Label: "home", City: "Springfield", Primary: true}}) &&
+				contact.Emails != nil && len(contact.Emails) == 0
+		})).Return(nil).Once()
+
+		w := post(`{"phone": "217-555-0100", "city": "Springfield"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Invalid Entries", func(t *testing.T) {
+		w := post(`{
+			"phones": [{"label": "pager", "number": "217-555-0100"}],
+			"emails": [{"address": "not an email"}],
+			"zip_code": "123456789012345678901"
+		}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		var response struct {
+			Errors []httpserver.FieldError `json:"errors"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.ElementsMatch(t, []httpserver.FieldError{
+			{Field: "zip_code", Message: "must be at most 20 characters long"},
+			{Field: "phones[0].label", Message: "must be one of mobile, work, home, other"},
+			{Field: "emails[0].address", Message: "must be a valid email address"},
+		}, response.Errors)
+		mockRepo.AssertNotCalled(t, "CreateContact", mock.Anything, mock.Anything)
+	})
+}
+
+func TestCreateContactHandler_Profile(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+	userID := "b7358195-6291-4138-b115-2a046fe848f1"
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/contacts", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+		httpserver.HandlerCreateContact(appState)(w, req)
+		return w
+	}
+
+	t.Run("Stored And Returned", func(t *testing.T) {
+		mockRepo.On("CreateContact", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return contact.ContactProfile == repository.ContactProfile{
+				GivenName:  "Homer",
+				FamilyName: "Simpson",
+				Company:    "Springfield Nuclear Power Plant",
+				JobTitle:   "Safety Inspector",
+				Notes:      "Sector 7G",
+			}
+		})).Return(nil).Once()
+
+		w := post(`{
+			"given_name": "Homer",
+			"family_name": "Simpson",
+			"company": "Springfield Nuclear Power Plant",
+			"job_title": "Safety Inspector",
+			"notes": "Sector 7G",
+			"phone": "217-555-0100"
+		}`)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"given_name":"Homer"`)
+		assert.Contains(t, w.Body.String(), `"job_title":"Safety Inspector"`)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Too Long", func(t *testing.T) {
+		w := post(`{"phone": "217-555-0100", "given_name": "` + strings.Repeat("a", 101) + `"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"field":"given_name"`)
+		mockRepo.AssertNotCalled(t, "CreateContact", mock.Anything, mock.Anything)
+	})
+}
+
+func TestCreateContactHandler_PhoneNormalization(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+	userID := "b7358195-6291-4138-b115-2a046fe848f1"
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/contacts", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+		httpserver.HandlerCreateContact(appState)(w, req)
+		return w
+	}
+
+	t.Run("Stored Next To The Raw Input", func(t *testing.T) {
+		mockRepo.On("CreateContact", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return contact.Phone == "(217) 555-0100" && contact.PhoneE164 == "+12175550100" &&
+				len(contact.Phones) == 2 && contact.Phones[1].E164 == "+442079460958"
+		})).Return(nil).Once()
+
+		w := post(`{"phones": [
+			{"number": "(217) 555-0100", "e164": "+15555550100"},
+			{"label": "work", "number": "+44 20 7946 0958"}
+		]}`)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"phone_e164":"+12175550100"`)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Parsed For The Contact Country", func(t *testing.T) {
+		mockRepo.On("CreateContact", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return contact.PhoneE164 == "+4930901820"
+		})).Return(nil).Once()
+
+		w := post(`{"phone": "030 901820", "city": "Berlin", "country": "DE"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Invalid Numbers", func(t *testing.T) {
+		for body, want := range map[string]httpserver.FieldError{
+			`{"phone": "123"}`:                                      {Field: "phone", Message: "must be a valid phone number for US"},
+			`{"phone": "030 901820"}`:                               {Field: "phone", Message: "must be a valid phone number for US"},
+			`{"phone": "(217) 555", "country": "gb"}`:               {Field: "phone", Message: "must be a valid phone number for GB"},
+			`{"phones": [{"number": "555-0100"}, {"number": "📞"}]}`: {Field: "phones[1].number", Message: "must be a valid phone number for US"},
+		} {
+			w := post(body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, body)
+			var response struct {
+				Errors []httpserver.FieldError `json:"errors"`
+			}
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Contains(t, response.Errors, want, body)
+		}
+		mockRepo.AssertNotCalled(t, "CreateContact", mock.Anything, mock.Anything)
+	})
+}
+
+func TestCreateContactHandler_Addresses(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+	userID := "b7358195-6291-4138-b115-2a046fe848f1"
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/contacts", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+		httpserver.HandlerCreateContact(appState)(w, req)
+		return w
+	}
+
+	t.Run("Names And Codes Are Normalized", func(t *testing.T) {
+		mockRepo.On("CreateContact", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return contact.Country == "CA" && contact.State == "ON" && contact.ZipCode == "K1A 0B1" &&
+				contact.PhoneE164 == "+16135550100" &&
+				len(contact.Addresses) == 2 && contact.Addresses[0].Country == "CA" &&
+				contact.Addresses[1].Country == "DE" && contact.Addresses[1].State == "BY"
+		})).Return(nil).Once()
+
+		w := post(`{
+			"phone": "613 555 0100",
+			"addresses": [
+				{"city": "Ottawa", "state": "Ontario", "zip_code": "k1a 0b1", "country": "Canada"},
+				{"label": "work", "city": "München", "state": "Bayern", "zip_code": "80331", "country": "DEU"}
+			]
+		}`)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"country":"CA"`)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Invalid Combinations", func(t *testing.T) {
+		for body, want := range map[string][]httpserver.FieldError{
+			`{"phone": "217-555-0100", "state": "ON", "zip_code": "62701", "country": "USA"}`: {
+				{Field: "state", Message: "must be a state or other subdivision of United States"},
+			},
+			`{"phone": "217-555-0100", "addresses": [
+				{"city": "Toronto", "state": "ON", "zip_code": "62701", "country": "CA"},
+				{"label": "other", "city": "Fredonia", "state": "NY", "country": "Freedonia"}
+			]}`: {
+				{Field: "addresses[0].zip_code", Message: "must be a postal code of Canada, such as K1A 0B1"},
+				{Field: "addresses[1].country", Message: "must be a country name or ISO 3166-1 code"},
+			},
+		} {
+			w := post(body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, body)
+			var response struct {
+				Errors []httpserver.FieldError `json:"errors"`
+			}
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.ElementsMatch(t, want, response.Errors, body)
+		}
+		mockRepo.AssertNotCalled(t, "CreateContact", mock.Anything, mock.Anything)
+	})
+}
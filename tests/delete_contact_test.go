@@ -1,7 +1,7 @@
 package tests
 
 import (
-	"database/sql"
+	"context"
 	"github.com/go-chi/chi/v5"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"go_chi_pgx/cmd/httpserver"
 	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
 	"net/http"
 	"net/http/httptest"
@@ -24,13 +25,16 @@ func TestDeleteContactHandler(t *testing.T) {
 		t.Fatalf("Config parsing failed: %v", err)
 	}
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	r := chi.NewRouter()
 	r.Delete("/contacts/{id}", httpserver.HandlerDeleteContactByID(appState))
 
+	userID := uuid.Must(uuid.NewV4())
+
 	t.Run("Invalid Contact ID", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodDelete, "/contacts/invalid-id", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -46,9 +50,10 @@ func TestDeleteContactHandler(t *testing.T) {
 
 	t.Run("Contact Not Found", func(t *testing.T) {
 		contactID, _ := uuid.NewV4()
-		mockRepo.On("DeleteContactByID", mock.Anything, contactID).Return(sql.ErrNoRows)
+		mockRepo.On("DeleteContactByID", mock.Anything, userID, contactID).Return(repository.ErrNotFound)
 
 		req := httptest.NewRequest(http.MethodDelete, "/contacts/"+contactID.String(), nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -64,9 +69,10 @@ func TestDeleteContactHandler(t *testing.T) {
 
 	t.Run("Deletion Failed", func(t *testing.T) {
 		contactID, _ := uuid.NewV4()
-		mockRepo.On("DeleteContactByID", mock.Anything, contactID).Return(errors.New("db error"))
+		mockRepo.On("DeleteContactByID", mock.Anything, userID, contactID).Return(errors.New("db error"))
 
 		req := httptest.NewRequest(http.MethodDelete, "/contacts/"+contactID.String(), nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -82,16 +88,17 @@ func TestDeleteContactHandler(t *testing.T) {
 
 	t.Run("Successful Deletion", func(t *testing.T) {
 		contactID, _ := uuid.NewV4()
-		mockRepo.On("DeleteContactByID", mock.Anything, contactID).Return(nil)
+		mockRepo.On("DeleteContactByID", mock.Anything, userID, contactID).Return(nil)
 
 		req := httptest.NewRequest(http.MethodDelete, "/contacts/"+contactID.String(), nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
 		assert.Empty(t, w.Body.String())
-		mockRepo.AssertCalled(t, "DeleteContactByID", mock.Anything, contactID)
+		mockRepo.AssertCalled(t, "DeleteContactByID", mock.Anything, userID, contactID)
 
 		mockRepo.AssertExpectations(t)
 		t.Cleanup(func() {
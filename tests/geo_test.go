@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go_chi_pgx/geo"
+	"testing"
+)
+
+func TestGeoLookupCountry(t *testing.T) {
+	for _, s := range []string{"US", "us", "USA", "840", "United States", "united states of america", " UNITED  STATES "} {
+		country, ok := geo.LookupCountry(s)
+		assert.True(t, ok, s)
+		assert.Equal(t, "US", country.Code, s)
+	}
+
+	for s, want := range map[string]string{
+		"Cote d'Ivoire":   "CI",
+		"côte d’ivoire":   "CI",
+		"UK":              "GB",
+		"Great Britain":   "GB",
+		"the Netherlands": "NL",
+		"South Korea":     "KR",
+		"Czech Republic":  "CZ",
+		"DEU":             "DE",
+	} {
+		country, ok := geo.LookupCountry(s)
+		assert.True(t, ok, s)
+		assert.Equal(t, want, country.Code, s)
+	}
+
+	for _, s := range []string{"", "Freedonia", "XX", "U.S.S.R."} {
+		_, ok := geo.LookupCountry(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestGeoLookupSubdivision(t *testing.T) {
+	subdivision, ok := geo.LookupSubdivision("US", "california")
+	assert.True(t, ok)
+	assert.Equal(t, geo.Subdivision{Code: "US-CA", Name: "California", Type: "State"}, subdivision)
+	assert.Equal(t, "CA", subdivision.Short())
+
+	for _, s := range []string{"CA", "us-ca", "California"} {
+		subdivision, ok := geo.LookupSubdivision("us", s)
+		assert.True(t, ok, s)
+		assert.Equal(t, "US-CA", subdivision.Code, s)
+	}
+
+	subdivision, ok = geo.LookupSubdivision("DE", "Baden-Wurttemberg")
+	assert.True(t, ok)
+	assert.Equal(t, "BW", subdivision.Short())
+
+	for _, tc := range []struct {
+		country, s, want string
+	}{
+		{"DE", "Bavaria", "BY"},
+		{"DE", "north rhine-westphalia", "NW"},
+		{"AT", "Vienna", "9"},
+		{"RU", "Moscow", "MOW"},
+		{"RU", "Москва", "MOW"},
+		{"RU", "St. Petersburg", "SPE"},
+		{"CN", "Beijing", "BJ"},
+		{"IT", "Lombardy", "25"},
+		{"ES", "Barcelona", "B"},
+		{"CH", "Geneva", "GE"},
+	} {
+		subdivision, ok := geo.LookupSubdivision(tc.country, tc.s)
+		assert.True(t, ok, tc.s)
+		assert.Equal(t, tc.want, subdivision.Short(), tc.s)
+	}
+	_, ok = geo.LookupSubdivision("AT", "Bavaria")
+	assert.False(t, ok)
+
+	_, ok = geo.LookupSubdivision("US", "ON")
+	assert.False(t, ok)
+	_, ok = geo.LookupSubdivision("CA", "Ontario")
+	assert.True(t, ok)
+
+	assert.True(t, geo.HasSubdivisions("US"))
+	assert.False(t, geo.HasSubdivisions("XX"))
+}
+
+func TestGeoNormalizePostalCode(t *testing.T) {
+	valid := []struct {
+		country, code, want string
+	}{
+		{"US", "62701", "62701"},
+		{"US", "62701-1234", "62701-1234"},
+		{"CA", "k1a  0b1", "K1A 0B1"},
+		{"GB", "sw1a 1aa", "SW1A 1AA"},
+		{"NL", "1012ab", "1012AB"},
+		{"DE", "10115", "10115"},
+		{"XX", "anything", "ANYTHING"},
+	}
+	for _, tc := range valid {
+		got, ok := geo.NormalizePostalCode(tc.country, tc.code)
+		assert.True(t, ok, tc.code)
+		assert.Equal(t, tc.want, got, tc.code)
+	}
+
+	for country, code := range map[string]string{"US": "K1A 0B1", "CA": "62701", "DE": "1011", "PL": "00001"} {
+		_, ok := geo.NormalizePostalCode(country, code)
+		assert.False(t, ok, country+" "+code)
+	}
+
+	assert.Equal(t, "K1A 0B1", geo.PostalCodeExample("ca"))
+	assert.Equal(t, "", geo.PostalCodeExample("XX"))
+}
@@ -15,6 +15,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 type ContactsResponse struct {
@@ -30,7 +31,7 @@ func TestGetAllContactsHandler(t *testing.T) {
 		t.Fatalf("Config parsing failed: %v", err)
 	}
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	r := chi.NewRouter()
 	r.Get("/contacts", httpserver.HandlerGetAllContacts(appState))
@@ -43,7 +44,7 @@ func TestGetAllContactsHandler(t *testing.T) {
 		contacts := []repository.Contact{
 			{
 				ID:      contactID,
-				Phone:   "123-456-7890",
+				Phone:   "217-555-7890",
 				Street:  "123 Main St",
 				City:    "Sample City",
 				State:   "Sample State",
@@ -53,8 +54,9 @@ func TestGetAllContactsHandler(t *testing.T) {
 		}
 		totalCount := 1
 
-		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), 10, 0).Return(contacts, nil)
-		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID")).Return(totalCount, nil)
+		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}, 10, 0).Return(contacts, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return(totalCount, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return([]repository.TagFacet{}, nil)
 
 		req := httptest.NewRequest(http.MethodGet, "/contacts?limit=10&offset=0", nil)
 		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
@@ -71,7 +73,7 @@ func TestGetAllContactsHandler(t *testing.T) {
 		assert.Len(t, response.Data.Contacts, len(contacts))
 
 		assert.Equal(t, contactID.String(), response.Data.Contacts[0].ID)
-		assert.Equal(t, "123-456-7890", response.Data.Contacts[0].Phone)
+		assert.Equal(t, "217-555-7890", response.Data.Contacts[0].Phone)
 		assert.Equal(t, "123 Main St", response.Data.Contacts[0].Street)
 		assert.Equal(t, "Sample City", response.Data.Contacts[0].City)
 		assert.Equal(t, "Sample State", response.Data.Contacts[0].State)
@@ -105,8 +107,9 @@ func TestGetAllContactsHandler(t *testing.T) {
 	})
 
 	t.Run("No Contacts Found", func(t *testing.T) {
-		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return([]repository.Contact{}, nil)
-		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID")).Return(0, nil)
+		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}, mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return([]repository.Contact{}, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return(0, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), repository.ContactFilter{}).Return([]repository.TagFacet{}, nil)
 
 		req := httptest.NewRequest(http.MethodGet, "/contacts", nil)
 		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
@@ -121,4 +124,141 @@ func TestGetAllContactsHandler(t *testing.T) {
 			mockRepo.Calls = nil
 		})
 	})
+
+	t.Run("Search", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		contacts := []repository.Contact{
+			{ID: contactID, Street: "742 Evergreen Terrace", City: "Springfield", Score: 0.75},
+		}
+		filter := repository.ContactFilter{Query: "sprngfield"}
+
+		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter, 1, 0).Return(contacts, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return(2, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return([]repository.TagFacet{}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/contacts?q=+sprngfield+&limit=1", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		var response ContactsResponse
+		err = json.NewDecoder(w.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, 0.75, response.Data.Contacts[0].Score)
+		assert.Contains(t, response.Data.Next, "q=+sprngfield+")
+		assert.Contains(t, response.Data.Next, "offset=1")
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Tag Filter And Facets", func(t *testing.T) {
+		filter := repository.ContactFilter{Tags: []string{"customers", "Project X"}}
+		facets := []repository.TagFacet{
+			{ID: uuid.Must(uuid.NewV4()), Name: "customers", Count: 2},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Project X", Count: 2},
+			{ID: uuid.Must(uuid.NewV4()), Name: "team", Count: 0},
+		}
+
+		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter, 10, 0).Return([]repository.Contact{}, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return(2, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return(facets, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/contacts?tag=customers&tag=+Project+X+&tag=", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		var response ContactsResponse
+		err = json.NewDecoder(w.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, facets, response.Data.Facets.Tags)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Filters And Sort", func(t *testing.T) {
+		filter := repository.ContactFilter{
+			City:          "Springfield",
+			Country:       "US",
+			ZipCodePrefix: "627",
+			CreatedAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			CreatedBefore: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+			Sort: []repository.ContactSort{
+				{Field: "created_at", Desc: true},
+				{Field: "city"},
+			},
+		}
+
+		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter, 10, 0).Return([]repository.Contact{}, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return(25, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return([]repository.TagFacet{}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/contacts?city=Springfield&country=US&zip_code=627&created_after=2024-01-01&created_before=2024-06-01T12:00:00Z&sort=-created_at,city", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		var response ContactsResponse
+		err = json.NewDecoder(w.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, 25, response.Data.TotalCount)
+		assert.Contains(t, response.Data.Next, "city=Springfield")
+		assert.Contains(t, response.Data.Next, "sort=-created_at%2Ccity")
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Filter By Country Name", func(t *testing.T) {
+		filter := repository.ContactFilter{State: "IL", Country: "US"}
+		mockRepo.On("GetAllContacts", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter, 10, 0).Return([]repository.Contact{}, nil)
+		mockRepo.On("GetContactsCount", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return(0, nil)
+		mockRepo.On("GetTagFacets", mock.Anything, mock.AnythingOfType("uuid.UUID"), filter).Return([]repository.TagFacet{}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/contacts?country=United+States&state=Illinois", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Invalid Filter", func(t *testing.T) {
+		for _, query := range []string{"sort=password", "sort=-id", "created_after=yesterday"} {
+			req := httptest.NewRequest(http.MethodGet, "/contacts?"+query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, query)
+		}
+		mockRepo.AssertNotCalled(t, "GetAllContacts")
+	})
 }
@@ -1,10 +1,10 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/gofrs/uuid"
-	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go_chi_pgx/cmd/httpserver"
@@ -25,16 +25,18 @@ func TestGetContactByIDHandler(t *testing.T) {
 		t.Fatalf("Config parsing failed: %v", err)
 	}
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	r := chi.NewRouter()
 	r.Get("/contacts/{id}", httpserver.HandlerGetContactByID(appState))
 
+	userID := uuid.Must(uuid.NewV4())
+
 	t.Run("Successful Fetch", func(t *testing.T) {
 		contactID := uuid.Must(uuid.NewV4())
 		mockContact := &repository.ContactWithUserResponse{
 			ContactID: contactID,
-			Phone:     "123-456-7890",
+			Phone:     "217-555-7890",
 			Street:    "123 Main St",
 			City:      "Sample City",
 			State:     "Sample State",
@@ -44,9 +46,10 @@ func TestGetContactByIDHandler(t *testing.T) {
 			UserEmail: "mohim@example.com",
 		}
 
-		mockRepo.On("GetContactByID", mock.Anything, contactID).Return(mockContact, nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
 
 		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/contacts/%s", contactID), nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -61,6 +64,7 @@ func TestGetContactByIDHandler(t *testing.T) {
 
 	t.Run("Invalid UUID", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/contacts/invalid-uuid", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -77,9 +81,10 @@ func TestGetContactByIDHandler(t *testing.T) {
 	t.Run("Contact Not Found", func(t *testing.T) {
 		contactID := uuid.Must(uuid.NewV4())
 
-		mockRepo.On("GetContactByID", mock.Anything, contactID).Return(repository.Contact{}, errors.New("no contact found"))
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(repository.Contact{}, repository.ErrNotFound)
 
 		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/contacts/%s", contactID), nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -92,4 +97,63 @@ func TestGetContactByIDHandler(t *testing.T) {
 			mockRepo.Calls = nil
 		})
 	})
+
+	t.Run("Database Timeout", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(nil, repository.ErrTimeout)
+
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/contacts/%s", contactID), nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("ETag And Not Modified", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(&repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-7890",
+			Version:   3,
+		}, nil)
+
+		for _, tt := range []struct {
+			ifNoneMatch string
+			status      int
+		}{
+			{"", http.StatusOK},
+			{`"2"`, http.StatusOK},
+			{`"2", W/"3"`, http.StatusNotModified},
+			{"*", http.StatusNotModified},
+		} {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/contacts/%s", contactID), nil)
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Result().StatusCode, tt.ifNoneMatch)
+			assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+			if tt.status == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			}
+		}
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
 }
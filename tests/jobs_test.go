@@ -0,0 +1,322 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/jobs"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJobPool(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	mockRepo := new(mocks.MockRepository)
+
+	var handlerErr error
+	handlers := jobs.Handlers{
+		"echo": func(ctx context.Context, payload json.RawMessage) error {
+			return handlerErr
+		},
+	}
+	pool := jobs.NewPool(mockRepo, logger, handlers, 1, time.Millisecond)
+	ctx := context.Background()
+
+	t.Run("No Jobs", func(t *testing.T) {
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{}, nil).Once()
+
+		processed, err := pool.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		assert.False(t, processed)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Successful Job", func(t *testing.T) {
+		handlerErr = nil
+		job := repository.Job{ID: 1, Kind: "echo", Attempts: 1, MaxAttempts: 5}
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{job}, nil).Once()
+		mockRepo.On("CompleteJob", mock.Anything, job.ID).Return(nil)
+
+		processed, err := pool.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		assert.True(t, processed)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Failed Job Is Retried", func(t *testing.T) {
+		handlerErr = errors.New("smtp unavailable")
+		job := repository.Job{ID: 2, Kind: "echo", Attempts: 2, MaxAttempts: 5}
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{job}, nil).Once()
+		mockRepo.On("FailJob", mock.Anything, job.ID, "smtp unavailable", mock.MatchedBy(func(retryAt *time.Time) bool {
+			return retryAt != nil && retryAt.After(time.Now().Add(3*time.Second))
+		})).Return(nil)
+
+		_, err := pool.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Exhausted Job Is Dead-Lettered", func(t *testing.T) {
+		handlerErr = errors.New("smtp unavailable")
+		job := repository.Job{ID: 3, Kind: "echo", Attempts: 5, MaxAttempts: 5}
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{job}, nil).Once()
+		mockRepo.On("FailJob", mock.Anything, job.ID, "smtp unavailable", (*time.Time)(nil)).Return(nil)
+
+		_, err := pool.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Lost Job Past Its Attempts Is Dead-Lettered", func(t *testing.T) {
+		ran := false
+		lostPool := jobs.NewPool(mockRepo, logger, jobs.Handlers{
+			"echo": func(ctx context.Context, payload json.RawMessage) error {
+				ran = true
+				return nil
+			},
+		}, 1, time.Millisecond)
+		job := repository.Job{ID: 7, Kind: "echo", Attempts: 6, MaxAttempts: 5}
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{job}, nil).Once()
+		mockRepo.On("FailJob", mock.Anything, job.ID, repository.JobWorkerLost, (*time.Time)(nil)).Return(nil)
+
+		_, err := lostPool.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		assert.False(t, ran)
+		mockRepo.AssertNotCalled(t, "CompleteJob", mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Permanent Error Is Dead-Lettered", func(t *testing.T) {
+		handlerErr = jobs.Permanent(errors.New("bad payload"))
+		job := repository.Job{ID: 4, Kind: "echo", Attempts: 1, MaxAttempts: 5}
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{job}, nil).Once()
+		mockRepo.On("FailJob", mock.Anything, job.ID, "bad payload", (*time.Time)(nil)).Return(nil)
+
+		_, err := pool.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Unknown Kind Is Dead-Lettered", func(t *testing.T) {
+		job := repository.Job{ID: 5, Kind: "unknown", Attempts: 1, MaxAttempts: 5}
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{job}, nil).Once()
+		mockRepo.On("FailJob", mock.Anything, job.ID, mock.AnythingOfType("string"), (*time.Time)(nil)).Return(nil)
+
+		_, err := pool.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Start And Stop", func(t *testing.T) {
+		handlerErr = nil
+		job := repository.Job{ID: 6, Kind: "echo", Attempts: 1, MaxAttempts: 5}
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{job}, nil).Once()
+		mockRepo.On("ClaimJobs", mock.Anything, 1, mock.Anything).Return([]repository.Job{}, nil)
+		completed := make(chan struct{})
+		mockRepo.On("CompleteJob", mock.Anything, job.ID).Run(func(mock.Arguments) {
+			close(completed)
+		}).Return(nil)
+
+		pool.Start(ctx)
+		select {
+		case <-completed:
+		case <-time.After(time.Second):
+			t.Error("job was not completed")
+		}
+		pool.Stop()
+	})
+}
+
+func TestJobBackoff(t *testing.T) {
+	assert.GreaterOrEqual(t, jobs.Backoff(1), 2*time.Second)
+	assert.Less(t, jobs.Backoff(1), 3*time.Second)
+	assert.GreaterOrEqual(t, jobs.Backoff(4), 16*time.Second)
+	assert.LessOrEqual(t, jobs.Backoff(100), time.Hour+15*time.Minute)
+}
+
+func TestUserEmailJobs(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	mockMailer := new(mocks.MockMailer)
+	appState := state.NewState(cfg, mockRepo, logger, mockMailer)
+	handlers := httpserver.JobHandlers(appState)
+
+	payload, _ := json.Marshal(httpserver.UserEmailPayload{
+		UserID: uuid.Must(uuid.NewV4()),
+		Name:   "John Doe",
+		Email:  "john.doe@example.com",
+	})
+
+	t.Run("Activation Email", func(t *testing.T) {
+		mockMailer.On("Send", "john.doe@example.com", "user_activation.tmpl", mock.MatchedBy(func(data map[string]any) bool {
+			_, err := utils.VerifyJWT(data["activationToken"].(string), utils.ScopeActivation, cfg.TokenKeys())
+			return err == nil
+		})).Return(nil)
+
+		err := handlers[httpserver.KindActivationEmail](context.Background(), payload)
+
+		assert.NoError(t, err)
+		mockMailer.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockMailer.ExpectedCalls = nil
+			mockMailer.Calls = nil
+		})
+	})
+
+	t.Run("Password Reset Email", func(t *testing.T) {
+		var stored []byte
+		mockRepo.On("CreatePasswordResetToken", mock.Anything, mock.AnythingOfType("*repository.PasswordResetToken")).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*repository.PasswordResetToken).Hash
+		}).Return(nil)
+		mockMailer.On("Send", "john.doe@example.com", "password_reset.tmpl", mock.MatchedBy(func(data map[string]any) bool {
+			return assert.ObjectsAreEqual(stored, utils.HashOpaqueToken(data["resetToken"].(string)))
+		})).Return(nil)
+
+		err := handlers[httpserver.KindPasswordResetEmail](context.Background(), payload)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+	})
+}
+
+func TestBackfillPhoneE164Job(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+	backfill := httpserver.JobHandlers(appState)[httpserver.KindBackfillPhoneE164]
+
+	homer := uuid.Must(uuid.NewV4())
+	hans := uuid.Must(uuid.NewV4())
+
+	t.Run("Batch Queues The Next One", func(t *testing.T) {
+		mockRepo.On("GetPhonesWithoutE164", mock.Anything, uuid.Nil, 500).Return([]repository.PhoneBackfill{
+			{ContactID: homer, Position: 0, Number: "(217) 555-0100", Country: "United States"},
+			{ContactID: homer, Position: 1, Number: "555"},
+			{ContactID: hans, Position: 0, Number: "030 901820", Country: "DE"},
+		}, nil)
+		mockRepo.On("SetPhonesE164", mock.Anything, []repository.PhoneBackfill{
+			{ContactID: homer, Position: 0, Number: "(217) 555-0100", Country: "United States", E164: "+12175550100"},
+			{ContactID: homer, Position: 1, Number: "555"},
+			{ContactID: hans, Position: 0, Number: "030 901820", Country: "DE", E164: "+4930901820"},
+		}).Return(nil)
+		mockRepo.On("EnqueueJob", mock.Anything, mock.MatchedBy(func(job *repository.Job) bool {
+			var payload httpserver.BackfillPayload
+			return job.Kind == httpserver.KindBackfillPhoneE164 && json.Unmarshal(job.Payload, &payload) == nil && payload.After == hans
+		})).Return(nil)
+
+		err := backfill(context.Background(), json.RawMessage(`{}`))
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Last Batch", func(t *testing.T) {
+		mockRepo.On("GetPhonesWithoutE164", mock.Anything, hans, 500).Return([]repository.PhoneBackfill(nil), nil)
+
+		payload, _ := json.Marshal(httpserver.BackfillPayload{After: hans})
+		err := backfill(context.Background(), payload)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "SetPhonesE164", mock.Anything, mock.Anything)
+		mockRepo.AssertNotCalled(t, "EnqueueJob", mock.Anything, mock.Anything)
+	})
+}
+
+func TestNormalizeAddressesJob(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+	normalize := httpserver.JobHandlers(appState)[httpserver.KindNormalizeAddresses]
+
+	homer := uuid.Must(uuid.NewV4())
+	ned := uuid.Must(uuid.NewV4())
+	legacy := repository.ContactAddress{Label: "home", City: "Springfield", State: "Illinois", ZipCode: "62701", Country: "United States", Primary: true}
+	canonical := repository.ContactAddress{Label: "work", City: "Springfield", State: "IL", ZipCode: "62701", Country: "US"}
+	unknown := repository.ContactAddress{Label: "home", City: "Fredonia", Country: "Freedonia", Primary: true}
+
+	mockRepo.On("GetAddressesToNormalize", mock.Anything, uuid.Nil, 500).Return([]repository.AddressBackfill{
+		{ContactID: homer, Position: 0, Address: legacy},
+		{ContactID: homer, Position: 1, Address: canonical},
+		{ContactID: ned, Position: 0, Address: unknown},
+	}, nil)
+	normalized := legacy
+	normalized.State, normalized.Country = "IL", "US"
+	mockRepo.On("SetNormalizedAddresses", mock.Anything, []repository.AddressBackfill{
+		{ContactID: homer, Position: 0, Address: legacy, Normalized: normalized},
+	}).Return(nil)
+	mockRepo.On("EnqueueJob", mock.Anything, mock.MatchedBy(func(job *repository.Job) bool {
+		var payload httpserver.BackfillPayload
+		return job.Kind == httpserver.KindNormalizeAddresses && json.Unmarshal(job.Payload, &payload) == nil && payload.After == ned
+	})).Return(nil)
+
+	err = normalize(context.Background(), json.RawMessage(`{}`))
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
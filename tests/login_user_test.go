@@ -29,7 +29,7 @@ func TestHandleLogin(t *testing.T) {
 		t.Fatalf("Config parsing failed: %v", err)
 	}
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	r := chi.NewRouter()
 	r.Post("/login", httpserver.HandleLogin(appState))
@@ -83,6 +83,9 @@ func TestHandleLogin(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.ExpectedCalls = nil
 			mockRepo.On("GetUserByEmail", mock.Anything, validRequest.Email).Return(tt.mockUser, tt.mockError)
+			if tt.expectValidToken {
+				mockRepo.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+			}
 
 			payload, _ := json.Marshal(validRequest)
 			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
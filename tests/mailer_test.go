@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"go_chi_pgx/mailer"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMailerTemplates(t *testing.T) {
+
+	t.Run("Activation Email", func(t *testing.T) {
+		msg, err := mailer.Render("john.doe@example.com", "user_activation.tmpl", map[string]any{
+			"name":            "<John>",
+			"userID":          "b7358195-6291-4138-b115-2a046fe848f1",
+			"activationToken": "activation-token",
+			"expiresIn":       "2h0m0s",
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Activate your Contacts account", msg.Subject)
+		assert.Contains(t, msg.PlainBody, "activation-token")
+		assert.Contains(t, msg.PlainBody, "Hi <John>")
+		assert.Contains(t, msg.HTMLBody, "Hi &lt;John&gt;")
+	})
+
+	t.Run("Password Reset Email", func(t *testing.T) {
+		msg, err := mailer.Render("john.doe@example.com", "password_reset.tmpl", map[string]any{
+			"name":       "John",
+			"resetToken": "reset-token",
+			"expiresIn":  "15m0s",
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Reset your Contacts password", msg.Subject)
+		assert.Contains(t, msg.PlainBody, "reset-token")
+		assert.Contains(t, msg.HTMLBody, "reset-token")
+	})
+
+	t.Run("Unknown Template", func(t *testing.T) {
+		_, err := mailer.Render("john.doe@example.com", "missing.tmpl", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestOutboxMailer(t *testing.T) {
+	data := map[string]any{"name": "John", "resetToken": "reset-token", "expiresIn": "15m0s"}
+
+	t.Run("Writer", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		m := mailer.NewOutbox("", out, "Contacts <no-reply@contacts.local>")
+
+		err := m.Send("john.doe@example.com", "password_reset.tmpl", data)
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "To: john.doe@example.com")
+		assert.Contains(t, out.String(), "multipart/alternative")
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		dir := t.TempDir()
+		m := mailer.NewOutbox(dir, nil, "Contacts <no-reply@contacts.local>")
+
+		err := m.Send("john.doe@example.com", "password_reset.tmpl", data)
+		assert.NoError(t, err)
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*-password_reset.eml"))
+		assert.Len(t, files, 1)
+		body, _ := os.ReadFile(files[0])
+		assert.Contains(t, string(body), "reset-token")
+	})
+}
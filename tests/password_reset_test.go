@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHandleRequestPasswordReset(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Post("/users/password-reset", httpserver.HandleRequestPasswordReset(appState))
+
+	request := httpserver.PasswordResetRequestPayload{Email: "john.doe@example.com"}
+
+	t.Run("Active User", func(t *testing.T) {
+		user := &repository.User{ID: uuid.Must(uuid.NewV4()), Email: request.Email, IsActive: true}
+		mockRepo.On("GetUserByEmail", mock.Anything, request.Email).Return(user, nil)
+		mockRepo.On("EnqueueJob", mock.Anything, mock.MatchedBy(func(job *repository.Job) bool {
+			return job.Kind == httpserver.KindPasswordResetEmail
+		})).Return(nil)
+
+		payload, _ := json.Marshal(request)
+		req := httptest.NewRequest(http.MethodPost, "/users/password-reset", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Unknown Email", func(t *testing.T) {
+		mockRepo.On("GetUserByEmail", mock.Anything, request.Email).Return((*repository.User)(nil), repository.ErrNotFound)
+
+		payload, _ := json.Marshal(request)
+		req := httptest.NewRequest(http.MethodPost, "/users/password-reset", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		mockRepo.AssertNotCalled(t, "EnqueueJob", mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Invalid Email", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/users/password-reset", bytes.NewBuffer([]byte(`{"email": "not-an-email"}`)))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestHandleResetPassword(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Put("/users/password", httpserver.HandleResetPassword(appState))
+
+	token, hash, _ := utils.GenerateOpaqueToken()
+	request := httpserver.PasswordUpdateRequestPayload{Token: token, Password: "new-secure-password"}
+
+	t.Run("Successful Reset", func(t *testing.T) {
+		mockRepo.On("ResetPassword", mock.Anything, hash, mock.MatchedBy(func(passwordHash string) bool {
+			return utils.CheckPasswordHash(passwordHash, request.Password)
+		})).Return(nil)
+
+		payload, _ := json.Marshal(request)
+		req := httptest.NewRequest(http.MethodPut, "/users/password", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Password updated successfully")
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Used Or Expired Token", func(t *testing.T) {
+		mockRepo.On("ResetPassword", mock.Anything, hash, mock.AnythingOfType("string")).Return(repository.ErrNotFound)
+
+		payload, _ := json.Marshal(request)
+		req := httptest.NewRequest(http.MethodPut, "/users/password", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid or expired password reset token")
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Short Password", func(t *testing.T) {
+		payload, _ := json.Marshal(httpserver.PasswordUpdateRequestPayload{Token: token, Password: "123"})
+		req := httptest.NewRequest(http.MethodPut, "/users/password", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockRepo.AssertNotCalled(t, "ResetPassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go_chi_pgx/phone"
+	"testing"
+)
+
+func TestPhoneNormalize(t *testing.T) {
+	valid := []struct {
+		raw, region, want string
+	}{
+		{"(217) 555-0100", "US", "+12175550100"},
+		{"217.555.0100", "US", "+12175550100"},
+		{"+1 217 555 0100", "DE", "+12175550100"},
+		{"1-217-555-0100", "US", "+12175550100"},
+		{"217-555-0100 ext. 12", "US", "+12175550100"},
+		{"030 901820", "DE", "+4930901820"},
+		{"+44 20 7946 0958", "US", "+442079460958"},
+		{"020 7946 0958", "gb", "+442079460958"},
+	}
+	for _, tc := range valid {
+		got, err := phone.Normalize(tc.raw, tc.region)
+		assert.NoError(t, err, tc.raw)
+		assert.Equal(t, tc.want, got, tc.raw)
+	}
+
+	for _, raw := range []string{"", "123", "(555) 123", "555-0100", "123-456-7890", "1-800-FLOWERS", "📞 217 555 0100"} {
+		_, err := phone.Normalize(raw, "US")
+		assert.ErrorIs(t, err, phone.ErrInvalid, raw)
+	}
+}
+
+func TestPhoneRegion(t *testing.T) {
+	assert.Equal(t, "DE", phone.Region("de", "US"))
+	assert.Equal(t, "GB", phone.Region(" GB ", "US"))
+	assert.Equal(t, "US", phone.Region("", "US"))
+	assert.Equal(t, "US", phone.Region("Atlantis", "us"))
+}
+
+func TestPhoneSearchDigits(t *testing.T) {
+	assert.Equal(t, "2175550100", phone.SearchDigits("(217) 555-0100"))
+	assert.Equal(t, "5550100", phone.SearchDigits("555-0100"))
+	assert.Equal(t, "4930901820", phone.SearchDigits("0049 30 901820"))
+	assert.Equal(t, "30901820", phone.SearchDigits("030 901820"))
+	assert.Equal(t, "", phone.SearchDigits("555"))
+	assert.Equal(t, "", phone.SearchDigits("742 Evergreen Terrace"))
+	assert.Equal(t, "", phone.SearchDigits("Homer"))
+}
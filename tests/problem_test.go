@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Post("/api/v1/contacts", httpserver.HandlerCreateContact(appState))
+	r.Get("/api/v1/contacts/{id}", httpserver.HandlerGetContactByID(appState))
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req = req.WithContext(context.WithValue(req.Context(), "userid", "b7358195-6291-4138-b115-2a046fe848f1"))
+		req.Header.Set("X-Request-Id", "req-42")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Validation", func(t *testing.T) {
+		w := serve(httptest.NewRequest(http.MethodPost, "/api/v1/contacts",
+			strings.NewReader(`{"phone":"2175557890","country":"Freedonia","zip_code":"62701"}`)))
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var problem utils.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, "about:blank", problem.Type)
+		assert.Equal(t, "Bad Request", problem.Title)
+		assert.Equal(t, http.StatusBadRequest, problem.Status)
+		assert.Equal(t, httpserver.ValidDataNotFound.Message, problem.Detail)
+		assert.Equal(t, "/api/v1/contacts", problem.Instance)
+		assert.Equal(t, "req-42", problem.RequestID)
+		assert.Contains(t, problem.Errors, httpserver.FieldError{Field: "country", Message: "must be a country name or ISO 3166-1 code"})
+		mockRepo.AssertNotCalled(t, "CreateContact", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Without Field Errors", func(t *testing.T) {
+		w := serve(httptest.NewRequest(http.MethodGet, "/api/v1/contacts/not-a-uuid", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, "/api/v1/contacts/not-a-uuid", body["instance"])
+		assert.NotContains(t, body, "errors")
+		assert.NotContains(t, body, "data")
+	})
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+type RefreshResponse struct {
+	Message string                            `json:"message"`
+	Data    httpserver.RefreshResponsePayload `json:"data"`
+}
+
+func TestHandleRefreshToken(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Post("/token/refresh", httpserver.HandleRefreshToken(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+	tokenID := uuid.Must(uuid.NewV4())
+	refreshToken, _ := utils.GenerateRefreshToken(userID, tokenID, cfg.RefreshKey, time.Hour)
+
+	t.Run("Successful Rotation", func(t *testing.T) {
+		mockRepo.On("RotateRefreshToken", mock.Anything, tokenID, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+
+		payload, _ := json.Marshal(httpserver.RefreshRequestPayload{RefreshToken: refreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response RefreshResponse
+		err = json.NewDecoder(w.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		claims, err := utils.VerifyJWT(response.Data.RefreshToken, utils.ScopeRefresh, cfg.TokenKeys())
+		assert.NoError(t, err)
+		assert.NotEqual(t, tokenID.String(), claims.ID)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Reused Token", func(t *testing.T) {
+		mockRepo.On("RotateRefreshToken", mock.Anything, tokenID, mock.AnythingOfType("*repository.RefreshToken")).Return(repository.ErrRefreshTokenReused)
+
+		payload, _ := json.Marshal(httpserver.RefreshRequestPayload{RefreshToken: refreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Refresh token reuse detected")
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Revoked Token", func(t *testing.T) {
+		mockRepo.On("RotateRefreshToken", mock.Anything, tokenID, mock.AnythingOfType("*repository.RefreshToken")).Return(repository.ErrRefreshTokenRevoked)
+
+		payload, _ := json.Marshal(httpserver.RefreshRequestPayload{RefreshToken: refreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Unauthorized user")
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Access Token", func(t *testing.T) {
+		accessToken, _ := utils.GenerateJWT(userID, utils.ScopeAuthentication, cfg.SecretKey, time.Hour)
+
+		payload, _ := json.Marshal(httpserver.RefreshRequestPayload{RefreshToken: accessToken})
+		req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockRepo.AssertNotCalled(t, "RotateRefreshToken")
+	})
+}
+
+func TestHandleRevokeToken(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Post("/token/revoke", httpserver.HandleRevokeToken(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+	tokenID := uuid.Must(uuid.NewV4())
+	refreshToken, _ := utils.GenerateRefreshToken(userID, tokenID, cfg.RefreshKey, time.Hour)
+
+	t.Run("Successful Revocation", func(t *testing.T) {
+		mockRepo.On("RevokeRefreshTokenFamily", mock.Anything, tokenID).Return(nil)
+
+		payload, _ := json.Marshal(httpserver.RefreshRequestPayload{RefreshToken: refreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/token/revoke", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Token revoked successfully")
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Unknown Token", func(t *testing.T) {
+		mockRepo.On("RevokeRefreshTokenFamily", mock.Anything, tokenID).Return(repository.ErrRefreshTokenNotFound)
+
+		payload, _ := json.Marshal(httpserver.RefreshRequestPayload{RefreshToken: refreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/token/revoke", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
@@ -2,7 +2,6 @@ package tests
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi/v5"
@@ -12,9 +11,11 @@ import (
 	"go_chi_pgx/mocks"
 	"go_chi_pgx/repository"
 	"go_chi_pgx/state"
+	utils "go_chi_pgx/utils"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -30,7 +31,7 @@ func TestHandleRegisterUser(t *testing.T) {
 		t.Fatalf("Config parsing failed: %v", err)
 	}
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 	r := chi.NewRouter()
 	r.Post("/users", httpserver.HandleRegisterUser(appState))
 
@@ -42,8 +43,11 @@ func TestHandleRegisterUser(t *testing.T) {
 
 	t.Run("Successful Registration", func(t *testing.T) {
 
-		mockRepo.On("GetUserByEmail", mock.Anything, validRequest.Email).Return((*repository.User)(nil), sql.ErrNoRows)
+		mockRepo.On("GetUserByEmail", mock.Anything, validRequest.Email).Return((*repository.User)(nil), repository.ErrNotFound)
 		mockRepo.On("CreateUser", mock.Anything, mock.AnythingOfType("*repository.User")).Return(nil)
+		mockRepo.On("EnqueueJob", mock.Anything, mock.MatchedBy(func(job *repository.Job) bool {
+			return job.Kind == httpserver.KindActivationEmail && !strings.Contains(string(job.Payload), "token")
+		})).Return(nil)
 
 		payload, _ := json.Marshal(validRequest)
 		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(payload))
@@ -55,7 +59,9 @@ func TestHandleRegisterUser(t *testing.T) {
 		var response RegistrationResponsePayload
 		err = json.NewDecoder(w.Body).Decode(&response)
 		assert.NoError(t, err)
-		assert.NotEmpty(t, response.Data.ActivateToken)
+		assert.Equal(t, validRequest.Email, response.Data.Email)
+		assert.False(t, response.Data.IsActive)
+		assert.NotContains(t, w.Body.String(), "token")
 
 		mockRepo.AssertExpectations(t)
 		t.Cleanup(func() {
@@ -77,6 +83,22 @@ func TestHandleRegisterUser(t *testing.T) {
 		})
 	})
 
+	t.Run("Invalid Email", func(t *testing.T) {
+		payload, _ := json.Marshal(httpserver.RegistrationRequestPayload{Name: "John Doe", Email: "john.doe", Password: "securepassword"})
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var problem utils.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		if assert.Len(t, problem.Errors, 1) {
+			assert.Equal(t, "email", problem.Errors[0].Field)
+			assert.Equal(t, "must be a valid email address", problem.Errors[0].Message)
+		}
+		mockRepo.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+	})
+
 	t.Run("User Already Exists", func(t *testing.T) {
 		mockRepo.On("GetUserByEmail", mock.Anything, validRequest.Email).Return(&repository.User{}, nil)
 
@@ -94,7 +116,7 @@ func TestHandleRegisterUser(t *testing.T) {
 	})
 
 	t.Run("Failed to Create User", func(t *testing.T) {
-		mockRepo.On("GetUserByEmail", mock.Anything, validRequest.Email).Return((*repository.User)(nil), sql.ErrNoRows)
+		mockRepo.On("GetUserByEmail", mock.Anything, validRequest.Email).Return((*repository.User)(nil), repository.ErrNotFound)
 		mockRepo.On("CreateUser", mock.Anything, mock.AnythingOfType("*repository.User")).Return(fmt.Errorf("creation error"))
 
 		payload, _ := json.Marshal(validRequest)
@@ -111,4 +133,26 @@ func TestHandleRegisterUser(t *testing.T) {
 			mockRepo.Calls = nil
 		})
 	})
+
+	t.Run("Concurrent Registration", func(t *testing.T) {
+		mockRepo.On("GetUserByEmail", mock.Anything, validRequest.Email).Return((*repository.User)(nil), repository.ErrNotFound)
+		mockRepo.On("CreateUser", mock.Anything, mock.AnythingOfType("*repository.User")).Return(&repository.ConstraintError{
+			Err:        repository.ErrUniqueViolation,
+			Constraint: "users_email_key",
+		})
+
+		payload, _ := json.Marshal(validRequest)
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "User Already Exist With this Email")
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
 }
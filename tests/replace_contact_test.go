@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestPutContactHandler(t *testing.T) {
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Put("/contacts/{id}", httpserver.HandlerPutContactByID(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	put := func(contactID uuid.UUID, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/contacts/"+contactID.String(), bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Invalid Payload", func(t *testing.T) {
+		w := put(uuid.Must(uuid.NewV4()), `{"city": "Springfield"}`, nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "is required")
+
+		w = put(uuid.Nil, `{"phone": "217-555-0100"}`, nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "Invalid contact ID")
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Create With Client ID", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("PutContactObject", mock.Anything, mock.MatchedBy(func(contact *repository.Contact) bool {
+			return contact.ID == contactID && contact.UserID == userID && contact.Phone == "217-555-0100" && contact.City == ""
+		}), repository.ContactPrecondition{MustNotExist: true}).Run(func(args mock.Arguments) {
+			args.Get(1).(*repository.Contact).Version = 1
+		}).Return(true, nil)
+
+		w := put(contactID, `{"phone": "217-555-0100"}`, map[string]string{"If-None-Match": "*"})
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "Contacts Created successfully")
+		assert.Contains(t, w.Body.String(), contactID.String())
+		assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("GetContactObject", mock.Anything, userID, contactID).Return(&repository.Contact{ID: contactID, Version: 2}, nil)
+		mockRepo.On("PutContactObject", mock.Anything, mock.AnythingOfType("*repository.Contact"), repository.ContactPrecondition{Version: 2}).
+			Run(func(args mock.Arguments) {
+				args.Get(1).(*repository.Contact).Version = 3
+			}).Return(false, nil).Once()
+
+		w := put(contactID, `{"phone": "217-555-0100", "city": "Springfield"}`, map[string]string{"If-Match": `"1"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode)
+
+		w = put(contactID, `{"phone": "217-555-0100", "city": "Springfield"}`, map[string]string{"If-Match": `"2"`})
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "Contacts Updated successfully")
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("ID Owned By Another User", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("PutContactObject", mock.Anything, mock.AnythingOfType("*repository.Contact"), repository.ContactPrecondition{}).
+			Return(false, &repository.ConstraintError{Err: repository.ErrUniqueViolation, Constraint: "contacts_pkey"})
+
+		w := put(contactID, `{"phone": "217-555-0100"}`, nil)
+
+		assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("If-Match On Missing Contact", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("GetContactObject", mock.Anything, userID, contactID).Return((*repository.Contact)(nil), repository.ErrNotFound)
+
+		w := put(contactID, `{"phone": "217-555-0100"}`, map[string]string{"If-Match": "*"})
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode)
+		mockRepo.AssertNotCalled(t, "PutContactObject", mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
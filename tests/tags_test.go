@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTagHandlers(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Get("/tags", httpserver.HandlerGetTags(appState))
+	r.Post("/tags", httpserver.HandlerCreateTag(appState))
+	r.Patch("/tags/{id}", httpserver.HandlerRenameTag(appState))
+	r.Delete("/tags/{id}", httpserver.HandlerDeleteTag(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+	tagID := uuid.Must(uuid.NewV4())
+
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("List", func(t *testing.T) {
+		tags := []repository.Tag{{ID: tagID, UserID: userID, Name: "customers", ContactCount: 3}}
+		mockRepo.On("GetTags", mock.Anything, userID).Return(tags, nil).Once()
+
+		w := send(http.MethodGet, "/tags", "")
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"name":"customers","contact_count":3`)
+		assert.NotContains(t, w.Body.String(), userID.String())
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Create Trims The Name", func(t *testing.T) {
+		mockRepo.On("CreateTag", mock.Anything, mock.MatchedBy(func(tag *repository.Tag) bool {
+			return tag.UserID == userID && tag.Name == "Project X" && tag.ID != uuid.Nil
+		})).Return(nil).Once()
+
+		w := send(http.MethodPost, "/tags", `{"name": "  Project X "}`)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Create Duplicate Name", func(t *testing.T) {
+		mockRepo.On("CreateTag", mock.Anything, mock.Anything).
+			Return(&repository.ConstraintError{Err: repository.ErrUniqueViolation, Constraint: "tags_user_name_idx"}).Once()
+
+		w := send(http.MethodPost, "/tags", `{"name": "customers"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), httpserver.TagNameTaken.Message)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Create Blank Name", func(t *testing.T) {
+		w := send(http.MethodPost, "/tags", `{"name": "   "}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"field":"name"`)
+		mockRepo.AssertNotCalled(t, "CreateTag", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		mockRepo.On("RenameTag", mock.Anything, userID, tagID, "clients").Return(nil).Once()
+		mockRepo.On("GetTagByID", mock.Anything, userID, tagID).Return(&repository.Tag{ID: tagID, Name: "clients", ContactCount: 3}, nil).Once()
+
+		w := send(http.MethodPatch, "/tags/"+tagID.String(), `{"name": "clients"}`)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"name":"clients"`)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Delete Not Found", func(t *testing.T) {
+		mockRepo.On("DeleteTag", mock.Anything, userID, tagID).Return(repository.ErrNotFound).Once()
+
+		w := send(http.MethodDelete, "/tags/"+tagID.String(), "")
+
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), httpserver.TagNotFound.Message)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Invalid ID", func(t *testing.T) {
+		w := send(http.MethodDelete, "/tags/not-a-uuid", "")
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+}
+
+func TestTagContactsHandlers(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Post("/contacts/tag", httpserver.HandlerTagContacts(appState))
+	r.Post("/contacts/untag", httpserver.HandlerUntagContacts(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+	tagIDs := []uuid.UUID{uuid.Must(uuid.NewV4())}
+	contactIDs := []uuid.UUID{uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())}
+	body, _ := json.Marshal(httpserver.TagContactsPayload{TagIDs: tagIDs, ContactIDs: contactIDs})
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Tag", func(t *testing.T) {
+		mockRepo.On("TagContacts", mock.Anything, userID, tagIDs, contactIDs).Return(int64(2), nil).Once()
+
+		w := post("/contacts/tag", string(body))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"changed":2`)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Untag", func(t *testing.T) {
+		mockRepo.On("UntagContacts", mock.Anything, userID, tagIDs, contactIDs).Return(int64(1), nil).Once()
+
+		w := post("/contacts/untag", string(body))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"changed":1`)
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Unknown Tag Or Contact", func(t *testing.T) {
+		mockRepo.On("TagContacts", mock.Anything, userID, tagIDs, contactIDs).Return(int64(0), repository.ErrNotFound).Once()
+
+		w := post("/contacts/tag", string(body))
+
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), httpserver.TagTargetsNotFound.Message)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Empty Lists", func(t *testing.T) {
+		w := post("/contacts/tag", `{"tag_ids": [], "contact_ids": ["`+contactIDs[0].String()+`"]}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"field":"tag_ids"`)
+		mockRepo.AssertNotCalled(t, "TagContacts", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
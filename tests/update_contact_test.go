@@ -2,7 +2,7 @@ package tests
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"github.com/go-chi/chi/v5"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
@@ -25,13 +25,16 @@ func TestUpdateContactHandler(t *testing.T) {
 		t.Fatalf("Config parsing failed: %v", err)
 	}
 	mockRepo := new(mocks.MockRepository)
-	appState := state.NewState(cfg, mockRepo, logger)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
 
 	r := chi.NewRouter()
 	r.Patch("/contacts/{id}", httpserver.HandlerPatchContactByID(appState))
 
+	userID := uuid.Must(uuid.NewV4())
+
 	t.Run("Invalid Contact ID", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPatch, "/contacts/invalid-id", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -48,9 +51,10 @@ func TestUpdateContactHandler(t *testing.T) {
 	t.Run("Contact Not Found", func(t *testing.T) {
 		contactID, _ := uuid.NewV4()
 
-		mockRepo.On("GetContactByID", mock.Anything, contactID).Return(nil, sql.ErrNoRows)
-		reqBody := bytes.NewBuffer([]byte(`{"name": "Updated Name", "phone": "123-456-7890"}`))
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(nil, repository.ErrNotFound)
+		reqBody := bytes.NewBuffer([]byte(`{"name": "Updated Name", "phone": "217-555-7890"}`))
 		req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), reqBody)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -68,21 +72,22 @@ func TestUpdateContactHandler(t *testing.T) {
 		contactID, _ := uuid.NewV4()
 		mockContact := &repository.ContactWithUserResponse{
 			ContactID: contactID,
-			Phone:     "123-456-7890",
+			Phone:     "217-555-7890",
 			Street:    "123 Main St",
 			City:      "Sample City",
-			State:     "Sample State",
-			ZipCode:   "12345",
-			Country:   "Sample Country",
+			State:     "IL",
+			ZipCode:   "62701",
+			Country:   "US",
 			UserName:  "Mohim",
 			UserEmail: "mohim@example.com",
 		}
-		mockRepo.On("GetContactByID", mock.Anything, contactID).Return(mockContact, nil)
-		mockRepo.On("PatchContactByID", mock.Anything, contactID, mock.AnythingOfType("*repository.Contact")).Return(nil)
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.AnythingOfType("*repository.ContactPatch")).Return(nil)
 
-		reqBody := bytes.NewBuffer([]byte(`{"name": "Updated Name", "phone": "123-456-7890"}`))
+		reqBody := bytes.NewBuffer([]byte(`{"name": "Updated Name", "phone": "217-555-7890"}`))
 
 		req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), reqBody)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -100,21 +105,22 @@ func TestUpdateContactHandler(t *testing.T) {
 		contactID, _ := uuid.NewV4()
 		mockContact := &repository.ContactWithUserResponse{
 			ContactID: contactID,
-			Phone:     "123-456-7890",
+			Phone:     "217-555-7890",
 			Street:    "123 Main St",
 			City:      "Sample City",
-			State:     "Sample State",
-			ZipCode:   "12345",
-			Country:   "Sample Country",
+			State:     "IL",
+			ZipCode:   "62701",
+			Country:   "US",
 			UserName:  "Mohim",
 			UserEmail: "mohim@example.com",
 		}
-		mockRepo.On("GetContactByID", mock.Anything, contactID).Return(mockContact, nil)
-		mockRepo.On("PatchContactByID", mock.Anything, contactID, mock.AnythingOfType("*repository.Contact")).Return(errors.New("db error"))
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.AnythingOfType("*repository.ContactPatch")).Return(errors.New("db error"))
 
-		reqBody := bytes.NewBuffer([]byte(`{"name": "Updated Name", "phone": "123-456-7890"}`))
+		reqBody := bytes.NewBuffer([]byte(`{"name": "Updated Name", "phone": "217-555-7890"}`))
 
 		req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), reqBody)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -133,6 +139,7 @@ func TestUpdateContactHandler(t *testing.T) {
 
 		body := []byte(`{"invalid":`)
 		req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
 		w := httptest.NewRecorder()
 
 		r.ServeHTTP(w, req)
@@ -146,4 +153,326 @@ func TestUpdateContactHandler(t *testing.T) {
 			mockRepo.Calls = nil
 		})
 	})
+
+	t.Run("If-Match", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		mockContact := &repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-7890",
+			City:      "Sample City",
+			Version:   3,
+		}
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return patch.Version == 3 && *patch.City == "New City"
+		})).Run(func(args mock.Arguments) {
+			args.Get(3).(*repository.ContactPatch).Version = 4
+		}).Return(nil).Once()
+
+		patch := func(ifMatch string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewBufferString(`{"city": "New City"}`))
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+			req.Header.Set("If-Match", ifMatch)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := patch(`"2"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode)
+		w = patch(`W/"3"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode)
+		mockRepo.AssertNotCalled(t, "PatchContactByID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		w = patch(`"1", "3"`)
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Concurrent Update", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		mockContact := &repository.ContactWithUserResponse{ContactID: contactID, Phone: "217-555-7890", Version: 3}
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.AnythingOfType("*repository.ContactPatch")).
+			Return(repository.ErrPreconditionFailed)
+
+		for ifMatch, status := range map[string]int{"": http.StatusConflict, `"3"`: http.StatusPreconditionFailed} {
+			req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewBufferString(`{"city": "New City"}`))
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+			if ifMatch != "" {
+				req.Header.Set("If-Match", ifMatch)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, status, w.Result().StatusCode, ifMatch)
+		}
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Merge Patch", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		mockContact := &repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-7890",
+			Street:    "123 Main St",
+			City:      "Sample City",
+			ZipCode:   "12345",
+			Version:   1,
+		}
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return patch.Phone == nil && patch.City == nil &&
+				*patch.Street == "" && *patch.ZipCode == "" && *patch.Country == "CA"
+		})).Return(nil).Once()
+
+		reqBody := bytes.NewBufferString(`{"street": null, "zip_code": null, "country": "Canada"}`)
+		req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), reqBody)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"street":""`)
+		assert.Contains(t, w.Body.String(), `"city":"Sample City"`)
+
+		reqBody = bytes.NewBufferString(`{"phone": null}`)
+		req = httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), reqBody)
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w = httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "is required")
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("JSON Patch", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		mockContact := &repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-7890",
+			Street:    "123 Main St",
+			City:      "Sample City",
+			Version:   1,
+		}
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return patch.Phone == nil && *patch.Street == "" && *patch.State == "123 Main St" && *patch.City == ""
+		})).Return(nil).Once()
+
+		patch := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+			req.Header.Set("Content-Type", "application/json-patch+json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := patch(`[
+			{"op": "test", "path": "/city", "value": "Sample City"},
+			{"op": "move", "from": "/street", "path": "/state"},
+			{"op": "remove", "path": "/city"}
+		]`)
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"state":"123 Main St"`)
+
+		w = patch(`[{"op": "test", "path": "/city", "value": "Other City"}, {"op": "remove", "path": "/street"}]`)
+		assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+
+		w = patch(`[{"op": "replace", "path": "/name", "value": "Homer"}]`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "is not a contact field")
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Patch Lists", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		mockContact := &repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-0100",
+			City:      "Springfield",
+			Version:   1,
+			Phones:    []repository.ContactPhone{{Label: "mobile", Number: "217-555-0100", Primary: true}},
+			Emails:    []repository.ContactEmail{},
+			Addresses: []repository.ContactAddress{{Label: "home", City: "Springfield", Primary: true}},
+		}
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return *patch.Phone == "217-555-0199" && patch.City == nil && patch.Addresses == nil &&
+				len(patch.Phones) == 2 && !patch.Phones[0].Primary && patch.Phones[1].Primary && patch.Phones[1].Label == "work" &&
+				len(patch.Emails) == 1 && patch.Emails[0].Address == "homer@example.com"
+		})).Return(nil).Once()
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return *patch.City == "Shelbyville" && patch.Phones == nil &&
+				len(patch.Addresses) == 1 && patch.Addresses[0].City == "Shelbyville" && patch.Addresses[0].Primary
+		})).Return(nil).Once()
+
+		patch := func(contentType, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := patch("application/json-patch+json", `[
+			{"op": "test", "path": "/phones/0/number", "value": "217-555-0100"},
+			{"op": "add", "path": "/phones/-", "value": {"label": "work", "number": "217-555-0199"}},
+			{"op": "add", "path": "/phones/1/primary", "value": true},
+			{"op": "replace", "path": "/phones/0/primary", "value": false},
+			{"op": "add", "path": "/emails/0", "value": {"address": "homer@example.com"}}
+		]`)
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"phone":"217-555-0199"`)
+
+		w = patch("application/merge-patch+json", `{"city": "Shelbyville"}`)
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+		w = patch("application/json-patch+json", `[{"op": "remove", "path": "/phones/3"}]`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "does not exist")
+
+		w = patch("application/merge-patch+json", `{"phones": []}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "is required")
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Stored Phone Is Only Validated When Touched", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		mockContact := &repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "555-0100",
+			City:      "Springfield",
+			Version:   1,
+			Phones:    []repository.ContactPhone{{Label: "mobile", Number: "555-0100", Primary: true}},
+			Emails:    []repository.ContactEmail{},
+			Addresses: []repository.ContactAddress{{Label: "home", City: "Springfield", Primary: true}},
+		}
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return patch.Phone == nil && patch.Phones == nil && *patch.Notes == "Owes $20"
+		})).Return(nil).Once()
+
+		patch := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := patch(`{"notes": "Owes $20"}`)
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+		w = patch(`{"phone": "555-0199"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"field":"phone"`)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Stored Address Is Only Validated When Touched", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+		mockContact := &repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-0100",
+			City:      "Springfield",
+			ZipCode:   "ABC",
+			Country:   "US",
+			Version:   1,
+			Phones:    []repository.ContactPhone{{Label: "mobile", Number: "217-555-0100", Primary: true}},
+			Emails:    []repository.ContactEmail{},
+			Addresses: []repository.ContactAddress{
+				{Label: "home", City: "Springfield", ZipCode: "ABC", Country: "US", Primary: true},
+				{Label: "work", City: "Fredonia", Country: "Freedonia"},
+			},
+		}
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(mockContact, nil)
+		mockRepo.On("PatchContactByID", mock.Anything, userID, contactID, mock.MatchedBy(func(patch *repository.ContactPatch) bool {
+			return *patch.City == "Shelbyville" && patch.ZipCode == nil && patch.Country == nil && patch.Addresses != nil
+		})).Return(nil).Once()
+
+		patch := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := patch(`{"city": "Shelbyville"}`)
+		assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+		w = patch(`{"country": "CA"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"field":"zip_code"`)
+		assert.NotContains(t, w.Body.String(), `"field":"addresses[1].country"`)
+
+		w = patch(`{"addresses": [{"city": "Fredonia", "country": "Freedonia"}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), `"field":"addresses[0].country"`)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Unsupported Media Type", func(t *testing.T) {
+		contactID, _ := uuid.NewV4()
+
+		req := httptest.NewRequest(http.MethodPatch, "/contacts/"+contactID.String(), bytes.NewBufferString(`city=Springfield`))
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Result().StatusCode)
+		assert.Equal(t, "application/merge-patch+json, application/json-patch+json", w.Header().Get("Accept-Patch"))
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
 }
@@ -0,0 +1,354 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go_chi_pgx/cmd/httpserver"
+	"go_chi_pgx/mocks"
+	"go_chi_pgx/repository"
+	"go_chi_pgx/state"
+	"go_chi_pgx/vcard"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const appleCard = "BEGIN:VCARD\r\n" +
+	"VERSION:3.0\r\n" +
+	"N:Simpson;Homer;Jay;;\r\n" +
+	"FN:Homer Simpson\r\n" +
+	"item1.TEL;type=CELL;type=VOICE:(217) 555-0100\r\n" +
+	"TEL;TYPE=WORK,VOICE,PREF:+1 217 555 0199\r\n" +
+	"ADR;TYPE=WORK:;;Sector 7G\\, Springfield Nuclear Power Plant;Springfield;OR;97475;USA\r\n" +
+	"ADR;TYPE=HOME,pref:;Garage;742 Evergreen Terrace;Springf\r\n" +
+	" ield;OR;97477;\r\n" +
+	"\tUnited States\r\n" +
+	"NOTE:Likes donuts\\; hates\\, broccoli\\nSecond line \\\\ backslash\r\n" +
+	"END:VCARD\r\n"
+
+func TestVCardDecode(t *testing.T) {
+	card, err := vcard.NewDecoder(strings.NewReader(appleCard)).Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, card.Line)
+	assert.Equal(t, vcard.Version3, card.Version())
+
+	tels := card.Get("TEL")
+	assert.Len(t, tels, 2)
+	assert.Equal(t, "item1", tels[0].Group)
+	assert.Equal(t, []string{"cell", "voice"}, tels[0].Types())
+	assert.False(t, tels[0].Preferred())
+	assert.True(t, tels[1].Preferred())
+
+	adrs := card.Get("ADR")
+	assert.Len(t, adrs, 2)
+	assert.Equal(t, []string{"", "", "Sector 7G, Springfield Nuclear Power Plant", "Springfield", "OR", "97475", "USA"}, adrs[0].Components())
+	assert.Equal(t, []string{"", "Garage", "742 Evergreen Terrace", "Springfield", "OR", "97477", "United States"}, adrs[1].Components())
+
+	assert.Equal(t, "Likes donuts; hates, broccoli\nSecond line \\ backslash", card.Value("NOTE"))
+
+	contact := vcard.ToContact(card)
+	assert.Equal(t, "+1 217 555 0199", contact.Phone)
+	assert.Equal(t, "742 Evergreen Terrace, Garage", contact.Street)
+	assert.Equal(t, "Springfield", contact.City)
+	assert.Equal(t, "97477", contact.ZipCode)
+	assert.Equal(t, "United States", contact.Country)
+	assert.Equal(t, "Homer", contact.GivenName)
+	assert.Equal(t, "Simpson", contact.FamilyName)
+	assert.Empty(t, contact.DisplayName)
+	assert.Equal(t, "Likes donuts; hates, broccoli\nSecond line \\ backslash", contact.Notes)
+}
+
+func TestVCardRoundTrip(t *testing.T) {
+	card := &vcard.Card{}
+	card.Add(
+		vcard.NewText("VERSION", vcard.Version4),
+		vcard.NewText("FN", "Über Långnamn, Jr."),
+		vcard.NewText("TEL", "tel:+1-217-555-0100").WithParam("TYPE", "cell").WithParam("PREF", "1"),
+		vcard.NewText("TEL", "+1 555 010 0101").WithParam("TYPE", "work", "voice"),
+		vcard.NewStructured("ADR", "", "Suite 4; Floor 2", "1 Main St, Unit A", "Springfield", "IL", "62701", "USA").WithParam("LABEL", "1 Main St\nSpringfield: IL"),
+		vcard.NewStructured("ADR", "", "", "2 Side St", "Shelbyville", "IL", "62565", "USA"),
+		vcard.NewText("NOTE", strings.Repeat("A long note with ünïcödé, commas; and semicolons. ", 6)),
+	)
+
+	var buf bytes.Buffer
+	assert.NoError(t, vcard.NewEncoder(&buf).Encode(card))
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+	assert.True(t, strings.HasPrefix(buf.String(), "BEGIN:VCARD\r\nVERSION:4.0\r\n"))
+
+	decoded, err := vcard.NewDecoder(&buf).Decode()
+	assert.NoError(t, err)
+	decoded.Line = 0
+	assert.Equal(t, card, decoded)
+
+	_, err = vcard.NewDecoder(&buf).Decode()
+	assert.Equal(t, io.EOF, err)
+
+	contact := vcard.ToContact(decoded)
+	assert.Equal(t, "+1-217-555-0100", contact.Phone)
+	assert.Equal(t, "1 Main St, Unit A, Suite 4; Floor 2", contact.Street)
+}
+
+func TestVCardEscapedSemicolons(t *testing.T) {
+	card := &vcard.Card{}
+	card.Add(
+		vcard.NewText("VERSION", vcard.Version3),
+		vcard.NewStructured("ORG", "Sector 7G; Nuclear Plant", "Safety"),
+		vcard.NewText("NOTE", `a\b; c`),
+	)
+
+	var buf bytes.Buffer
+	assert.NoError(t, vcard.NewEncoder(&buf).Encode(card))
+	assert.Contains(t, buf.String(), "ORG:Sector 7G\\; Nuclear Plant;Safety\r\n")
+	assert.Contains(t, buf.String(), "NOTE:a\\\\b\\; c\r\n")
+
+	decoded, err := vcard.NewDecoder(&buf).Decode()
+	assert.NoError(t, err)
+	org, _ := decoded.Preferred("ORG")
+	assert.Equal(t, []string{"Sector 7G; Nuclear Plant", "Safety"}, org.Components())
+	assert.Equal(t, `a\b; c`, decoded.Value("NOTE"))
+
+	library := decoded.Library()
+	assert.Equal(t, `Sector 7G\; Nuclear Plant;Safety`, library.Value("ORG"))
+	converted := vcard.FromLibrary(library)
+	org, _ = converted.Preferred("ORG")
+	assert.Equal(t, []string{"Sector 7G; Nuclear Plant", "Safety"}, org.Components())
+	assert.Equal(t, `a\b; c`, converted.Value("NOTE"))
+}
+
+func TestVCardContactRoundTrip(t *testing.T) {
+	contact := repository.Contact{
+		ID:        uuid.Must(uuid.NewV4()),
+		Phone:     "217-555-0100",
+		Street:    "742 Evergreen Terrace; Apt 1",
+		City:      "Springfield",
+		State:     "OR",
+		ZipCode:   "97477",
+		Country:   "US",
+		UpdatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	for _, version := range []string{vcard.Version3, vcard.Version4} {
+		var buf bytes.Buffer
+		assert.NoError(t, vcard.NewEncoder(&buf).Encode(vcard.FromContact(&contact, version)))
+		assert.Contains(t, buf.String(), "VERSION:"+version)
+
+		card, err := vcard.NewDecoder(&buf).Decode()
+		assert.NoError(t, err)
+		decoded := vcard.ToContact(card)
+		assert.Equal(t, contact.ID, decoded.ID)
+		assert.Equal(t, contact.Phone, decoded.Phone)
+		assert.Equal(t, contact.Street, decoded.Street)
+		assert.Equal(t, contact.City, decoded.City)
+		assert.Equal(t, contact.State, decoded.State)
+		assert.Equal(t, contact.ZipCode, decoded.ZipCode)
+		assert.Equal(t, contact.Country, decoded.Country)
+	}
+}
+
+func TestVCardContactProfile(t *testing.T) {
+	contact := repository.Contact{
+		ContactProfile: repository.ContactProfile{
+			GivenName:   "Marge",
+			FamilyName:  "Simpson",
+			DisplayName: "Marjorie Simpson",
+			Nickname:    "Midge",
+			Company:     "Pretzel Wagon; Inc.",
+			JobTitle:    "Owner",
+			Notes:       "Blue hair",
+		},
+		Phone: "217-555-0100",
+	}
+
+	for _, version := range []string{vcard.Version3, vcard.Version4} {
+		card := vcard.FromContact(&contact, version)
+		assert.Equal(t, "Marjorie Simpson", card.Value("FN"))
+		assert.Equal(t, []string{"Simpson", "Marge", "", "", ""}, card.Get("N")[0].Components())
+		assert.Equal(t, []string{"Pretzel Wagon; Inc."}, card.Get("ORG")[0].Components())
+		assert.Equal(t, contact.ContactProfile, vcard.ToContact(card).ContactProfile)
+	}
+
+	t.Run("Formatted Name Fallback", func(t *testing.T) {
+		named := repository.Contact{ContactProfile: repository.ContactProfile{GivenName: "Bart", FamilyName: "Simpson"}, Phone: "217-555-0101"}
+		card := vcard.FromContact(&named, vcard.Version4)
+		assert.Equal(t, "Bart Simpson", card.Value("FN"))
+		assert.Empty(t, vcard.ToContact(card).DisplayName)
+
+		unnamed := repository.Contact{Phone: "217-555-0102"}
+		card = vcard.FromContact(&unnamed, vcard.Version4)
+		assert.Equal(t, "217-555-0102", card.Value("FN"))
+		assert.Empty(t, card.Get("N"))
+		assert.Empty(t, vcard.ToContact(card).DisplayName)
+	})
+}
+
+func TestVCardContactLists(t *testing.T) {
+	card, err := vcard.NewDecoder(strings.NewReader(appleCard)).Decode()
+	assert.NoError(t, err)
+
+	contact := vcard.ToContact(card)
+	assert.Equal(t, []repository.ContactPhone{
+		{Label: "mobile", Number: "(217) 555-0100"},
+		{Label: "work", Number: "+1 217 555 0199", Primary: true},
+	}, contact.Phones)
+	assert.Len(t, contact.Addresses, 2)
+	assert.Equal(t, "work", contact.Addresses[0].Label)
+	assert.True(t, contact.Addresses[1].Primary)
+	assert.Equal(t, contact.Street, contact.Addresses[1].Street)
+
+	contact.Emails = []repository.ContactEmail{{Label: "home", Address: "homer@example.com", Primary: true}}
+	for _, version := range []string{vcard.Version3, vcard.Version4} {
+		var buf bytes.Buffer
+		assert.NoError(t, vcard.NewEncoder(&buf).Encode(vcard.FromContact(&contact, version)))
+
+		decoded, err := vcard.NewDecoder(&buf).Decode()
+		assert.NoError(t, err)
+		roundTrip := vcard.ToContact(decoded)
+		assert.Equal(t, contact.Phones, roundTrip.Phones)
+		assert.Equal(t, contact.Emails, roundTrip.Emails)
+		assert.Equal(t, contact.Addresses, roundTrip.Addresses)
+		assert.Equal(t, "+1 217 555 0199", roundTrip.Phone)
+	}
+}
+
+func TestVCardDecodeErrors(t *testing.T) {
+	stream := "BEGIN:VCARD\r\nVERSION:3.0\r\nTEL;TYPE=\"cell:217-555-0100\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nFN:No Version\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\nVERSION:2.1\nTEL;CELL:217-555-0102\nEND:VCARD\n"
+	decoder := vcard.NewDecoder(strings.NewReader(stream))
+
+	_, err := decoder.Decode()
+	var parseErr *vcard.ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, 3, parseErr.Line)
+	assert.True(t, errors.Is(err, vcard.ErrInvalidCard))
+
+	_, err = decoder.Decode()
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, 5, parseErr.Line)
+
+	card, err := decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 8, card.Line)
+	tel, _ := card.Preferred("TEL")
+	assert.Equal(t, []string{"cell"}, tel.Types())
+	assert.Equal(t, "217-555-0102", vcard.ToContact(card).Phone)
+
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestContactsVCardEndpoints(t *testing.T) {
+
+	logger := state.New(os.Stdout, state.LevelInfo)
+	cfg, err := state.NewConfig()
+	if err != nil {
+		t.Fatalf("Config parsing failed: %v", err)
+	}
+	mockRepo := new(mocks.MockRepository)
+	appState := state.NewState(cfg, mockRepo, logger, new(mocks.MockMailer))
+
+	r := chi.NewRouter()
+	r.Post("/contacts/import", httpserver.HandlerImportContacts(appState))
+	r.Get("/contacts/export", httpserver.HandlerExportContacts(appState))
+	r.Get("/contacts/{id}", httpserver.HandlerGetContactByID(appState))
+	r.Get("/contacts/{id}.vcf", httpserver.HandlerGetContactVCard(appState))
+
+	userID := uuid.Must(uuid.NewV4())
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req = req.WithContext(context.WithValue(req.Context(), "userid", userID.String()))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Single Contact", func(t *testing.T) {
+		contactID := uuid.Must(uuid.NewV4())
+		mockRepo.On("GetContactByID", mock.Anything, userID, contactID).Return(&repository.ContactWithUserResponse{
+			ContactID: contactID,
+			Phone:     "217-555-0100",
+			City:      "Springfield",
+		}, nil)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/"+contactID.String()+".vcf?version=4.0", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, "text/vcard; charset=utf-8", w.Header().Get("Content-Type"))
+		card, err := vcard.NewDecoder(w.Body).Decode()
+		assert.NoError(t, err)
+		assert.Equal(t, vcard.Version4, card.Version())
+		assert.Equal(t, "urn:uuid:"+contactID.String(), card.Value("UID"))
+		assert.Equal(t, "Springfield", vcard.ToContact(card).City)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Multi Contact Export", func(t *testing.T) {
+		contacts := []repository.Contact{
+			{ID: uuid.Must(uuid.NewV4()), Phone: "217-555-0100"},
+			{ID: uuid.Must(uuid.NewV4()), Phone: "217-555-0101"},
+		}
+		mockRepo.On("StreamContacts", mock.Anything, userID, repository.ContactFilter{}).Return(contacts, nil)
+
+		w := serve(httptest.NewRequest(http.MethodGet, "/contacts/export?format=vcard", nil))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "contacts.vcf")
+		decoder := vcard.NewDecoder(w.Body)
+		for _, contact := range contacts {
+			card, err := decoder.Decode()
+			assert.NoError(t, err)
+			assert.Equal(t, vcard.Version3, card.Version())
+			assert.Equal(t, contact.ID, vcard.ToContact(card).ID)
+		}
+		_, err := decoder.Decode()
+		assert.Equal(t, io.EOF, err)
+
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		mockRepo.On("CopyContacts", mock.Anything, mock.MatchedBy(func(contacts []repository.Contact) bool {
+			return len(contacts) == 1 && contacts[0].Phone == "+1 217 555 0199" && contacts[0].UserID == userID
+		})).Return(int64(1), nil)
+
+		body := appleCard + "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:No Phone\r\nEND:VCARD\r\n"
+		req := httptest.NewRequest(http.MethodPost, "/contacts/import", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/vcard")
+		w := serve(req)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var response ImportResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, 1, response.Data.Imported)
+		assert.Equal(t, []httpserver.ImportRowError{
+			{Line: 13, Errors: []httpserver.FieldError{{Field: "phone", Message: "is required"}}},
+		}, response.Data.Errors)
+
+		mockRepo.AssertExpectations(t)
+		t.Cleanup(func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package utilis
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for pagination cursors that are malformed or
+// were not signed with our key.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SignCursor encodes v as an opaque "<payload>.<signature>" string. The HMAC
+// stops clients from crafting cursors that point anywhere they like.
+func SignCursor(v interface{}, secretKey string) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(cursorMAC(encoded, secretKey)), nil
+}
+
+// VerifyCursor checks the signature of a cursor made by SignCursor and decodes
+// its payload into v.
+func VerifyCursor(cursor string, secretKey string, v interface{}) error {
+	encoded, signature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, cursorMAC(encoded, secretKey)) {
+		return ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return errors.Wrap(ErrInvalidCursor, err.Error())
+	}
+	return nil
+}
+
+func cursorMAC(encoded string, secretKey string) []byte {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -1,6 +1,9 @@
 package utilis
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -16,3 +19,19 @@ func CheckPasswordHash(hashedPassword, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
+
+// GenerateOpaqueToken returns a random URL-safe token together with its
+// SHA-256 hash. Only the hash should be persisted.
+func GenerateOpaqueToken() (string, []byte, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashOpaqueToken(token), nil
+}
+
+func HashOpaqueToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -2,19 +2,43 @@ package utilis
 
 import (
 	"encoding/json"
+	"github.com/go-chi/chi/v5/middleware"
 	"net/http"
 )
 
+// ProblemContentType is the media type of Problem, from RFC 7807.
+const ProblemContentType = "application/problem+json"
+
 type CommonResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// FieldError describes why a single field of a payload was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is the body of every failed request, as RFC 7807 problem details
+// with the request ID and the fields that were rejected as extensions.
+type Problem struct {
+	Type      string       `json:"type"`                 // "about:blank", so Title is the HTTP status text
+	Title     string       `json:"title"`                // Summary of the problem type
+	Status    int          `json:"status"`               // HTTP status code
+	Detail    string       `json:"detail,omitempty"`     // What went wrong with this request
+	Instance  string       `json:"instance,omitempty"`   // Path of the request
+	RequestID string       `json:"request_id,omitempty"` // ID the request is logged with
+	Errors    []FieldError `json:"errors,omitempty"`     // Fields that failed validation
+}
+
 type ResponseState struct {
 	StatusCode int
 	Message    string
 }
 
+// WriteToResponse writes a successful response, with data in the
+// CommonResponse envelope.
 func (rs ResponseState) WriteToResponse(w http.ResponseWriter, data interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(rs.StatusCode)
@@ -23,3 +47,24 @@ func (rs ResponseState) WriteToResponse(w http.ResponseWriter, data interface{})
 		Data:    data,
 	})
 }
+
+// Problem describes the failure of req, with errs for the fields that were
+// rejected.
+func (rs ResponseState) Problem(req *http.Request, errs []FieldError) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(rs.StatusCode),
+		Status:    rs.StatusCode,
+		Detail:    rs.Message,
+		Instance:  req.URL.Path,
+		RequestID: middleware.GetReqID(req.Context()),
+		Errors:    errs,
+	}
+}
+
+// WriteProblem writes a failed response as problem details.
+func (rs ResponseState) WriteProblem(w http.ResponseWriter, req *http.Request, errs []FieldError) error {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(rs.StatusCode)
+	return json.NewEncoder(w).Encode(rs.Problem(req, errs))
+}
@@ -1,8 +1,13 @@
 package utilis
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"github.com/gofrs/uuid"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
 	"time"
 )
 
@@ -15,14 +20,71 @@ type Claims struct {
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeRefresh        = "refresh"
 )
 
+// ErrInvalidToken is returned for tokens that are malformed, expired or not
+// signed by us. ErrWrongScope is returned for genuine tokens presented to a
+// route that expects a different token type.
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrWrongScope   = errors.New("token scope not permitted")
+)
+
+type scopeIdentity struct {
+	Issuer   string
+	Audience string
+}
+
+// scopeIdentities pins every scope to its own issuer and audience so a token
+// minted for one purpose can never satisfy the checks of another.
+var scopeIdentities = map[string]scopeIdentity{
+	ScopeActivation:     {Issuer: "go_chi_pgx/users", Audience: "go_chi_pgx/activation"},
+	ScopeAuthentication: {Issuer: "go_chi_pgx/token/auth", Audience: "go_chi_pgx/api"},
+	ScopeRefresh:        {Issuer: "go_chi_pgx/token/auth", Audience: "go_chi_pgx/token/refresh"},
+}
+
+// ScopeKeys holds a separate signing key for each token type.
+type ScopeKeys struct {
+	Activation     string
+	Authentication string
+	Refresh        string
+}
+
+// DeriveKey derives a key for purpose from secret, so a deployment that sets
+// only one secret still signs every scope with a different key.
+func DeriveKey(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (k ScopeKeys) For(scope string) (string, bool) {
+	switch scope {
+	case ScopeActivation:
+		return k.Activation, k.Activation != ""
+	case ScopeAuthentication:
+		return k.Authentication, k.Authentication != ""
+	case ScopeRefresh:
+		return k.Refresh, k.Refresh != ""
+	default:
+		return "", false
+	}
+}
+
 func GenerateJWT(userID uuid.UUID, scope string, secretKey string, ttl time.Duration) (string, error) {
+	identity, ok := scopeIdentities[scope]
+	if !ok {
+		return "", fmt.Errorf("unknown token scope %q", scope)
+	}
 
 	claims := Claims{
 		UserID: userID,
 		Scope:  scope,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    identity.Issuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{identity.Audience},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -37,13 +99,21 @@ func GenerateJWT(userID uuid.UUID, scope string, secretKey string, ttl time.Dura
 	return signedToken, nil
 }
 
-func GenerateRefreshToken(userID string, secretKey string) (string, error) {
-	refreshTokenID := uuid.Must(uuid.NewV4()).String()
-	claims := jwt.StandardClaims{
-		Id:        refreshTokenID,
-		Subject:   userID,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour).Unix(),
-		IssuedAt:  time.Now().Unix(),
+// GenerateRefreshToken signs a refresh token whose "jti" is tokenID, the key
+// of the matching row in the refresh_tokens table.
+func GenerateRefreshToken(userID uuid.UUID, tokenID uuid.UUID, secretKey string, ttl time.Duration) (string, error) {
+	identity := scopeIdentities[ScopeRefresh]
+	claims := Claims{
+		UserID: userID,
+		Scope:  ScopeRefresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID.String(),
+			Issuer:    identity.Issuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{identity.Audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signedToken, err := token.SignedString([]byte(secretKey))
@@ -53,3 +123,39 @@ func GenerateRefreshToken(userID string, secretKey string) (string, error) {
 
 	return signedToken, nil
 }
+
+// VerifyJWT checks the token against the key, issuer and audience of the scope
+// it claims, then requires that scope to be the expected one. Verifying with
+// the claimed scope's key first lets callers tell a forged token (ErrInvalidToken)
+// apart from a genuine token of the wrong type (ErrWrongScope).
+func VerifyJWT(tokenString string, expectedScope string, keys ScopeKeys) (*Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		key, ok := keys.For(claims.Scope)
+		if !ok {
+			return nil, fmt.Errorf("unknown token scope %q", claims.Scope)
+		}
+		return []byte(key), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	identity := scopeIdentities[claims.Scope]
+	if !claims.VerifyIssuer(identity.Issuer, true) || !claims.VerifyAudience(identity.Audience, true) {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Scope != expectedScope {
+		return nil, ErrWrongScope
+	}
+
+	return &claims, nil
+}
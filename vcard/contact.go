@@ -0,0 +1,235 @@
+package vcard
+
+import (
+	"github.com/gofrs/uuid"
+	"go_chi_pgx/repository"
+	"strings"
+	"time"
+)
+
+const productID = "-//go_chi_pgx//Contacts//EN"
+
+// FromContact builds a card of the given version for contact. FN, which both
+// versions require, falls back from the display name to the given and family
+// names, the company and finally the phone number.
+func FromContact(contact *repository.Contact, version string) *Card {
+	if version != Version4 {
+		version = Version3
+	}
+
+	card := &Card{}
+	card.Add(
+		NewText("VERSION", version),
+		NewText("PRODID", productID),
+		NewText("FN", formattedName(contact)),
+	)
+	if version == Version3 || contact.GivenName != "" || contact.FamilyName != "" {
+		card.Add(NewStructured("N", contact.FamilyName, contact.GivenName, "", "", ""))
+	}
+	if contact.Nickname != "" {
+		card.Add(NewText("NICKNAME", contact.Nickname))
+	}
+	if contact.Company != "" {
+		card.Add(NewStructured("ORG", contact.Company))
+	}
+	if contact.JobTitle != "" {
+		card.Add(NewText("TITLE", contact.JobTitle))
+	}
+
+	uid := contact.ID.String()
+	rev := contact.UpdatedAt.UTC().Format(time.RFC3339)
+	if version == Version4 {
+		uid = "urn:uuid:" + uid
+		rev = contact.UpdatedAt.UTC().Format("20060102T150405Z")
+	}
+	card.Add(NewText("UID", uid))
+
+	// Contacts read without their lists only have the flat fields.
+	if len(contact.Phones) == 0 && contact.Phone != "" {
+		card.Add(NewText("TEL", contact.Phone).WithParam("TYPE", "voice"))
+	}
+	for _, phone := range contact.Phones {
+		card.Add(withType(NewText("TEL", phone.Number), version, phone.Label, phone.Primary, "voice"))
+	}
+	var emailTypes []string
+	if version == Version3 {
+		emailTypes = []string{"internet"}
+	}
+	for _, email := range contact.Emails {
+		card.Add(withType(NewText("EMAIL", email.Address), version, email.Label, email.Primary, emailTypes...))
+	}
+	if len(contact.Addresses) == 0 && (contact.Street != "" || contact.City != "" || contact.State != "" || contact.ZipCode != "" || contact.Country != "") {
+		card.Add(NewStructured("ADR", "", "", contact.Street, contact.City, contact.State, contact.ZipCode, contact.Country))
+	}
+	for _, a := range contact.Addresses {
+		card.Add(withType(NewStructured("ADR", "", "", a.Street, a.City, a.State, a.ZipCode, a.Country), version, a.Label, a.Primary))
+	}
+	if contact.Notes != "" {
+		card.Add(NewText("NOTE", contact.Notes))
+	}
+	if !contact.UpdatedAt.IsZero() {
+		card.Add(NewText("REV", rev))
+	}
+	return card
+}
+
+// formattedName returns the name a card shows for contact.
+func formattedName(contact *repository.Contact) string {
+	if contact.DisplayName != "" {
+		return contact.DisplayName
+	}
+	if name := strings.TrimSpace(contact.GivenName + " " + contact.FamilyName); name != "" {
+		return name
+	}
+	if contact.Company != "" {
+		return contact.Company
+	}
+	return contact.Phone
+}
+
+// labelTypes maps list labels to vCard TYPE values and back. Labels without
+// a TYPE of their own are written without one and read back as "other".
+var labelTypes = map[string]string{
+	"mobile": "cell",
+	"work":   "work",
+	"home":   "home",
+}
+
+// withType adds the TYPE of label, the extra types and the preference of a
+// list entry, which 3.0 writes as TYPE=pref and 4.0 as PREF=1.
+func withType(prop Property, version, label string, primary bool, types ...string) Property {
+	if t, ok := labelTypes[label]; ok {
+		types = append([]string{t}, types...)
+	}
+	if primary && version == Version3 {
+		types = append(types, "pref")
+	}
+	if len(types) > 0 {
+		prop = prop.WithParam("TYPE", strings.Join(types, ","))
+	}
+	if primary && version == Version4 {
+		prop = prop.WithParam("PREF", "1")
+	}
+	return prop
+}
+
+// label returns the list label of the first TYPE of prop that has one, out of
+// the labels allowed for its kind, and fallback otherwise.
+func label(prop Property, allowed map[string]bool, fallback string) string {
+	for _, t := range prop.Types() {
+		for name, labelType := range labelTypes {
+			if t == labelType && allowed[name] {
+				return name
+			}
+		}
+	}
+	return fallback
+}
+
+var (
+	phoneLabels   = map[string]bool{"mobile": true, "work": true, "home": true}
+	contactLabels = map[string]bool{"work": true, "home": true}
+)
+
+func telNumber(tel Property) string {
+	phone := tel.Text()
+	if len(phone) > 4 && strings.EqualFold(phone[:4], "tel:") {
+		phone = phone[4:]
+	}
+	return strings.TrimSpace(phone)
+}
+
+// postalAddress maps an ADR onto an address. The extended address (apartment,
+// suite) is kept by appending it to the street.
+func postalAddress(adr Property) repository.ContactAddress {
+	parts := adr.Components()
+	for len(parts) < 7 {
+		parts = append(parts, "")
+	}
+	street := strings.TrimSpace(parts[2])
+	if extended := strings.TrimSpace(parts[1]); extended != "" {
+		if street != "" {
+			street += ", "
+		}
+		street += extended
+	}
+	return repository.ContactAddress{
+		Street:  street,
+		City:    strings.TrimSpace(parts[3]),
+		State:   strings.TrimSpace(parts[4]),
+		ZipCode: strings.TrimSpace(parts[5]),
+		Country: strings.TrimSpace(parts[6]),
+	}
+}
+
+// ToContact maps the card onto a contact. Every TEL, EMAIL and ADR becomes a
+// list entry, and the preferred TEL and ADR also fill the flat fields. FN is
+// kept as the display name only when it is not the name FromContact would
+// derive anyway. ID is taken from UID when it holds a UUID and left nil
+// otherwise.
+func ToContact(card *Card) repository.Contact {
+	var contact repository.Contact
+
+	uid := strings.TrimPrefix(strings.ToLower(card.Value("UID")), "urn:uuid:")
+	if id, err := uuid.FromString(uid); err == nil {
+		contact.ID = id
+	}
+
+	if n, ok := card.Preferred("N"); ok {
+		parts := n.Components()
+		for len(parts) < 2 {
+			parts = append(parts, "")
+		}
+		contact.FamilyName = strings.TrimSpace(parts[0])
+		contact.GivenName = strings.TrimSpace(parts[1])
+	}
+	contact.Nickname = strings.TrimSpace(card.Value("NICKNAME"))
+	if org, ok := card.Preferred("ORG"); ok {
+		contact.Company = strings.TrimSpace(org.Components()[0])
+	}
+	contact.JobTitle = strings.TrimSpace(card.Value("TITLE"))
+	contact.Notes = strings.TrimSpace(card.Value("NOTE"))
+
+	if tel, ok := card.Preferred("TEL"); ok {
+		contact.Phone = telNumber(tel)
+	}
+	for _, tel := range card.Get("TEL") {
+		if number := telNumber(tel); number != "" {
+			contact.Phones = append(contact.Phones, repository.ContactPhone{
+				Label:   label(tel, phoneLabels, "other"),
+				Number:  number,
+				Primary: tel.Preferred(),
+			})
+		}
+	}
+
+	for _, email := range card.Get("EMAIL") {
+		if address := strings.TrimSpace(email.Text()); address != "" {
+			contact.Emails = append(contact.Emails, repository.ContactEmail{
+				Label:   label(email, contactLabels, "other"),
+				Address: address,
+				Primary: email.Preferred(),
+			})
+		}
+	}
+
+	if adr, ok := card.Preferred("ADR"); ok {
+		address := postalAddress(adr)
+		contact.Street = address.Street
+		contact.City = address.City
+		contact.State = address.State
+		contact.ZipCode = address.ZipCode
+		contact.Country = address.Country
+	}
+	for _, adr := range card.Get("ADR") {
+		address := postalAddress(adr)
+		address.Label = label(adr, contactLabels, "other")
+		address.Primary = adr.Preferred()
+		contact.Addresses = append(contact.Addresses, address)
+	}
+
+	if fn := strings.TrimSpace(card.Value("FN")); fn != formattedName(&contact) {
+		contact.DisplayName = fn
+	}
+	return contact
+}
@@ -0,0 +1,165 @@
+package vcard
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Decoder reads a stream of cards, one card per call to Decode.
+type Decoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode returns the next card, or io.EOF once the stream is exhausted. A
+// malformed card yields a *ParseError; the decoder then skips to the end of
+// that card, so the caller may keep decoding the rest of the stream.
+func (d *Decoder) Decode() (*Card, error) {
+	var card *Card
+	var parseErr *ParseError
+
+	for {
+		line, start, err := d.readLine()
+		if err == io.EOF {
+			switch {
+			case card != nil:
+				return nil, &ParseError{Line: card.Line, Msg: "missing END:VCARD"}
+			case parseErr != nil:
+				return nil, parseErr
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		prop, err := parseLine(line, start)
+		if err != nil {
+			if card != nil && parseErr == nil {
+				parseErr = err.(*ParseError)
+			}
+			continue
+		}
+
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VCARD"):
+			if card != nil {
+				return nil, &ParseError{Line: start, Msg: "nested BEGIN:VCARD"}
+			}
+			card = &Card{Line: start}
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VCARD"):
+			if card == nil {
+				return nil, &ParseError{Line: start, Msg: "END:VCARD without BEGIN:VCARD"}
+			}
+			if parseErr != nil {
+				return nil, parseErr
+			}
+			if card.Version() == "" {
+				return nil, &ParseError{Line: card.Line, Msg: "missing VERSION"}
+			}
+			return card, nil
+		case card == nil:
+			return nil, &ParseError{Line: start, Msg: "content outside of BEGIN:VCARD"}
+		default:
+			card.Add(prop)
+		}
+	}
+}
+
+// readLine returns the next logical line with folded continuation lines, which
+// start with a space or a tab, joined back on. start is the physical line the
+// logical line began on.
+func (d *Decoder) readLine() (string, int, error) {
+	line, err := d.r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", 0, err
+	}
+	d.line++
+	start := d.line
+	line = strings.TrimRight(line, "\r\n")
+
+	for {
+		next, err := d.r.Peek(1)
+		if err != nil || (next[0] != ' ' && next[0] != '\t') {
+			return line, start, nil
+		}
+		folded, err := d.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", 0, err
+		}
+		d.line++
+		line += strings.TrimRight(folded[1:], "\r\n")
+	}
+}
+
+// parseLine splits a content line into [group "."] name *(";" param) ":" value.
+// Parameter values may be double-quoted to hold ";", ":" or ",".
+func parseLine(line string, lineNo int) (Property, error) {
+	var prop Property
+
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return prop, &ParseError{Line: lineNo, Msg: "expected NAME:value"}
+	}
+	name := line[:end]
+	if group, rest, ok := strings.Cut(name, "."); ok {
+		prop.Group, name = group, rest
+	}
+	prop.Name = strings.ToUpper(name)
+	rest := line[end:]
+
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		paramEnd := strings.IndexAny(rest, "=;:")
+		if paramEnd < 0 {
+			return prop, &ParseError{Line: lineNo, Msg: "unterminated parameter"}
+		}
+		paramName := strings.ToUpper(rest[:paramEnd])
+		rest = rest[paramEnd:]
+
+		if !strings.HasPrefix(rest, "=") {
+			// vCard 2.1 style bare parameters such as TEL;CELL:... are types.
+			prop = prop.WithParam("TYPE", strings.ToLower(paramName))
+			continue
+		}
+		rest = rest[1:]
+
+		var values []string
+		for {
+			var value string
+			if strings.HasPrefix(rest, `"`) {
+				closing := strings.IndexByte(rest[1:], '"')
+				if closing < 0 {
+					return prop, &ParseError{Line: lineNo, Msg: "unterminated quoted parameter"}
+				}
+				value, rest = rest[1:closing+1], rest[closing+2:]
+			} else {
+				valueEnd := strings.IndexAny(rest, ",;:")
+				if valueEnd < 0 {
+					return prop, &ParseError{Line: lineNo, Msg: "unterminated parameter"}
+				}
+				value, rest = rest[:valueEnd], rest[valueEnd:]
+			}
+			values = append(values, paramUnescaper.Replace(value))
+			if !strings.HasPrefix(rest, ",") {
+				break
+			}
+			rest = rest[1:]
+		}
+		prop = prop.WithParam(paramName, values...)
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return prop, &ParseError{Line: lineNo, Msg: "expected ':' before the value"}
+	}
+	prop.Value = valueParser.Replace(rest[1:])
+	return prop, nil
+}
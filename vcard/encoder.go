@@ -0,0 +1,98 @@
+package vcard
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest content line RFC 6350 section 3.2 allows
+// before it has to be folded, not counting the line break.
+const maxLineOctets = 75
+
+// Encoder writes cards with CRLF line endings, folding long lines.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes one card. VERSION is written first, as both RFCs require, and
+// the remaining properties keep their order.
+func (e *Encoder) Encode(card *Card) error {
+	if card.Version() == "" {
+		return errors.New("vcard: VERSION property missing")
+	}
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCARD\r\n")
+	writeLine(&b, formatProperty(NewText("VERSION", card.Version())))
+	for _, prop := range card.Properties {
+		if prop.Name == "VERSION" {
+			continue
+		}
+		writeLine(&b, formatProperty(prop))
+	}
+	b.WriteString("END:VCARD\r\n")
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func formatProperty(prop Property) string {
+	var b strings.Builder
+	if prop.Group != "" {
+		b.WriteString(prop.Group)
+		b.WriteByte('.')
+	}
+	b.WriteString(prop.Name)
+
+	names := make([]string, 0, len(prop.Params))
+	for name := range prop.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b.WriteByte(';')
+		b.WriteString(name)
+		b.WriteByte('=')
+		for i, value := range prop.Params[name] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			value = paramEscaper.Replace(value)
+			if strings.ContainsAny(value, ",;:") {
+				value = `"` + value + `"`
+			}
+			b.WriteString(value)
+		}
+	}
+
+	b.WriteByte(':')
+	b.WriteString(formatValue(prop.Value))
+	return b.String()
+}
+
+// writeLine folds line into chunks of at most maxLineOctets octets, never
+// splitting a UTF-8 sequence. Continuation lines start with a single space,
+// which counts towards their length.
+func writeLine(b *strings.Builder, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
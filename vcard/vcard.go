@@ -0,0 +1,254 @@
+// Package vcard reads and writes vCard 3.0 (RFC 2426) and 4.0 (RFC 6350)
+// address book entries, and maps them to and from contacts.
+package vcard
+
+import (
+	"fmt"
+	govcard "github.com/emersion/go-vcard"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+const (
+	Version3 = "3.0"
+	Version4 = "4.0"
+)
+
+// MediaType is the content type of vCard files. Older clients still send
+// text/x-vcard, which Decode accepts just the same.
+const MediaType = "text/vcard"
+
+// ErrInvalidCard is matched by every ParseError.
+var ErrInvalidCard = errors.New("invalid vCard")
+
+// ParseError reports a malformed card and the line it was found on.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("vcard: line %d: %s", e.Line, e.Msg)
+}
+
+func (e *ParseError) Is(target error) bool {
+	return target == ErrInvalidCard
+}
+
+// Property is one content line of a card: a go-vcard Field and its name, so
+// a card is the go-vcard Card go-webdav serves CardDAV with, field for field.
+// Name and parameter names are upper-cased. Value is held the way go-vcard
+// holds it, with "\\", "\n" and "\," unescaped but "\;" kept, so structured
+// values still split on unescaped semicolons; use Text or Components to read
+// it.
+type Property struct {
+	govcard.Field
+	Name string
+}
+
+// NewText builds a property holding a single text value.
+func NewText(name, value string) Property {
+	return Property{Name: strings.ToUpper(name), Field: govcard.Field{Value: escapeSemicolons(value)}}
+}
+
+// NewStructured builds a property made of ";" separated components, such as
+// N or ADR.
+func NewStructured(name string, components ...string) Property {
+	escaped := make([]string, len(components))
+	for i, component := range components {
+		escaped[i] = escapeSemicolons(component)
+	}
+	return Property{Name: strings.ToUpper(name), Field: govcard.Field{Value: strings.Join(escaped, ";")}}
+}
+
+// Text returns the value with its semicolons unescaped.
+func (p Property) Text() string {
+	return strings.Join(p.split(false), "")
+}
+
+// Components splits a structured value on unescaped semicolons.
+func (p Property) Components() []string {
+	return p.split(true)
+}
+
+// split unescapes the semicolons of the value, breaking it into components at
+// the unescaped ones when structured is set.
+func (p Property) split(structured bool) []string {
+	var components []string
+	var current strings.Builder
+	for i := 0; i < len(p.Value); i++ {
+		switch c := p.Value[i]; {
+		case c == '\\' && i+1 < len(p.Value) && p.Value[i+1] == ';':
+			current.WriteByte(';')
+			i++
+		case c == ';' && structured:
+			components = append(components, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	return append(components, current.String())
+}
+
+// Types returns the lower-cased TYPE parameter values, so TYPE=WORK,VOICE and
+// TYPE=work;TYPE=voice both give [work voice].
+func (p Property) Types() []string {
+	var types []string
+	for _, value := range p.Params["TYPE"] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// Preferred reports whether the property is marked as the preferred one of its
+// kind, with TYPE=pref in 3.0 or a PREF parameter in 4.0.
+func (p Property) Preferred() bool {
+	if _, ok := p.Params["PREF"]; ok {
+		return true
+	}
+	for _, t := range p.Types() {
+		if t == "pref" {
+			return true
+		}
+	}
+	return false
+}
+
+// WithParam returns a copy of p with value appended to parameter name.
+func (p Property) WithParam(name string, values ...string) Property {
+	params := make(govcard.Params, len(p.Params)+1)
+	for k, v := range p.Params {
+		params[k] = v
+	}
+	name = strings.ToUpper(name)
+	params[name] = append(append([]string(nil), params[name]...), values...)
+	p.Params = params
+	return p
+}
+
+// Card is a single vCard. Properties keep the order they were read or added in.
+type Card struct {
+	Properties []Property
+	Line       int // Line of the BEGIN:VCARD that started the card, 0 for built cards
+}
+
+// Get returns every property called name.
+func (c *Card) Get(name string) []Property {
+	name = strings.ToUpper(name)
+	var props []Property
+	for _, p := range c.Properties {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// Preferred returns the preferred property called name, falling back to the
+// first one. ok is false when the card has none.
+func (c *Card) Preferred(name string) (Property, bool) {
+	props := c.Get(name)
+	if len(props) == 0 {
+		return Property{}, false
+	}
+	for _, p := range props {
+		if p.Preferred() {
+			return p, true
+		}
+	}
+	return props[0], true
+}
+
+// Value returns the text of the first property called name, or "".
+func (c *Card) Value(name string) string {
+	if props := c.Get(name); len(props) > 0 {
+		return props[0].Text()
+	}
+	return ""
+}
+
+func (c *Card) Add(props ...Property) {
+	c.Properties = append(c.Properties, props...)
+}
+
+// Library returns the card as a go-vcard Card.
+func (c *Card) Library() govcard.Card {
+	card := make(govcard.Card, len(c.Properties))
+	for _, prop := range c.Properties {
+		field := prop.Field
+		card[prop.Name] = append(card[prop.Name], &field)
+	}
+	return card
+}
+
+// FromLibrary returns a go-vcard Card as a card. go-vcard keeps no order
+// between properties of different names, so they come sorted by name.
+func FromLibrary(card govcard.Card) *Card {
+	names := make([]string, 0, len(card))
+	for name := range card {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	converted := &Card{}
+	for _, name := range names {
+		for _, field := range card[name] {
+			prop := Property{Name: strings.ToUpper(name), Field: govcard.Field{Value: field.Value, Group: field.Group}}
+			for param, values := range field.Params {
+				prop = prop.WithParam(param, values...)
+			}
+			converted.Add(prop)
+		}
+	}
+	return converted
+}
+
+// Version returns the VERSION of the card.
+func (c *Card) Version() string {
+	return c.Value("VERSION")
+}
+
+var (
+	// valueParser unescapes a value read off the wire the way go-vcard does,
+	// and also takes "\N" and "\:", which some clients send.
+	valueParser = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\N`, "\n", `\,`, ",", `\:`, ":")
+
+	// Parameter values can't be backslash-escaped; RFC 6868 uses carets to
+	// carry newlines and double quotes instead.
+	paramEscaper   = strings.NewReplacer("^", "^^", "\r\n", "^n", "\n", "^n", `"`, "^'")
+	paramUnescaper = strings.NewReplacer("^^", "^", "^n", "\n", "^N", "\n", "^'", `"`)
+)
+
+func escapeSemicolons(s string) string {
+	return strings.ReplaceAll(s, ";", `\;`)
+}
+
+// formatValue escapes a value for the wire. The "\;" it holds already is
+// written as is, which go-vcard's own encoder can't do.
+func formatValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\' && i+1 < len(v) && v[i+1] == ';':
+			b.WriteString(`\;`)
+			i++
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == '\r' && i+1 < len(v) && v[i+1] == '\n':
+			// Dropped, the newline after it is written as "\n".
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == ',':
+			b.WriteString(`\,`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}